@@ -0,0 +1,92 @@
+package chaindb
+
+// Database interfacing for the optional address index
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/danitello/go-blockchain/common/byteutil"
+	"github.com/danitello/go-blockchain/common/errutil"
+	"github.com/danitello/go-blockchain/common/hexutil"
+)
+
+const (
+	// AddrIndexKey is the db key -> existence means the address index is maintained for new Blocks
+	AddrIndexKey = "addrIndexKey"
+)
+
+var (
+	// addrPrefix is the db key prefix -> followed by pub key hash, height and tx ID, value is an AddressTx
+	addrPrefix = []byte("addr-")
+)
+
+// AddressTx is the effect of one Transaction on the balance of one pub key hash -
+// PubKeyHash - the owner whose balance changed
+// TxID - ID of the Transaction
+// Height - height of the Block containing the Transaction
+// Received - sum of the txos of the Transaction locked with PubKeyHash
+// Sent - sum of the txos locked with PubKeyHash that are spent by the txins of the Transaction
+type AddressTx struct {
+	PubKeyHash []byte
+	TxID       []byte
+	Height     int
+	Received   int
+	Sent       int
+}
+
+// HasAddressIndex determines whether the address index is enabled
+func (db *ChainDB) HasAddressIndex() bool {
+	exists, err := db.Store.Has([]byte(AddrIndexKey))
+	errutil.Handle(err)
+
+	return exists
+}
+
+// EnableAddressIndex marks the address index as maintained for new Blocks
+func (db *ChainDB) EnableAddressIndex() {
+	err := db.Store.Put([]byte(AddrIndexKey), []byte{1})
+	errutil.Handle(err)
+}
+
+// PutAddressTxs adds writing entries of the address index to a Batch
+func (db *ChainDB) PutAddressTxs(batch Batch, addressTxs []AddressTx) {
+	for _, addressTx := range addressTxs {
+		batch.Put(addressTxKey(addressTx), byteutil.Serialize(addressTx))
+	}
+}
+
+// ReadAddressTxs gets the entries of the address index for a given pub key hash, oldest first
+func (db *ChainDB) ReadAddressTxs(pubKeyHash []byte) []AddressTx {
+	var addressTxs []AddressTx
+	prefix := append(append([]byte{}, addrPrefix...), pubKeyHash...)
+
+	err := db.Store.Iterate(prefix, func(_, value []byte) error {
+		addressTxs = append(addressTxs, deserializeAddressTx(value))
+		return nil
+	})
+	errutil.Handle(err)
+
+	return addressTxs
+}
+
+// DeleteAddressIndex removes all entries of the address index
+func (db *ChainDB) DeleteAddressIndex() {
+	db.DeleteWithKeyPrefix(addrPrefix)
+}
+
+// addressTxKey creates the db key for an address index entry, ordering the entries of a pub key hash by height
+func addressTxKey(addressTx AddressTx) []byte {
+	return bytes.Join([][]byte{addrPrefix, addressTx.PubKeyHash, hexutil.ToHex(int64(addressTx.Height)), addressTx.TxID}, []byte{})
+}
+
+// deserializeAddressTx converts a []byte into an AddressTx
+func deserializeAddressTx(data []byte) AddressTx {
+	var addressTx AddressTx
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&addressTx)
+	errutil.Handle(err)
+
+	return addressTx
+}
@@ -0,0 +1,321 @@
+package chaindb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/dgraph-io/badger"
+)
+
+const (
+	// batchJournalKey is the db key -> value is the number of ops of a Batch too big for one badgerdb transaction that
+	// are journalled under batchJournalPrefix, present from when the Batch is committed until it is fully applied
+	batchJournalKey = "batchJournalKey"
+)
+
+var (
+	// batchJournalPrefix is the prefix of the db keys -> value is an op of a journalled Batch, keyed by its idx
+	batchJournalPrefix = []byte("batchJournal-")
+)
+
+// badgerStore is a Store backed by badgerdb
+type badgerStore struct {
+	db *badger.DB
+}
+
+// badgerSnapshot is a Snapshot backed by a read-only badgerdb transaction
+type badgerSnapshot struct {
+	txn *badger.Txn
+}
+
+// OpenBadgerStore opens a badgerdb Store from the specified directory
+func OpenBadgerStore(dir string) (Store, error) {
+	opts := badger.DefaultOptions
+	opts.Dir = dir
+	opts.ValueDir = dir
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &badgerStore{db}
+	if err := s.recoverBatch(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Get retrieves the value of a key
+func (s *badgerStore) Get(key []byte) (value []byte, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		value, err = badgerGet(txn, key)
+		return err
+	})
+	return
+}
+
+// Has determines whether a key exists
+func (s *badgerStore) Has(key []byte) (bool, error) {
+	_, err := s.Get(key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Iterate calls fn in key order for each key starting with prefix
+func (s *badgerStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		return badgerIterate(txn, prefix, fn)
+	})
+}
+
+// Put sets the value of a key
+func (s *badgerStore) Put(key, value []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(copyBytes(key), copyBytes(value))
+	})
+}
+
+// Delete removes a key
+func (s *badgerStore) Delete(key []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(copyBytes(key))
+	})
+}
+
+// NewBatch creates a Batch applied in a single badgerdb transaction - one too big for a transaction is journalled in
+// chunks first, then marked as committed with batchJournalKey and applied in chunks, so if the process stops partway
+// it is either dropped or finished when the Store is opened again
+func (s *badgerStore) NewBatch() Batch {
+	return &batch{apply: func(ops []batchOp) error {
+		txn := s.db.NewTransaction(true)
+		defer txn.Discard()
+		for _, op := range ops {
+			err := badgerApply(txn, op)
+			if err == badger.ErrTxnTooBig {
+				txn.Discard()
+				return s.applyJournalled(ops)
+			} else if err != nil {
+				return err
+			}
+		}
+
+		return txn.Commit(nil)
+	}}
+}
+
+// applyJournalled applies the ops of a Batch too big for one badgerdb transaction through the journal
+func (s *badgerStore) applyJournalled(ops []batchOp) error {
+	// A journal left by a Batch that failed before it was committed is overwritten, the count marks what is in it
+	journal := make([]batchOp, len(ops))
+	for i, op := range ops {
+		journal[i] = batchOp{batchJournalOpKey(i), encodeBatchOp(op)}
+	}
+	if err := s.applyChunked(journal); err != nil {
+		return err
+	}
+
+	count := make([]byte, 8)
+	binary.BigEndian.PutUint64(count, uint64(len(ops)))
+	if err := s.Put([]byte(batchJournalKey), count); err != nil {
+		return err
+	}
+
+	return s.finishBatch(ops)
+}
+
+// recoverBatch finishes applying a journalled Batch that was committed, and drops the journal of one that wasn't
+func (s *badgerStore) recoverBatch() error {
+	value, err := s.Get([]byte(batchJournalKey))
+	if err == ErrNotFound {
+		return s.dropJournal(nil)
+	} else if err != nil {
+		return err
+	}
+	if len(value) != 8 {
+		return fmt.Errorf("Invalid batch journal marker")
+	}
+
+	count := int(binary.BigEndian.Uint64(value))
+	ops := make([]batchOp, count)
+	for i := range ops {
+		encoded, err := s.Get(batchJournalOpKey(i))
+		if err != nil {
+			return fmt.Errorf("Reading op %d of the batch journal: %s", i, err)
+		}
+		if ops[i], err = decodeBatchOp(encoded); err != nil {
+			return err
+		}
+	}
+
+	return s.finishBatch(ops)
+}
+
+// finishBatch applies the ops of a committed journalled Batch in chunks, then removes the journal and its marker -
+// applying them again from the start after an interruption gives the same result
+func (s *badgerStore) finishBatch(ops []batchOp) error {
+	if err := s.applyChunked(ops); err != nil {
+		return err
+	}
+
+	return s.dropJournal([]byte(batchJournalKey))
+}
+
+// dropJournal deletes every journalled op, then the given marker key if it isn't nil
+func (s *badgerStore) dropJournal(marker []byte) error {
+	var deletes []batchOp
+	err := s.Iterate(batchJournalPrefix, func(key, _ []byte) error {
+		deletes = append(deletes, batchOp{copyBytes(key), nil})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.applyChunked(deletes); err != nil {
+		return err
+	}
+
+	if marker == nil {
+		return nil
+	}
+	return s.Delete(marker)
+}
+
+// applyChunked applies ops in order in as many badgerdb transactions as they need
+func (s *badgerStore) applyChunked(ops []batchOp) error {
+	txn := s.db.NewTransaction(true)
+	defer func() { txn.Discard() }()
+
+	for _, op := range ops {
+		err := badgerApply(txn, op)
+		if err == badger.ErrTxnTooBig {
+			if err := txn.Commit(nil); err != nil {
+				return err
+			}
+			txn = s.db.NewTransaction(true)
+			err = badgerApply(txn, op)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return txn.Commit(nil)
+}
+
+// Snapshot creates a consistent read-only view of the Store
+func (s *badgerStore) Snapshot() (Snapshot, error) {
+	return &badgerSnapshot{s.db.NewTransaction(false)}, nil
+}
+
+// Close closes the badgerdb
+func (s *badgerStore) Close() error {
+	return s.db.Close()
+}
+
+// Get retrieves the value of a key
+func (snap *badgerSnapshot) Get(key []byte) ([]byte, error) {
+	return badgerGet(snap.txn, key)
+}
+
+// Has determines whether a key exists
+func (snap *badgerSnapshot) Has(key []byte) (bool, error) {
+	_, err := snap.Get(key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Iterate calls fn in key order for each key starting with prefix
+func (snap *badgerSnapshot) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return badgerIterate(snap.txn, prefix, fn)
+}
+
+// Release discards the read-only transaction
+func (snap *badgerSnapshot) Release() {
+	snap.txn.Discard()
+}
+
+// badgerGet retrieves a copy of the value of a key within a transaction
+func badgerGet(txn *badger.Txn, key []byte) ([]byte, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
+
+// badgerApply adds an op to a transaction
+func badgerApply(txn *badger.Txn, op batchOp) error {
+	if op.value == nil {
+		return txn.Delete(op.key)
+	}
+	return txn.Set(op.key, op.value)
+}
+
+// batchJournalOpKey is the key of the op with an idx in the batch journal
+func batchJournalOpKey(idx int) []byte {
+	key := make([]byte, len(batchJournalPrefix)+8)
+	copy(key, batchJournalPrefix)
+	binary.BigEndian.PutUint64(key[len(batchJournalPrefix):], uint64(idx))
+
+	return key
+}
+
+// encodeBatchOp writes an op as the length of its key, the key, then a 1 and the value for a put or a 0 for a delete
+func encodeBatchOp(op batchOp) []byte {
+	encoded := make([]byte, 4, 4+len(op.key)+1+len(op.value))
+	binary.BigEndian.PutUint32(encoded, uint32(len(op.key)))
+	encoded = append(encoded, op.key...)
+	if op.value == nil {
+		return append(encoded, 0)
+	}
+
+	return append(append(encoded, 1), op.value...)
+}
+
+// decodeBatchOp reads an op written by encodeBatchOp
+func decodeBatchOp(encoded []byte) (batchOp, error) {
+	if len(encoded) < 4 {
+		return batchOp{}, fmt.Errorf("Invalid batch journal op")
+	}
+	keyLen := int(binary.BigEndian.Uint32(encoded))
+	if len(encoded) < 4+keyLen+1 {
+		return batchOp{}, fmt.Errorf("Invalid batch journal op")
+	}
+
+	op := batchOp{key: encoded[4 : 4+keyLen]}
+	if encoded[4+keyLen] == 1 {
+		op.value = encoded[4+keyLen+1:]
+	}
+	return op, nil
+}
+
+// badgerIterate calls fn in key order for each key starting with prefix within a transaction
+func badgerIterate(txn *badger.Txn, prefix []byte, fn func(key, value []byte) error) error {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		value, err := item.Value()
+		if err != nil {
+			return err
+		}
+
+		if err := fn(item.Key(), value); err == ErrStopIteration {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
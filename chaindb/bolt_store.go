@@ -0,0 +1,180 @@
+package chaindb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// boltFile is the name of the bbolt file inside the data directory
+	boltFile = "chain.db"
+	// boltMmapSize is the size of the memory map of the bbolt file to start with - a write that grows the file past it
+	// has to remap it, which waits for every open Snapshot to be released
+	boltMmapSize = 1 << 30
+)
+
+var (
+	// boltBucket is the single bucket that holds all keys
+	boltBucket = []byte("chain")
+)
+
+// boltStore is a Store backed by bbolt
+type boltStore struct {
+	db *bolt.DB
+}
+
+// boltSnapshot is a Snapshot backed by a read-only bbolt transaction
+type boltSnapshot struct {
+	tx *bolt.Tx
+}
+
+// OpenBoltStore opens a bbolt Store from the specified directory
+func OpenBoltStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filepath.Join(dir, boltFile), 0600, &bolt.Options{InitialMmapSize: boltMmapSize})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltStore{db}, nil
+}
+
+// Get retrieves the value of a key
+func (s *boltStore) Get(key []byte) (value []byte, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		value, err = boltGet(tx, key)
+		return err
+	})
+	return
+}
+
+// Has determines whether a key exists
+func (s *boltStore) Has(key []byte) (bool, error) {
+	_, err := s.Get(key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Iterate calls fn in key order for each key starting with prefix
+func (s *boltStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return boltIterate(tx, prefix, fn)
+	})
+}
+
+// Put sets the value of a key
+func (s *boltStore) Put(key, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put(key, value)
+	})
+}
+
+// Delete removes a key
+func (s *boltStore) Delete(key []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete(key)
+	})
+}
+
+// NewBatch creates a Batch applied in a single bbolt transaction
+func (s *boltStore) NewBatch() Batch {
+	return &batch{apply: func(ops []batchOp) error {
+		return s.db.Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket(boltBucket)
+			for _, op := range ops {
+				var err error
+				if op.value == nil {
+					err = bucket.Delete(op.key)
+				} else {
+					err = bucket.Put(op.key, op.value)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}}
+}
+
+// Snapshot creates a consistent read-only view of the Store -
+// it should be released before large writes, as bbolt can't grow its file while a read transaction is open
+func (s *boltStore) Snapshot() (Snapshot, error) {
+	tx, err := s.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltSnapshot{tx}, nil
+}
+
+// Close closes the bbolt file
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// Get retrieves the value of a key
+func (snap *boltSnapshot) Get(key []byte) ([]byte, error) {
+	return boltGet(snap.tx, key)
+}
+
+// Has determines whether a key exists
+func (snap *boltSnapshot) Has(key []byte) (bool, error) {
+	_, err := snap.Get(key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Iterate calls fn in key order for each key starting with prefix
+func (snap *boltSnapshot) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return boltIterate(snap.tx, prefix, fn)
+}
+
+// Release rolls back the read-only transaction
+func (snap *boltSnapshot) Release() {
+	snap.tx.Rollback()
+}
+
+// boltGet retrieves a copy of the value of a key within a transaction
+func boltGet(tx *bolt.Tx, key []byte) ([]byte, error) {
+	value := tx.Bucket(boltBucket).Get(key)
+	if value == nil {
+		return nil, ErrNotFound
+	}
+
+	return copyBytes(value), nil
+}
+
+// boltIterate calls fn in key order for each key starting with prefix within a transaction
+func boltIterate(tx *bolt.Tx, prefix []byte, fn func(key, value []byte) error) error {
+	c := tx.Bucket(boltBucket).Cursor()
+
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if err := fn(k, v); err == ErrStopIteration {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
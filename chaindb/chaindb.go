@@ -3,100 +3,267 @@ package chaindb
 // Database interfacing
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/danitello/go-blockchain/common/byteutil"
 	"github.com/danitello/go-blockchain/common/errutil"
+	"github.com/danitello/go-blockchain/common/hexutil"
+	"github.com/danitello/go-blockchain/common/lockfile"
+	"github.com/danitello/go-blockchain/config"
 	"github.com/danitello/go-blockchain/core/types"
-	"github.com/dgraph-io/badger"
 )
 
 // ChainDB is the database for a BlockChain
 type ChainDB struct {
-	Database *badger.DB
+	Store Store
+	lock  *lockfile.Lock
 }
 
 const (
-	// Dir - path to block data
-	Dir = "./tmp/blocks"
+	// lockFile is the name of the file inside the chain directory that is locked while a process has the ChainDB open
+	lockFile = "chain.lock"
 
 	// LastHashKey is the db key -> value is hash of most recent block in db
 	LastHashKey = "lastHashKey"
+
+	// UTXOBestKey is the db key -> value is hash of the most recent block whose changes are in the UTXO set
+	UTXOBestKey = "utxoBestKey"
+
+	// PrunedHeightKey is the db key -> value is the height up to which the data of Blocks has been deleted
+	PrunedHeightKey = "prunedHeightKey"
+
+	// deleteBatchSize is the max number of keys removed per write when deleting by prefix
+	deleteBatchSize = 100000
 )
 
-// InitDB instantiates a new ChainDB instance from the specified directory
-func InitDB() *ChainDB {
-	opts := badger.DefaultOptions
-	opts.Dir = Dir
-	opts.ValueDir = Dir
-	bdb, err := badger.Open(opts)
+var (
+	// heightPrefix is the db key prefix -> value is hash of the Block at the height that follows
+	heightPrefix = []byte("height-")
+
+	// headerPrefix is the db key prefix -> value is the BlockHeader of the Block whose hash follows
+	headerPrefix = []byte("header-")
+
+	// UTXOPrefix is the db key prefix -> value is the TxOutputs of the Transaction whose ID follows that are unspent
+	UTXOPrefix = []byte("utxo-")
+
+	// ErrHeightNotFound is returned when no Block of the active chain is indexed at a given height
+	ErrHeightNotFound = errors.New("No block found at height")
+
+	// ErrBlockNotFound is returned when there is no Block with a given hash
+	ErrBlockNotFound = errors.New("Block not found")
+
+	// ErrBlockPruned is returned when the Block with a given hash is known but its data has been pruned
+	ErrBlockPruned = errors.New("Block data has been pruned, only its header is available")
+)
+
+// InitDB instantiates a new ChainDB instance from the chain directory and backend of a given Config,
+// holding an exclusive lock on the directory until CloseDB
+func InitDB(cfg *config.Config) *ChainDB {
+	if cfg.Backend == MemoryBackend {
+		return InitDBWithStore(NewMemoryStore())
+	}
+
+	dir := cfg.ChainDir()
+	err := os.MkdirAll(dir, 0700)
+	errutil.Handle(err)
+
+	lock, err := lockfile.Acquire(filepath.Join(dir, lockFile))
+	if err == lockfile.ErrLocked {
+		errutil.Handle(fmt.Errorf("Chain database in %s is in use by another process", dir))
+	}
+	errutil.Handle(err)
+
+	store, err := OpenStore(cfg.Backend, dir)
+	if err != nil {
+		lock.Release()
+	}
 	errutil.Handle(err)
-	db := ChainDB{bdb}
+
+	// Don't leave the directory locked if the data can't be opened
+	defer func() {
+		if r := recover(); r != nil {
+			lock.Release()
+			panic(r)
+		}
+	}()
+
+	db := InitDBWithStore(store)
+	db.lock = lock
+	return db
+}
+
+// InitDBWithStore instantiates a new ChainDB instance on top of an already opened Store,
+// upgrading the data to the current SchemaVersion
+func InitDBWithStore(store Store) *ChainDB {
+	db := ChainDB{Store: store}
+
+	if err := db.upgradeSchema(printMigrationProgress); err != nil {
+		store.Close()
+		errutil.Handle(err)
+	}
+
 	return &db
 }
 
 // HasChain determines whether the ChainDB instance has a previously initiated BlockChain
 func (db *ChainDB) HasChain() bool {
-	var exists bool
-	err := db.Database.View(func(txn *badger.Txn) error {
-		if _, err := txn.Get([]byte(LastHashKey)); err == badger.ErrKeyNotFound {
-			exists = false
-			return err
-		}
+	exists, err := db.Store.Has([]byte(LastHashKey))
+	errutil.Handle(err)
 
-		exists = true
-		return nil
-	})
-	if err != nil {
-		log.Println(err)
-	}
 	return exists
 }
 
 // ReadLastHash gets the hash of the most recent Block in the database
-func (db *ChainDB) ReadLastHash() (lastHash []byte) {
-	err := db.Database.View(func(txn *badger.Txn) (err error) {
-		item, err := txn.Get([]byte(LastHashKey))
-		errutil.Handle(err)
+func (db *ChainDB) ReadLastHash() []byte {
+	lastHash, err := db.Store.Get([]byte(LastHashKey))
+	errutil.Handle(err)
 
-		lastHash, err = item.Value()
-		return
-	})
+	return lastHash
+}
+
+// ReadBlockWithHash gets a Block from the database, given it's hash, or ErrBlockPruned if only its header is left
+func (db *ChainDB) ReadBlockWithHash(hash []byte) (*types.Block, error) {
+	value, err := db.Store.Get(hash)
+	if err == ErrNotFound {
+		if _, err := db.ReadHeaderWithHash(hash); err == nil {
+			return nil, ErrBlockPruned
+		}
+		return nil, ErrBlockNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return types.DeserializeBlock(value), nil
+}
+
+// ReadHeaderWithHash gets a BlockHeader from the database, given the hash of its Block
+func (db *ChainDB) ReadHeaderWithHash(hash []byte) (*types.BlockHeader, error) {
+	value, err := db.Store.Get(headerKey(hash))
+	if err == ErrNotFound {
+		return nil, ErrBlockNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return types.DeserializeBlockHeader(value), nil
+}
+
+// PutNewLastBlock adds writing a new Block, its header, its height index entry and the new last hash value to a Batch
+func (db *ChainDB) PutNewLastBlock(batch Batch, newBlock *types.Block) {
+	batch.Put(newBlock.Hash, byteutil.Serialize(newBlock))
+	batch.Put(headerKey(newBlock.Hash), byteutil.Serialize(newBlock.Header()))
+	batch.Put(heightKey(newBlock.Index), newBlock.Hash)
+	batch.Put([]byte(LastHashKey), newBlock.Hash)
+}
+
+// PutHeader adds writing the BlockHeader of a Block without its data and its height index entry to a Batch
+func (db *ChainDB) PutHeader(batch Batch, header *types.BlockHeader) {
+	batch.Put(headerKey(header.Hash), byteutil.Serialize(header))
+	batch.Put(heightKey(header.Index), header.Hash)
+}
+
+// PutLastHash adds setting the hash of the most recent Block to a Batch
+func (db *ChainDB) PutLastHash(batch Batch, hash []byte) {
+	batch.Put([]byte(LastHashKey), hash)
+}
+
+// ReadUTXOBestHash gets the hash of the most recent Block whose changes are in the UTXO set, or ErrNotFound
+func (db *ChainDB) ReadUTXOBestHash() ([]byte, error) {
+	return db.Store.Get([]byte(UTXOBestKey))
+}
+
+// PutUTXOBestHash adds setting the hash of the most recent Block whose changes are in the UTXO set to a Batch
+func (db *ChainDB) PutUTXOBestHash(batch Batch, hash []byte) {
+	batch.Put([]byte(UTXOBestKey), hash)
+}
+
+// ReadHashWithHeight gets the hash of the Block at a given height of the active chain
+func (db *ChainDB) ReadHashWithHeight(height int) ([]byte, error) {
+	hash, err := db.Store.Get(heightKey(height))
+	if err == ErrNotFound {
+		return nil, ErrHeightNotFound
+	}
+
+	return hash, err
+}
+
+// WriteHeightIndex maps a given height of the active chain to the hash of the Block at that height
+func (db *ChainDB) WriteHeightIndex(height int, hash []byte) {
+	err := db.Store.Put(heightKey(height), hash)
 	errutil.Handle(err)
+}
 
-	return
+// DeleteWithKeyPrefix deletes all data whose key is prefixed by a given value, in batches of deleteBatchSize
+func (db *ChainDB) DeleteWithKeyPrefix(prefix []byte) {
+	db.deleteKeys(db.keysWithPrefix(prefix))
 }
 
-// ReadBlockWithHash gets a Block from the database, given it's hash
-func (db *ChainDB) ReadBlockWithHash(hash []byte) (resBlock *types.Block) {
-	err := db.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(hash))
-		errutil.Handle(err)
+// DeleteChain deletes all data but the schema version, leaving the database as a new one - for undoing a chain that
+// could not be written in full
+func (db *ChainDB) DeleteChain() {
+	var keys [][]byte
+	for _, key := range db.keysWithPrefix(nil) {
+		if string(key) != SchemaVersionKey {
+			keys = append(keys, key)
+		}
+	}
+
+	db.deleteKeys(keys)
+}
 
-		value, err := item.Value()
-		resBlock = types.DeserializeBlock(value)
+// deleteKeys deletes the data of keys, in batches of deleteBatchSize
+func (db *ChainDB) deleteKeys(keys [][]byte) {
+	batch := db.Store.NewBatch()
+	for _, key := range keys {
+		batch.Delete(key)
+		if batch.Len() == deleteBatchSize {
+			err := batch.Write()
+			errutil.Handle(err)
+			batch.Reset()
+		}
+	}
 
-		return err
-	})
+	err := batch.Write()
 	errutil.Handle(err)
+}
 
-	return
+// PutDeleteWithKeyPrefix adds deleting all data whose key is prefixed by a given value to a Batch
+func (db *ChainDB) PutDeleteWithKeyPrefix(batch Batch, prefix []byte) {
+	for _, key := range db.keysWithPrefix(prefix) {
+		batch.Delete(key)
+	}
 }
 
-// WriteNewLastBlock writes a new Block into the database and updates the last hash value
-func (db *ChainDB) WriteNewLastBlock(newBlock *types.Block) {
-	err := db.Database.Update(func(txn *badger.Txn) error {
-		err := txn.Set(newBlock.Hash, byteutil.Serialize(newBlock))
-		errutil.Handle(err)
+// keysWithPrefix collects all keys prefixed by a given value
+func (db *ChainDB) keysWithPrefix(prefix []byte) [][]byte {
+	var keys [][]byte
 
-		err = txn.Set([]byte(LastHashKey), newBlock.Hash)
-		return err
+	err := db.Store.Iterate(prefix, func(key, _ []byte) error {
+		keys = append(keys, copyBytes(key))
+		return nil
 	})
-
 	errutil.Handle(err)
+
+	return keys
 }
 
-// CloseDB closes the badgerdb
+// CloseDB closes the underlying Store and releases the lock on the chain directory
 func (db *ChainDB) CloseDB() {
-	db.Database.Close()
+	db.Store.Close()
+	if db.lock != nil {
+		db.lock.Release()
+	}
+}
+
+// headerKey creates the db key for the BlockHeader of the Block with a given hash
+func headerKey(hash []byte) []byte {
+	return append(append([]byte{}, headerPrefix...), hash...)
+}
+
+// heightKey creates the db key for the height index entry of a given height
+func heightKey(height int) []byte {
+	return append(append([]byte{}, heightPrefix...), hexutil.ToHex(int64(height))...)
 }
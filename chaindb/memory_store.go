@@ -0,0 +1,171 @@
+package chaindb
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memoryStore is a Store that keeps everything in memory, mainly for tests and throwaway chains
+type memoryStore struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// memorySnapshot is a Snapshot holding a copy of the data of a memoryStore
+type memorySnapshot struct {
+	data map[string][]byte
+}
+
+// NewMemoryStore creates an empty in-memory Store
+func NewMemoryStore() Store {
+	return &memoryStore{data: make(map[string][]byte)}
+}
+
+// Get retrieves the value of a key
+func (s *memoryStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return memoryGet(s.data, key)
+}
+
+// Has determines whether a key exists
+func (s *memoryStore) Has(key []byte) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.data[string(key)]
+	return exists, nil
+}
+
+// Iterate calls fn in key order for each key starting with prefix -
+// fn sees the data as it was when Iterate was called, so it may write to the Store
+func (s *memoryStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	s.mu.RLock()
+	keys := memoryKeys(s.data, prefix)
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = s.data[key]
+	}
+	s.mu.RUnlock()
+
+	for i, key := range keys {
+		if err := fn([]byte(key), copyBytes(values[i])); err == ErrStopIteration {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Put sets the value of a key
+func (s *memoryStore) Put(key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+// Delete removes a key
+func (s *memoryStore) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data, string(key))
+	return nil
+}
+
+// NewBatch creates a Batch applied while holding the write lock
+func (s *memoryStore) NewBatch() Batch {
+	return &batch{apply: func(ops []batchOp) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for _, op := range ops {
+			if op.value == nil {
+				delete(s.data, string(op.key))
+			} else {
+				s.data[string(op.key)] = op.value
+			}
+		}
+		return nil
+	}}
+}
+
+// Snapshot creates a copy of the data
+func (s *memoryStore) Snapshot() (Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data := make(map[string][]byte, len(s.data))
+	for key, value := range s.data {
+		data[key] = value // values are never modified in place
+	}
+
+	return &memorySnapshot{data}, nil
+}
+
+// Close drops the data
+func (s *memoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data = make(map[string][]byte)
+	return nil
+}
+
+// Get retrieves the value of a key
+func (snap *memorySnapshot) Get(key []byte) ([]byte, error) {
+	return memoryGet(snap.data, key)
+}
+
+// Has determines whether a key exists
+func (snap *memorySnapshot) Has(key []byte) (bool, error) {
+	_, exists := snap.data[string(key)]
+	return exists, nil
+}
+
+// Iterate calls fn in key order for each key starting with prefix
+func (snap *memorySnapshot) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	for _, key := range memoryKeys(snap.data, prefix) {
+		if err := fn([]byte(key), copyBytes(snap.data[key])); err == ErrStopIteration {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Release drops the copied data
+func (snap *memorySnapshot) Release() {
+	snap.data = nil
+}
+
+// memoryGet retrieves a copy of the value of a key
+func memoryGet(data map[string][]byte, key []byte) ([]byte, error) {
+	value, exists := data[string(key)]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	return copyBytes(value), nil
+}
+
+// memoryKeys gets the sorted keys starting with prefix
+func memoryKeys(data map[string][]byte, prefix []byte) []string {
+	var keys []string
+	for key := range data {
+		if strings.HasPrefix(key, string(prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
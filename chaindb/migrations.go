@@ -0,0 +1,179 @@
+package chaindb
+
+// Upgrade steps between schema versions, oldest first
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/danitello/go-blockchain/common/byteutil"
+	"github.com/danitello/go-blockchain/core/types"
+)
+
+// migrations are all Migrations in order of Version, the last one determines SchemaVersion
+var migrations = []Migration{
+	{1, "index block hashes by height", migrateHeightIndex},
+	{2, "key utxos by their idx in the transaction", migrateUTXOIndexes},
+	{3, "store block headers separately", migrateBlockHeaders},
+	{4, "track utxo set stats", migrateUTXOStats},
+	{5, "move signatures to transaction witnesses", migrateWitnesses},
+}
+
+// legacyBlock is a Block as stored before TxWitnesses, with the signature of each txin in the txin
+type legacyBlock struct {
+	Index        int
+	Nonce        int
+	Difficulty   int
+	Hash         []byte
+	PrevHash     []byte
+	TimeStamp    []byte
+	Transactions []*legacyTransaction
+}
+
+// legacyTransaction is a Transaction as stored before TxWitnesses
+type legacyTransaction struct {
+	ID      []byte
+	Inputs  []legacyTxInput
+	Outputs []types.TxOutput
+}
+
+// legacyTxInput is a TxInput as stored before TxWitnesses, with its signature
+type legacyTxInput struct {
+	TxID      []byte
+	OutputIdx int
+	Signature []byte
+	PubKey    []byte
+}
+
+// migrateHeightIndex builds the height index by walking back from the last Block
+func migrateHeightIndex(db *ChainDB, progress func(done, total int)) error {
+	hash := db.ReadLastHash()
+	batch := db.Store.NewBatch()
+	total := -1
+
+	for len(hash) > 0 {
+		value, err := db.Store.Get(hash)
+		if err != nil {
+			return err
+		}
+		block := types.DeserializeBlock(value)
+		if total < 0 {
+			total = block.Index + 1
+		}
+
+		batch.Put(heightKey(block.Index), block.Hash)
+		progress(total-block.Index, total)
+
+		hash = block.PrevHash
+	}
+
+	return batch.Write()
+}
+
+// migrateUTXOIndexes drops the UTXO set, whose entries lost the idx of each txo -
+// without a UTXOBestKey it is rebuilt from the Blocks when the BlockChain is opened
+func migrateUTXOIndexes(db *ChainDB, progress func(done, total int)) error {
+	batch := db.Store.NewBatch()
+	db.PutDeleteWithKeyPrefix(batch, UTXOPrefix)
+	batch.Delete([]byte(UTXOBestKey))
+	progress(1, 1)
+
+	return batch.Write()
+}
+
+// migrateBlockHeaders writes the BlockHeader of every Block, which is all that is kept of pruned Blocks
+func migrateBlockHeaders(db *ChainDB, progress func(done, total int)) error {
+	hash := db.ReadLastHash()
+	batch := db.Store.NewBatch()
+	total := -1
+
+	for len(hash) > 0 {
+		value, err := db.Store.Get(hash)
+		if err != nil {
+			return err
+		}
+		block := types.DeserializeBlock(value)
+		if total < 0 {
+			total = block.Index + 1
+		}
+
+		batch.Put(headerKey(block.Hash), byteutil.Serialize(block.Header()))
+		progress(total-block.Index, total)
+
+		hash = block.PrevHash
+	}
+
+	return batch.Write()
+}
+
+// migrateUTXOStats computes the UTXOStats of the existing UTXO set, which are updated along with it from now on
+func migrateUTXOStats(db *ChainDB, progress func(done, total int)) error {
+	stats, err := db.ComputeUTXOStats()
+	if err != nil {
+		return err
+	}
+
+	batch := db.Store.NewBatch()
+	db.PutUTXOStats(batch, stats)
+	progress(1, 1)
+
+	return batch.Write()
+}
+
+// migrateWitnesses rewrites every Block that isn't pruned with the signatures of its Transactions in their
+// TxWitnesses - they are legacy Blocks, whose proof covers the signatures where they were
+func migrateWitnesses(db *ChainDB, progress func(done, total int)) error {
+	hash := db.ReadLastHash()
+	batch := db.Store.NewBatch()
+	total := -1
+
+	for len(hash) > 0 {
+		header, err := db.ReadHeaderWithHash(hash)
+		if err != nil {
+			return err
+		}
+		if total < 0 {
+			total = header.Index + 1
+		}
+
+		value, err := db.Store.Get(hash)
+		if err == nil {
+			var legacy legacyBlock
+			if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&legacy); err != nil {
+				return err
+			}
+			block := legacy.upgrade()
+			batch.Put(hash, byteutil.Serialize(block))
+		} else if err != ErrNotFound {
+			return err
+		}
+		progress(total-header.Index, total)
+
+		hash = header.PrevHash
+	}
+
+	return batch.Write()
+}
+
+// upgrade converts a legacyBlock to a Block of LegacyBlockVersion
+func (legacy *legacyBlock) upgrade() *types.Block {
+	block := &types.Block{
+		Version:    types.LegacyBlockVersion,
+		Index:      legacy.Index,
+		Nonce:      legacy.Nonce,
+		Difficulty: legacy.Difficulty,
+		Hash:       legacy.Hash,
+		PrevHash:   legacy.PrevHash,
+		TimeStamp:  legacy.TimeStamp}
+
+	for _, legacyTx := range legacy.Transactions {
+		tx := &types.Transaction{ID: legacyTx.ID, Outputs: legacyTx.Outputs}
+		for _, txin := range legacyTx.Inputs {
+			tx.Inputs = append(tx.Inputs, types.TxInput{TxID: txin.TxID, OutputIdx: txin.OutputIdx, PubKey: txin.PubKey})
+			tx.Witnesses = append(tx.Witnesses, types.TxWitness{Signature: txin.Signature})
+		}
+		block.Transactions = append(block.Transactions, tx)
+	}
+
+	return block
+}
@@ -0,0 +1,38 @@
+package chaindb
+
+import (
+	"testing"
+
+	"github.com/danitello/go-blockchain/common/byteutil"
+	"github.com/danitello/go-blockchain/core/types"
+)
+
+// listTxOutputs is TxOutputs as stored before schema version 2, a list that loses the idx of each txo once an earlier
+// one is spent
+type listTxOutputs struct {
+	Outputs []types.TxOutput
+}
+
+// TestMigrateUTXOIndexes checks that UTXO entries of the list format are dropped along with the marker of the Block
+// they are at, so the UTXO set is rebuilt from the Blocks in the format keyed by idx
+func TestMigrateUTXOIndexes(t *testing.T) {
+	db := &ChainDB{Store: NewMemoryStore()}
+	txos := listTxOutputs{[]types.TxOutput{{Amount: 30, PubKeyHash: []byte{1}}}}
+	for _, txID := range []string{"a", "b"} {
+		if err := db.Store.Put(append(UTXOPrefix, txID...), byteutil.Serialize(txos)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Store.Put([]byte(UTXOBestKey), []byte("hash"))
+	db.Store.Put([]byte(LastHashKey), []byte("hash"))
+
+	if err := migrations[1].Migrate(db, func(done, total int) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := iterateKeys(t, db.Store, string(UTXOPrefix)); len(keys) != 0 {
+		t.Errorf("got UTXO entries %q after the migration", keys)
+	}
+	expectValue(t, db.Store, UTXOBestKey, nil)
+	expectValue(t, db.Store, LastHashKey, []byte("hash"))
+}
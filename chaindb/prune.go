@@ -0,0 +1,56 @@
+package chaindb
+
+// Database interfacing for pruning the data of old Blocks
+
+import (
+	"encoding/binary"
+
+	"github.com/danitello/go-blockchain/common/errutil"
+)
+
+// ReadPrunedHeight gets the height up to which the data of Blocks has been deleted, or -1 if nothing was pruned
+func (db *ChainDB) ReadPrunedHeight() int {
+	value, err := db.Store.Get([]byte(PrunedHeightKey))
+	if err == ErrNotFound {
+		return -1
+	}
+	errutil.Handle(err)
+
+	return int(int64(binary.BigEndian.Uint64(value)))
+}
+
+// IsPruned determines whether the data of any Block has been deleted
+func (db *ChainDB) IsPruned() bool {
+	return db.ReadPrunedHeight() >= 0
+}
+
+// PruneBlocks deletes the data of the Blocks of the active chain up to a given height, keeping their headers -
+// returns the number of Blocks pruned
+func (db *ChainDB) PruneBlocks(height int) int {
+	prunedHeight := db.ReadPrunedHeight()
+	if height <= prunedHeight {
+		return 0
+	}
+
+	batch := db.Store.NewBatch()
+	for h := prunedHeight + 1; h <= height; h++ {
+		hash, err := db.ReadHashWithHeight(h)
+		errutil.Handle(err)
+
+		batch.Delete(hash)
+	}
+
+	db.PutPrunedHeight(batch, height)
+
+	err := batch.Write()
+	errutil.Handle(err)
+
+	return height - prunedHeight
+}
+
+// PutPrunedHeight adds setting the height up to which the data of Blocks has been deleted to a Batch
+func (db *ChainDB) PutPrunedHeight(batch Batch, height int) {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(height))
+	batch.Put([]byte(PrunedHeightKey), value)
+}
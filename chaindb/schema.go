@@ -0,0 +1,101 @@
+package chaindb
+
+// Versioning of the format of the data in the database
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// SchemaVersionKey is the db key -> value is the version of the format of the data in the db
+	SchemaVersionKey = "schemaVersionKey"
+)
+
+// Migration upgrades the data in a ChainDB to Version from the version before it -
+// Version - the schema version after the Migration
+// Description - what the Migration changes
+// Migrate - performs the upgrade, reporting how many of the total units of work are done along the way
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(db *ChainDB, progress func(done, total int)) error
+}
+
+// SchemaVersion is the version of the format of the data written by this code
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// ReadSchemaVersion gets the version of the format of the data in the database -
+// a database with a chain but no version predates versioning and is version 0
+func (db *ChainDB) ReadSchemaVersion() (int, error) {
+	value, err := db.Store.Get([]byte(SchemaVersionKey))
+	if err == ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if len(value) != 4 {
+		return 0, fmt.Errorf("Invalid database schema version %x", value)
+	}
+
+	return int(binary.BigEndian.Uint32(value)), nil
+}
+
+// upgradeSchema brings the data in the database to SchemaVersion, running each pending Migration in order -
+// a database without a chain is stamped with SchemaVersion, and one from a newer version is refused
+func (db *ChainDB) upgradeSchema(progress func(migration Migration, done, total int)) error {
+	version, err := db.ReadSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion() {
+		return fmt.Errorf("Database schema version %d is newer than the supported version %d, upgrade to open it", version, SchemaVersion())
+	}
+
+	// There is no data to migrate, and the chain made next is written in the current format
+	if !db.HasChain() {
+		if version == SchemaVersion() {
+			return nil
+		}
+		return db.writeSchemaVersion(SchemaVersion())
+	}
+
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		m := migration
+		err := m.Migrate(db, func(done, total int) {
+			progress(m, done, total)
+		})
+		if err != nil {
+			return fmt.Errorf("Migration to schema version %d failed: %s", m.Version, err)
+		}
+
+		// Each completed Migration is recorded so an interruption resumes from the next one
+		if err := db.writeSchemaVersion(m.Version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeSchemaVersion sets the version of the format of the data in the database
+func (db *ChainDB) writeSchemaVersion(version int) error {
+	value := make([]byte, 4)
+	binary.BigEndian.PutUint32(value, uint32(version))
+
+	return db.Store.Put([]byte(SchemaVersionKey), value)
+}
+
+// printMigrationProgress reports the progress of a Migration to the terminal
+func printMigrationProgress(migration Migration, done, total int) {
+	fmt.Printf("\rMigrating database to schema version %d (%s): %d/%d", migration.Version, migration.Description, done, total)
+	if done == total {
+		fmt.Println()
+	}
+}
@@ -0,0 +1,52 @@
+package chaindb
+
+import (
+	"testing"
+)
+
+// TestUpgradeSchema checks the version a database is left at, and that a newer or unreadable version is refused
+// whether or not the database has a chain
+func TestUpgradeSchema(t *testing.T) {
+	newer := make([]byte, 4)
+	newer[3] = byte(SchemaVersion() + 1)
+
+	for _, test := range []struct {
+		name    string
+		chain   bool
+		version []byte
+		fails   bool
+	}{
+		{"new database", false, nil, false},
+		{"database stamped with an older version and no chain", false, []byte{0, 0, 0, 1}, false},
+		{"database of the current version", true, []byte{0, 0, 0, byte(SchemaVersion())}, false},
+		{"database of a newer version and no chain", false, newer, true},
+		{"database of a newer version", true, newer, true},
+		{"version of the wrong length and no chain", false, []byte{0, 0, 1}, true},
+		{"version of the wrong length", true, []byte{0, 0, 0, 0, 1}, true},
+	} {
+		db := &ChainDB{Store: NewMemoryStore()}
+		if test.chain {
+			db.Store.Put([]byte(LastHashKey), []byte("hash"))
+		}
+		if test.version != nil {
+			db.Store.Put([]byte(SchemaVersionKey), test.version)
+		}
+
+		err := db.upgradeSchema(func(migration Migration, done, total int) {
+			t.Errorf("%s: ran migration %d", test.name, migration.Version)
+		})
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: opened", test.name)
+			}
+			expectValue(t, db.Store, SchemaVersionKey, test.version)
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+		if version, err := db.ReadSchemaVersion(); err != nil || version != SchemaVersion() {
+			t.Errorf("%s: got schema version %d, %v, want %d", test.name, version, err, SchemaVersion())
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package chaindb
+
+// Storage backends for a ChainDB
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// BadgerBackend stores data with badgerdb
+	BadgerBackend = "badger"
+	// BoltBackend stores data with bbolt
+	BoltBackend = "bolt"
+	// MemoryBackend stores data in memory only (nothing is persisted)
+	MemoryBackend = "memory"
+)
+
+var (
+	// ErrNotFound is returned when a key does not exist in a Store
+	ErrNotFound = errors.New("Key not found")
+
+	// ErrStopIteration can be returned by the function passed to Iterate to end the iteration early without an error
+	ErrStopIteration = errors.New("Stop iteration")
+)
+
+// Reader is the read access shared by a Store and its Snapshots
+type Reader interface {
+	// Get retrieves the value of a key, or ErrNotFound
+	Get(key []byte) ([]byte, error)
+
+	// Has determines whether a key exists
+	Has(key []byte) (bool, error)
+
+	// Iterate calls fn in key order for each key starting with prefix -
+	// key and value are only valid until fn returns
+	Iterate(prefix []byte, fn func(key, value []byte) error) error
+}
+
+// Store is a key/value storage backend
+type Store interface {
+	Reader
+
+	// Put sets the value of a key
+	Put(key, value []byte) error
+
+	// Delete removes a key, deleting a missing key is not an error
+	Delete(key []byte) error
+
+	// NewBatch creates a Batch whose writes are applied atomically
+	NewBatch() Batch
+
+	// Snapshot creates a consistent read-only view of the Store that later writes don't affect - with bolt, a write
+	// that grows the file past its memory map waits until every Snapshot is released, so one mustn't be held across
+	// writes to a large Store
+	Snapshot() (Snapshot, error)
+
+	// Close releases the Store
+	Close() error
+}
+
+// Snapshot is a consistent read-only view of a Store
+type Snapshot interface {
+	Reader
+
+	// Release frees the resources held by the Snapshot
+	Release()
+}
+
+// Batch collects writes to be applied to a Store in one atomic operation
+type Batch interface {
+	// Put sets the value of a key when the Batch is written
+	Put(key, value []byte)
+
+	// Delete removes a key when the Batch is written
+	Delete(key []byte)
+
+	// Len is the number of writes in the Batch
+	Len() int
+
+	// Write applies all writes in the Batch atomically - after a crash either all or none of them are in the Store once
+	// it is opened again, though readers of a badger Store may see a Batch too big for one transaction partly applied
+	Write() error
+
+	// Reset discards all writes in the Batch so it can be reused
+	Reset()
+}
+
+// OpenStore opens the Store of a given backend from the specified directory
+func OpenStore(backend, dir string) (Store, error) {
+	switch backend {
+	case BadgerBackend:
+		return OpenBadgerStore(dir)
+	case BoltBackend:
+		return OpenBoltStore(dir)
+	case MemoryBackend:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("Unknown storage backend %q", backend)
+	}
+}
+
+// batchOp is a single write of a batch, a nil value means delete
+type batchOp struct {
+	key   []byte
+	value []byte
+}
+
+// batch is the Batch implementation shared by all backends, which only differ in how the ops are applied
+type batch struct {
+	ops   []batchOp
+	apply func(ops []batchOp) error
+}
+
+// Put sets the value of a key when the batch is written
+func (b *batch) Put(key, value []byte) {
+	if value == nil {
+		value = []byte{}
+	}
+	b.ops = append(b.ops, batchOp{copyBytes(key), copyBytes(value)})
+}
+
+// Delete removes a key when the batch is written
+func (b *batch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{copyBytes(key), nil})
+}
+
+// Len is the number of writes in the batch
+func (b *batch) Len() int {
+	return len(b.ops)
+}
+
+// Write applies all writes in the batch atomically
+func (b *batch) Write() error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+	return b.apply(b.ops)
+}
+
+// Reset discards all writes in the batch
+func (b *batch) Reset() {
+	b.ops = nil
+}
+
+// copyBytes makes a copy of a []byte that is safe to keep
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
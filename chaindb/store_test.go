@@ -0,0 +1,341 @@
+package chaindb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// withEachStore runs a test against a new Store of every backend
+func withEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	for _, backend := range []string{BadgerBackend, BoltBackend, MemoryBackend} {
+		t.Run(backend, func(t *testing.T) {
+			s, err := OpenStore(backend, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			test(t, s)
+		})
+	}
+}
+
+// iterateKeys collects the keys starting with prefix in the order Iterate gives them
+func iterateKeys(t *testing.T, r Reader, prefix string) []string {
+	var keys []string
+	err := r.Iterate([]byte(prefix), func(key, _ []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys
+}
+
+// expectValue fails the test unless a key has a value, or is missing if value is nil
+func expectValue(t *testing.T, r Reader, key string, value []byte) {
+	t.Helper()
+
+	got, err := r.Get([]byte(key))
+	has, hasErr := r.Has([]byte(key))
+	if hasErr != nil {
+		t.Fatal(hasErr)
+	}
+	if value == nil {
+		if err != ErrNotFound || has {
+			t.Fatalf("%s: got %q, %v, has %v, want ErrNotFound", key, got, err, has)
+		}
+		return
+	}
+	if err != nil || !has || !bytes.Equal(got, value) {
+		t.Fatalf("%s: got %q, %v, has %v, want %q", key, got, err, has, value)
+	}
+}
+
+func TestStoreGetPutDelete(t *testing.T) {
+	withEachStore(t, func(t *testing.T, s Store) {
+		expectValue(t, s, "a", nil)
+
+		key, value := []byte("a"), []byte("1")
+		if err := s.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+		// The Store keeps its own copies
+		key[0], value[0] = 'x', 'x'
+		expectValue(t, s, "a", []byte("1"))
+
+		if err := s.Put([]byte("empty"), []byte{}); err != nil {
+			t.Fatal(err)
+		}
+		expectValue(t, s, "empty", []byte{})
+
+		if err := s.Put([]byte("a"), []byte("2")); err != nil {
+			t.Fatal(err)
+		}
+		expectValue(t, s, "a", []byte("2"))
+
+		if err := s.Delete([]byte("a")); err != nil {
+			t.Fatal(err)
+		}
+		expectValue(t, s, "a", nil)
+		if err := s.Delete([]byte("missing")); err != nil {
+			t.Fatalf("deleting a missing key: %v", err)
+		}
+	})
+}
+
+func TestStoreIterate(t *testing.T) {
+	withEachStore(t, func(t *testing.T, s Store) {
+		for _, key := range []string{"p-c", "o-a", "p-a", "p-\x00", "q-a", "p-b", "p-ab", "p"} {
+			if err := s.Put([]byte(key), []byte("v-"+key)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		want := []string{"p-\x00", "p-a", "p-ab", "p-b", "p-c"}
+		if got := iterateKeys(t, s, "p-"); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+		if got := iterateKeys(t, s, "none"); len(got) != 0 {
+			t.Fatalf("got %q for a prefix without keys", got)
+		}
+		if got := iterateKeys(t, s, ""); len(got) != 8 {
+			t.Fatalf("got %d keys for the empty prefix, want 8", len(got))
+		}
+
+		err := s.Iterate([]byte("p-"), func(key, value []byte) error {
+			if !bytes.Equal(value, append([]byte("v-"), key...)) {
+				t.Fatalf("%q has value %q", key, value)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var seen int
+		err = s.Iterate([]byte("p-"), func(_, _ []byte) error {
+			seen++
+			if seen == 2 {
+				return ErrStopIteration
+			}
+			return nil
+		})
+		if err != nil || seen != 2 {
+			t.Fatalf("ErrStopIteration: got %v after %d keys", err, seen)
+		}
+
+		errFailed := errors.New("failed")
+		if err := s.Iterate([]byte("p-"), func(_, _ []byte) error { return errFailed }); err != errFailed {
+			t.Fatalf("got %v, want the error of fn", err)
+		}
+	})
+}
+
+func TestStoreBatch(t *testing.T) {
+	withEachStore(t, func(t *testing.T, s Store) {
+		if err := s.Put([]byte("old"), []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+
+		b := s.NewBatch()
+		if err := b.Write(); err != nil {
+			t.Fatalf("writing an empty batch: %v", err)
+		}
+
+		key := []byte("a")
+		b.Put(key, []byte("1"))
+		key[0] = 'x'
+		b.Put([]byte("b"), []byte("1"))
+		b.Delete([]byte("b"))
+		b.Delete([]byte("c"))
+		b.Put([]byte("c"), []byte("2"))
+		b.Delete([]byte("old"))
+		b.Put([]byte("nil"), nil)
+		if b.Len() != 7 {
+			t.Fatalf("got Len %d, want 7", b.Len())
+		}
+
+		// Nothing is applied before Write
+		expectValue(t, s, "a", nil)
+		expectValue(t, s, "old", []byte("1"))
+
+		if err := b.Write(); err != nil {
+			t.Fatal(err)
+		}
+		// Later writes to the same key win
+		expectValue(t, s, "a", []byte("1"))
+		expectValue(t, s, "b", nil)
+		expectValue(t, s, "c", []byte("2"))
+		expectValue(t, s, "old", nil)
+		expectValue(t, s, "nil", []byte{})
+		expectValue(t, s, "x", nil)
+
+		b.Reset()
+		if b.Len() != 0 {
+			t.Fatalf("got Len %d after Reset", b.Len())
+		}
+		b.Put([]byte("d"), []byte("3"))
+		if err := b.Write(); err != nil {
+			t.Fatal(err)
+		}
+		expectValue(t, s, "c", []byte("2"))
+		expectValue(t, s, "d", []byte("3"))
+	})
+}
+
+func TestStoreSnapshot(t *testing.T) {
+	withEachStore(t, func(t *testing.T, s Store) {
+		if err := s.Put([]byte("a"), []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+
+		snap, err := s.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer snap.Release()
+
+		b := s.NewBatch()
+		b.Put([]byte("a"), []byte("2"))
+		b.Put([]byte("b"), []byte("2"))
+		if err := b.Write(); err != nil {
+			t.Fatal(err)
+		}
+
+		expectValue(t, snap, "a", []byte("1"))
+		expectValue(t, snap, "b", nil)
+		if got := iterateKeys(t, snap, ""); len(got) != 1 {
+			t.Fatalf("snapshot iterates %q", got)
+		}
+		expectValue(t, s, "a", []byte("2"))
+	})
+}
+
+func TestStorePersists(t *testing.T) {
+	for _, backend := range []string{BadgerBackend, BoltBackend} {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := OpenStore(backend, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := s.NewBatch()
+			b.Put([]byte("a"), []byte("1"))
+			b.Put([]byte("b"), []byte("2"))
+			b.Delete([]byte("b"))
+			if err := b.Write(); err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+
+			s, err = OpenStore(backend, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			expectValue(t, s, "a", []byte("1"))
+			expectValue(t, s, "b", nil)
+		})
+	}
+}
+
+// bigBatchOps makes more ops than fit in one transaction of a badgerdb Store
+func bigBatchOps(s *badgerStore) []batchOp {
+	ops := make([]batchOp, s.db.MaxBatchCount()+1000)
+	for i := range ops {
+		ops[i] = batchOp{[]byte(fmt.Sprintf("big-%07d", i)), []byte(fmt.Sprint(i))}
+	}
+
+	return ops
+}
+
+func TestBadgerBigBatch(t *testing.T) {
+	store, err := OpenBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	s := store.(*badgerStore)
+
+	ops := bigBatchOps(s)
+	b := s.NewBatch()
+	for _, op := range ops {
+		b.Put(op.key, op.value)
+	}
+	b.Delete([]byte("big-0000000"))
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := iterateKeys(t, s, "big-"); len(got) != len(ops)-1 || got[0] != "big-0000001" {
+		t.Fatalf("got %d keys from %q, want %d", len(got), got[0], len(ops)-1)
+	}
+	last := ops[len(ops)-1]
+	expectValue(t, s, string(last.key), last.value)
+	expectValue(t, s, batchJournalKey, nil)
+	if got := iterateKeys(t, s, string(batchJournalPrefix)); len(got) != 0 {
+		t.Fatalf("%d journal ops left", len(got))
+	}
+}
+
+func TestBadgerBatchRecovery(t *testing.T) {
+	for _, committed := range []bool{true, false} {
+		t.Run(fmt.Sprintf("committed=%v", committed), func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := OpenBadgerStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := store.(*badgerStore)
+			if err := s.Put([]byte("big-0000000"), []byte("old")); err != nil {
+				t.Fatal(err)
+			}
+
+			// A stop after journalling the ops, and after the marker if committed, before they are applied
+			ops := append(bigBatchOps(s)[1:], batchOp{[]byte("big-0000000"), nil})
+			journal := make([]batchOp, len(ops))
+			for i, op := range ops {
+				journal[i] = batchOp{batchJournalOpKey(i), encodeBatchOp(op)}
+			}
+			if err := s.applyChunked(journal); err != nil {
+				t.Fatal(err)
+			}
+			if committed {
+				count := make([]byte, 8)
+				binary.BigEndian.PutUint64(count, uint64(len(ops)))
+				if err := s.Put([]byte(batchJournalKey), count); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.Close()
+
+			reopened, err := OpenBadgerStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reopened.Close()
+
+			if committed {
+				expectValue(t, reopened, "big-0000000", nil)
+				if got := iterateKeys(t, reopened, "big-"); len(got) != len(ops)-1 {
+					t.Fatalf("got %d keys, want the whole batch", len(got))
+				}
+			} else {
+				expectValue(t, reopened, "big-0000000", []byte("old"))
+				if got := iterateKeys(t, reopened, "big-"); len(got) != 1 {
+					t.Fatalf("got %d keys, want none of the batch", len(got))
+				}
+			}
+			expectValue(t, reopened, batchJournalKey, nil)
+			if got := iterateKeys(t, reopened, string(batchJournalPrefix)); len(got) != 0 {
+				t.Fatalf("%d journal ops left", len(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package chaindb
+
+// Database interfacing for the running totals over the UTXO set
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/danitello/go-blockchain/common/byteutil"
+	"github.com/danitello/go-blockchain/common/errutil"
+	"github.com/danitello/go-blockchain/common/muhash"
+	"github.com/danitello/go-blockchain/core/types"
+)
+
+// UTXOStatsKey is the db key -> value is the UTXOStats of the UTXO set
+const UTXOStatsKey = "utxoStatsKey"
+
+// UTXOStats are running totals over the UTXO set, updated in the same Batch as it -
+// Hash - MuHash of the canonical encoding of every unspent txo
+// Outputs - number of unspent txos
+// Supply - sum of the amounts of unspent txos
+// Size - bytes taken by the canonical encoding of every unspent txo
+type UTXOStats struct {
+	Hash    *muhash.MuHash
+	Outputs int
+	Supply  int
+	Size    int
+}
+
+// NewUTXOStats creates the UTXOStats of an empty UTXO set
+func NewUTXOStats() *UTXOStats {
+	return &UTXOStats{Hash: muhash.New()}
+}
+
+// AddOutput counts a txo added to the UTXO set
+func (s *UTXOStats) AddOutput(txID []byte, idx int, txo types.TxOutput) {
+	element := utxoElement(txID, idx, txo)
+	s.Hash.Insert(element)
+	s.Outputs++
+	s.Supply += txo.Amount
+	s.Size += len(element)
+}
+
+// RemoveOutput counts a txo removed from the UTXO set
+func (s *UTXOStats) RemoveOutput(txID []byte, idx int, txo types.TxOutput) {
+	element := utxoElement(txID, idx, txo)
+	s.Hash.Remove(element)
+	s.Outputs--
+	s.Supply -= txo.Amount
+	s.Size -= len(element)
+}
+
+// ReadUTXOStats gets the UTXOStats of the UTXO set - a set without them is empty, as every other set has them
+func (db *ChainDB) ReadUTXOStats() *UTXOStats {
+	value, err := db.Store.Get([]byte(UTXOStatsKey))
+	if err == ErrNotFound {
+		return NewUTXOStats()
+	}
+	errutil.Handle(err)
+
+	var stats UTXOStats
+	err = gob.NewDecoder(bytes.NewReader(value)).Decode(&stats)
+	errutil.Handle(err)
+
+	return &stats
+}
+
+// PutUTXOStats adds setting the UTXOStats of the UTXO set to a Batch
+func (db *ChainDB) PutUTXOStats(batch Batch, stats *UTXOStats) {
+	batch.Put([]byte(UTXOStatsKey), byteutil.Serialize(stats))
+}
+
+// ComputeUTXOStats computes the UTXOStats of the UTXO set from its entries
+func (db *ChainDB) ComputeUTXOStats() (*UTXOStats, error) {
+	stats := NewUTXOStats()
+
+	err := db.Store.Iterate(UTXOPrefix, func(key, value []byte) error {
+		txID := key[len(UTXOPrefix):]
+		for idx, txo := range types.DeserializeTxOutputs(value).Outputs {
+			stats.AddOutput(txID, idx, txo)
+		}
+		return nil
+	})
+
+	return stats, err
+}
+
+// utxoElement is the canonical encoding of a txo in the UTXO set, which is what the Hash of UTXOStats is over
+func utxoElement(txID []byte, idx int, txo types.TxOutput) []byte {
+	var buf bytes.Buffer
+	err := types.EncodeUTXOEntry(&buf, txID, types.TxOutputs{Outputs: map[int]types.TxOutput{idx: txo}})
+	errutil.Handle(err)
+
+	return buf.Bytes()
+}
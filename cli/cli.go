@@ -1,88 +1,347 @@
 package cli
 
 import (
+	"bufio"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
 	"math"
 	"os"
+	"os/exec"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/danitello/go-blockchain/wallet"
 
+	"github.com/danitello/go-blockchain/chaindb"
 	"github.com/danitello/go-blockchain/common/errutil"
+	"github.com/danitello/go-blockchain/common/keys"
+	"github.com/danitello/go-blockchain/config"
 
 	"github.com/danitello/go-blockchain/core"
+	"github.com/danitello/go-blockchain/core/coinselect"
 	"github.com/danitello/go-blockchain/core/types"
 )
 
+// agentReady is printed by the agent of wallet-unlock once it holds the key
+const agentReady = "ready"
+
 // Run starts the cli and processes the args
 func Run() {
+	// Global options (preceding the command)
+	globalFlags := flag.NewFlagSet("main.go", flag.ExitOnError)
+	dataDir := globalFlags.String("datadir", config.DefaultDataDir, "The directory to keep chain and wallet data in.")
+	network := globalFlags.String("network", config.DefaultNetwork, "The network to use (mainnet, testnet, regtest).")
+	backend := globalFlags.String("backend", config.DefaultBackend, "The storage backend of the chain (badger, bolt).")
+	utxoCache := globalFlags.Int("utxocache", config.DefaultUTXOCacheSize, "Memory limit of the UTXO cache in MiB (0 writes UTXO changes right away).")
+	prune := globalFlags.Int("prune", 0, fmt.Sprintf("Keep the data of only this many recent blocks (0 keeps all, otherwise at least %d).", config.MinPruneDepth))
+	globalFlags.Parse(os.Args[1:])
+	args := globalFlags.Args()
+
 	// Check if there are args (first arg is the "main" subcommand)
-	if len(os.Args) < 2 {
+	if len(args) < 1 {
 		printHelp()
 		runtime.Goexit()
 	}
 
+	// Every command is its own process, so a memory store would start each one with an empty chain
+	if *backend == chaindb.MemoryBackend {
+		log.Panic("The memory backend keeps nothing between commands, use badger or bolt")
+	}
+	cfg, err := config.InitConfig(*dataDir, *network, *backend)
+	errutil.Handle(err)
+	err = cfg.SetPruneDepth(*prune)
+	errutil.Handle(err)
+	err = cfg.SetUTXOCacheSize(*utxoCache)
+	errutil.Handle(err)
+
 	// Commands
+	aggregatePubKeysCommand := flag.NewFlagSet("aggregate-pubkeys", flag.ExitOnError)
 	balanceCommand := flag.NewFlagSet("balance", flag.ExitOnError)
+	combinePartialCommand := flag.NewFlagSet("combine-partial", flag.ExitOnError)
+	createUnsignedCommand := flag.NewFlagSet("create-unsigned", flag.ExitOnError)
 	createWalletCommand := flag.NewFlagSet("create-wallet", flag.ExitOnError)
+	dumpUTXOCommand := flag.NewFlagSet("dump-utxo", flag.ExitOnError)
+	exportChainCommand := flag.NewFlagSet("export-chain", flag.ExitOnError)
+	exportKeyCommand := flag.NewFlagSet("export-key", flag.ExitOnError)
+	finalizeCommand := flag.NewFlagSet("finalize-and-broadcast", flag.ExitOnError)
+	importChainCommand := flag.NewFlagSet("import-chain", flag.ExitOnError)
+	importAddressCommand := flag.NewFlagSet("import-address", flag.ExitOnError)
+	importKeyCommand := flag.NewFlagSet("import-key", flag.ExitOnError)
+	importPubKeyCommand := flag.NewFlagSet("import-pubkey", flag.ExitOnError)
 	initChainCommand := flag.NewFlagSet("init-chain", flag.ExitOnError)
+	loadUTXOCommand := flag.NewFlagSet("load-utxo", flag.ExitOnError)
+	muSigCombineCommand := flag.NewFlagSet("musig-combine", flag.ExitOnError)
+	muSigNonceCommand := flag.NewFlagSet("musig-nonce", flag.ExitOnError)
+	muSigSignCommand := flag.NewFlagSet("musig-sign", flag.ExitOnError)
 	helpCommand := flag.NewFlagSet("help", flag.ExitOnError)
+	historyCommand := flag.NewFlagSet("history", flag.ExitOnError)
+	indexAddressesCommand := flag.NewFlagSet("index-addresses", flag.ExitOnError)
 	addressListCommand := flag.NewFlagSet("address-list", flag.ExitOnError)
 	printCommand := flag.NewFlagSet("print-chain", flag.ExitOnError)
+	printBlockCommand := flag.NewFlagSet("print-block", flag.ExitOnError)
 	reindexCommand := flag.NewFlagSet("reindex", flag.ExitOnError)
 	sendCommand := flag.NewFlagSet("send", flag.ExitOnError)
+	sendManyCommand := flag.NewFlagSet("send-many", flag.ExitOnError)
+	signOfflineCommand := flag.NewFlagSet("sign-offline", flag.ExitOnError)
+	utxoStatsCommand := flag.NewFlagSet("utxo-stats", flag.ExitOnError)
+	walletBalanceCommand := flag.NewFlagSet("wallet-balance", flag.ExitOnError)
+	walletChangePassphraseCommand := flag.NewFlagSet("wallet-change-passphrase", flag.ExitOnError)
+	walletEncryptCommand := flag.NewFlagSet("wallet-encrypt", flag.ExitOnError)
+	walletLockCommand := flag.NewFlagSet("wallet-lock", flag.ExitOnError)
+	walletRestoreCommand := flag.NewFlagSet("wallet-restore", flag.ExitOnError)
+	walletUnlockCommand := flag.NewFlagSet("wallet-unlock", flag.ExitOnError)
 
 	// Subcommands (pointers)
+	aggregatePubKeysPubKeys := aggregatePubKeysCommand.String("pubkeys", "", "(Required) The Schnorr public keys of the cosigners in hex, separated by commas.")
+	aggregatePubKeysWatch := aggregatePubKeysCommand.Bool("watch", false, "(Optional) Add the aggregated key to the wallet as watch-only.")
 	balanceAddress := balanceCommand.String("address", "", "(Required) The address to get balance of.")
+	createUnsignedFrom := createUnsignedCommand.String("from", "", "(Optional) The address to send from, any address of the wallet with a known public key if omitted.")
+	createUnsignedTo := createUnsignedCommand.String("to", "", "(Required unless -file) The address to send to.")
+	createUnsignedAmount := createUnsignedCommand.Int("amount", 0, "(Required unless -file) The amount to send.")
+	createUnsignedFile := createUnsignedCommand.String("file", "", "(Optional) A .json or .csv file of the addresses and amounts to send, instead of -to and -amount.")
+	createUnsignedChange := createUnsignedCommand.String("change", "", "(Optional) The address to send change to, by default -from or a new wallet address.")
+	createUnsignedPledge := createUnsignedCommand.Int("pledge", 0, "(Optional) Fund only this much of the payments with no change, to be signed with -sighash \"ALL|ANYONECANPAY\" and combined with other pledges.")
+	createUnsignedCoinSelection := createUnsignedCommand.String("coin-selection", coinselect.DefaultStrategy, fmt.Sprintf("How to choose the utxos to spend (%s).", strings.Join(coinselect.Names(), ", ")))
+	createUnsignedOut := createUnsignedCommand.String("out", "", "(Required) The file to write the unsigned transaction to.")
+	finalizeIn := finalizeCommand.String("in", "", "(Required) The signed transaction file.")
+	finalizeReward := finalizeCommand.String("reward", "", "(Optional) The address to pay the block reward to, by default a new wallet address.")
+	signOfflineIn := signOfflineCommand.String("in", "", "(Required) The transaction file to sign.")
+	signOfflineOut := signOfflineCommand.String("out", "", "(Optional) The file to write the signed transaction to, by default -in.")
+	signOfflineSigHash := signOfflineCommand.String("sighash", "", "(Optional) What the signatures cover - ALL, NONE or SINGLE, optionally with |ANYONECANPAY (default ALL).")
+	combinePartialIn := combinePartialCommand.String("in", "", "(Required) The transaction files paying the same outputs to combine the inputs of, separated by commas.")
+	combinePartialOut := combinePartialCommand.String("out", "", "(Required) The file to write the combined transaction to.")
+	createWalletAccount := createWalletCommand.Uint("account", uint(wallet.DefaultAccount), "(Optional) The account to derive the address in.")
+	createWalletChange := createWalletCommand.Bool("change", false, "(Optional) Derive an address for receiving change.")
+	createWalletSchnorr := createWalletCommand.Bool("schnorr", false, "(Optional) Give the address a Schnorr public key, spent with Schnorr signatures (secp256k1 seeds only).")
+	createWalletType := createWalletCommand.String("type", wallet.Base58Address.String(), "(Optional) The encoding of the address (base58, bech32).")
+	createWalletCurve := createWalletCommand.String("curve", "", fmt.Sprintf("(Optional) The curve of the keys of a new wallet seed (secp256k1, p256), %s by default.", keys.DefaultCurve))
+	dumpUTXOOut := dumpUTXOCommand.String("out", "", "(Required) The file to write the UTXO set to.")
+	exportChainOut := exportChainCommand.String("out", "", "(Required) The file to write the chain to.")
+	importChainIn := importChainCommand.String("in", "", "(Required) The chain file to read.")
+	exportKeyAddress := exportKeyCommand.String("address", "", "(Required) The address to export the key of.")
+	exportKeyPubKey := exportKeyCommand.Bool("pubkey", false, "(Optional) Export the public key in hex instead, for import-pubkey.")
+	importAddressAddress := importAddressCommand.String("address", "", "(Required) The address to watch.")
+	importAddressRescan := importAddressCommand.Bool("rescan", false, "(Optional) Scan the chain for payments to the address.")
+	importKeyKey := importKeyCommand.String("key", "", "(Required) The key to import, in WIF.")
+	importKeyRescan := importKeyCommand.Bool("rescan", false, "(Optional) Scan the chain for payments to the key.")
+	importPubKeyPubKey := importPubKeyCommand.String("pubkey", "", "(Required) The public key to watch, in hex.")
+	importPubKeyRescan := importPubKeyCommand.Bool("rescan", false, "(Optional) Scan the chain for payments to the key.")
+	historyAddress := historyCommand.String("address", "", "(Required) The address to get the history of.")
 	initChainCommandAddress := initChainCommand.String("address", "", "(Required) The address to init the chain with.")
-	sendCommandFrom := sendCommand.String("from", "", "(Required) The address to send from.")
+	loadUTXOIn := loadUTXOCommand.String("in", "", "(Required) The UTXO set file to read.")
+	muSigCombineIn := muSigCombineCommand.String("in", "", "(Required) The copies of a transaction the cosigners added nonces and partial signatures to, separated by commas.")
+	muSigCombineOut := muSigCombineCommand.String("out", "", "(Required) The file to write the combined transaction to.")
+	muSigNonceIn := muSigNonceCommand.String("in", "", "(Required) The transaction file to add nonces to.")
+	muSigNonceOut := muSigNonceCommand.String("out", "", "(Optional) The file to write the transaction to, by default -in.")
+	muSigNoncePubKeys := muSigNonceCommand.String("pubkeys", "", "(Optional) The Schnorr public keys of the cosigners in hex, separated by commas, to start signing the inputs locked with their aggregate.")
+	muSigSignIn := muSigSignCommand.String("in", "", "(Required) The transaction file with the nonces of every cosigner to sign.")
+	muSigSignOut := muSigSignCommand.String("out", "", "(Optional) The file to write the signed transaction to, by default -in.")
+	printBlockCommandHeight := printBlockCommand.Int("height", -1, "(Required) The height of the block to print.")
+	sendCommandFrom := sendCommand.String("from", "", "(Optional) The address to send from, any address of the wallet if omitted.")
 	sendCommandTo := sendCommand.String("to", "", "(Required) The address to send to.")
 	sendCommandAmount := sendCommand.String("amount", "", "(Required) The amount to send.")
+	sendCommandCoinSelection := sendCommand.String("coin-selection", coinselect.DefaultStrategy, fmt.Sprintf("How to choose the utxos to spend (%s).", strings.Join(coinselect.Names(), ", ")))
+	sendManyCommandFrom := sendManyCommand.String("from", "", "(Optional) The address to send from, any address of the wallet if omitted.")
+	sendManyCommandFile := sendManyCommand.String("file", "", "(Required) A .json or .csv file of the addresses and amounts to send.")
+	sendManyCommandCoinSelection := sendManyCommand.String("coin-selection", coinselect.DefaultStrategy, fmt.Sprintf("How to choose the utxos to spend (%s).", strings.Join(coinselect.Names(), ", ")))
+	walletRestoreMnemonic := walletRestoreCommand.String("mnemonic", "", "(Required) The words of the seed to restore, in quotes.")
+	walletRestoreCurve := walletRestoreCommand.String("curve", keys.DefaultCurve.String(), "(Optional) The curve of the keys of the seed (secp256k1, p256).")
+	walletUnlockTimeout := walletUnlockCommand.Int("timeout", 300, "(Optional) The number of seconds to keep the wallet unlocked.")
+	walletUnlockAgent := walletUnlockCommand.Bool("agent", false, "(Internal) Hold the key in this process, as started by wallet-unlock itself.")
 
 	// Parse relevant commands
-	switch os.Args[1] {
+	switch args[0] {
+	case "aggregate-pubkeys":
+		aggregatePubKeysCommand.Parse(args[1:])
 	case "balance":
-		balanceCommand.Parse(os.Args[2:])
+		balanceCommand.Parse(args[1:])
+	case "combine-partial":
+		combinePartialCommand.Parse(args[1:])
+	case "create-unsigned":
+		createUnsignedCommand.Parse(args[1:])
 	case "create-wallet":
-		createWalletCommand.Parse(os.Args[2:])
+		createWalletCommand.Parse(args[1:])
+	case "dump-utxo":
+		dumpUTXOCommand.Parse(args[1:])
+	case "export-chain":
+		exportChainCommand.Parse(args[1:])
+	case "import-chain":
+		importChainCommand.Parse(args[1:])
+	case "finalize-and-broadcast":
+		finalizeCommand.Parse(args[1:])
+	case "export-key":
+		exportKeyCommand.Parse(args[1:])
+	case "import-address":
+		importAddressCommand.Parse(args[1:])
+	case "import-key":
+		importKeyCommand.Parse(args[1:])
+	case "import-pubkey":
+		importPubKeyCommand.Parse(args[1:])
 	case "help":
-		helpCommand.Parse(os.Args[2:])
+		helpCommand.Parse(args[1:])
+	case "history":
+		historyCommand.Parse(args[1:])
+	case "index-addresses":
+		indexAddressesCommand.Parse(args[1:])
 	case "init-chain":
-		initChainCommand.Parse(os.Args[2:])
+		initChainCommand.Parse(args[1:])
+	case "load-utxo":
+		loadUTXOCommand.Parse(args[1:])
+	case "musig-combine":
+		muSigCombineCommand.Parse(args[1:])
+	case "musig-nonce":
+		muSigNonceCommand.Parse(args[1:])
+	case "musig-sign":
+		muSigSignCommand.Parse(args[1:])
 	case "address-list":
-		addressListCommand.Parse(os.Args[2:])
+		addressListCommand.Parse(args[1:])
 	case "print-chain":
-		printCommand.Parse(os.Args[2:])
+		printCommand.Parse(args[1:])
+	case "print-block":
+		printBlockCommand.Parse(args[1:])
 	case "reindex":
-		reindexCommand.Parse(os.Args[2:])
+		reindexCommand.Parse(args[1:])
 	case "send":
-		sendCommand.Parse(os.Args[2:])
+		sendCommand.Parse(args[1:])
+	case "send-many":
+		sendManyCommand.Parse(args[1:])
+	case "sign-offline":
+		signOfflineCommand.Parse(args[1:])
+	case "utxo-stats":
+		utxoStatsCommand.Parse(args[1:])
+	case "wallet-balance":
+		walletBalanceCommand.Parse(args[1:])
+	case "wallet-change-passphrase":
+		walletChangePassphraseCommand.Parse(args[1:])
+	case "wallet-encrypt":
+		walletEncryptCommand.Parse(args[1:])
+	case "wallet-lock":
+		walletLockCommand.Parse(args[1:])
+	case "wallet-restore":
+		walletRestoreCommand.Parse(args[1:])
+	case "wallet-unlock":
+		walletUnlockCommand.Parse(args[1:])
 	default:
 		printHelp()
 		runtime.Goexit()
 	}
 
 	// Check for and evaluate used commands
+	if aggregatePubKeysCommand.Parsed() {
+		if *aggregatePubKeysPubKeys == "" {
+			aggregatePubKeysCommand.Usage()
+			runtime.Goexit()
+		}
+
+		aggregatePubKeys(cfg, strings.Split(*aggregatePubKeysPubKeys, ","), *aggregatePubKeysWatch)
+	}
+
 	if balanceCommand.Parsed() {
 		if *balanceAddress == "" {
 			balanceCommand.Usage()
 			runtime.Goexit()
 		}
 
-		getBalance(*balanceAddress)
+		getBalance(cfg, *balanceAddress)
 	}
 
 	if createWalletCommand.Parsed() {
-		createWallet()
+		var curve keys.Curve
+		if *createWalletCurve != "" {
+			var err error
+			curve, err = keys.ParseCurve(*createWalletCurve)
+			errutil.Handle(err)
+		}
+		addressType, err := wallet.ParseAddressType(*createWalletType)
+		errutil.Handle(err)
+		createWallet(cfg, uint32(*createWalletAccount), *createWalletChange, curve, *createWalletSchnorr, addressType)
+	}
+
+	if dumpUTXOCommand.Parsed() {
+		if *dumpUTXOOut == "" {
+			dumpUTXOCommand.Usage()
+			runtime.Goexit()
+		}
+
+		dumpUTXO(cfg, *dumpUTXOOut)
+	}
+
+	if exportChainCommand.Parsed() {
+		if *exportChainOut == "" {
+			exportChainCommand.Usage()
+			runtime.Goexit()
+		}
+
+		exportChain(cfg, *exportChainOut)
+	}
+
+	if importChainCommand.Parsed() {
+		if *importChainIn == "" {
+			importChainCommand.Usage()
+			runtime.Goexit()
+		}
+
+		importChain(cfg, *importChainIn)
+	}
+
+	if exportKeyCommand.Parsed() {
+		if *exportKeyAddress == "" {
+			exportKeyCommand.Usage()
+			runtime.Goexit()
+		}
+
+		exportKey(cfg, *exportKeyAddress, *exportKeyPubKey)
+	}
+
+	if importKeyCommand.Parsed() {
+		if *importKeyKey == "" {
+			importKeyCommand.Usage()
+			runtime.Goexit()
+		}
+
+		importKey(cfg, *importKeyKey, *importKeyRescan)
+	}
+
+	if importAddressCommand.Parsed() {
+		if *importAddressAddress == "" {
+			importAddressCommand.Usage()
+			runtime.Goexit()
+		}
+
+		importAddress(cfg, *importAddressAddress, *importAddressRescan)
+	}
+
+	if importPubKeyCommand.Parsed() {
+		if *importPubKeyPubKey == "" {
+			importPubKeyCommand.Usage()
+			runtime.Goexit()
+		}
+
+		importPubKey(cfg, *importPubKeyPubKey, *importPubKeyRescan)
 	}
 
 	if helpCommand.Parsed() {
 		printHelp()
 	}
 
+	if historyCommand.Parsed() {
+		if *historyAddress == "" {
+			historyCommand.Usage()
+			runtime.Goexit()
+		}
+
+		getHistory(cfg, *historyAddress)
+	}
+
+	if indexAddressesCommand.Parsed() {
+		indexAddresses(cfg)
+	}
+
 	if initChainCommand.Parsed() {
 		if *initChainCommandAddress == "" {
 			initChainCommand.Usage()
@@ -90,25 +349,83 @@ func Run() {
 			runtime.Goexit() // Give badgerdb time to garbage collect
 		}
 
-		initChain(*initChainCommandAddress)
+		initChain(cfg, *initChainCommandAddress)
 
 	}
 
+	if loadUTXOCommand.Parsed() {
+		if *loadUTXOIn == "" {
+			loadUTXOCommand.Usage()
+			runtime.Goexit()
+		}
+
+		loadUTXO(cfg, *loadUTXOIn)
+	}
+
+	if muSigNonceCommand.Parsed() {
+		if *muSigNonceIn == "" {
+			muSigNonceCommand.Usage()
+			runtime.Goexit()
+		}
+
+		out := *muSigNonceOut
+		if out == "" {
+			out = *muSigNonceIn
+		}
+		var pubKeysHex []string
+		if *muSigNoncePubKeys != "" {
+			pubKeysHex = strings.Split(*muSigNoncePubKeys, ",")
+		}
+		muSigNonce(cfg, *muSigNonceIn, out, pubKeysHex)
+	}
+
+	if muSigSignCommand.Parsed() {
+		if *muSigSignIn == "" {
+			muSigSignCommand.Usage()
+			runtime.Goexit()
+		}
+
+		out := *muSigSignOut
+		if out == "" {
+			out = *muSigSignIn
+		}
+		muSigSign(cfg, *muSigSignIn, out)
+	}
+
+	if muSigCombineCommand.Parsed() {
+		if *muSigCombineIn == "" || *muSigCombineOut == "" {
+			muSigCombineCommand.Usage()
+			runtime.Goexit()
+		}
+
+		muSigCombine(strings.Split(*muSigCombineIn, ","), *muSigCombineOut)
+	}
+
 	if addressListCommand.Parsed() {
-		addressList()
+		addressList(cfg)
 	}
 
 	if printCommand.Parsed() {
-		printChain()
+		printChain(cfg)
+	}
+
+	if printBlockCommand.Parsed() {
+		if *printBlockCommandHeight < 0 {
+			printBlockCommand.Usage()
+			fmt.Println()
+			runtime.Goexit()
+		}
+
+		printBlockWithHeight(cfg, *printBlockCommandHeight)
 	}
 
 	if reindexCommand.Parsed() {
-		reindex()
+		reindex(cfg)
 	}
 
 	if sendCommand.Parsed() {
 		// Make sure the required input was submitted
-		if *sendCommandFrom == "" || *sendCommandTo == "" || *sendCommandAmount == "" {
+		if *sendCommandTo == "" || *sendCommandAmount == "" {
 			sendCommand.Usage()
 			fmt.Println()
 			runtime.Goexit()
@@ -116,28 +433,188 @@ func Run() {
 
 		amt, err := strconv.Atoi(*sendCommandAmount)
 		errutil.Handle(err)
-		send(*sendCommandFrom, *sendCommandTo, amt)
+		if amt <= 0 {
+			log.Panic("Amount must be positive")
+		}
+		selector, err := coinselect.GetSelector(*sendCommandCoinSelection)
+		errutil.Handle(err)
+		if *sendCommandFrom == "" {
+			sendFromWallet(cfg, []types.Payment{{Address: *sendCommandTo, Amount: amt}}, selector)
+		} else {
+			send(cfg, *sendCommandFrom, *sendCommandTo, amt, selector)
+		}
+	}
+
+	if sendManyCommand.Parsed() {
+		if *sendManyCommandFile == "" {
+			sendManyCommand.Usage()
+			fmt.Println()
+			runtime.Goexit()
+		}
+
+		payments, err := readPayments(*sendManyCommandFile, cfg.Params.Bech32HRP)
+		errutil.Handle(err)
+		selector, err := coinselect.GetSelector(*sendManyCommandCoinSelection)
+		errutil.Handle(err)
+		if *sendManyCommandFrom == "" {
+			sendFromWallet(cfg, payments, selector)
+		} else {
+			sendMany(cfg, *sendManyCommandFrom, payments, selector)
+		}
+	}
+
+	if createUnsignedCommand.Parsed() {
+		if *createUnsignedOut == "" || (*createUnsignedFile == "") == (*createUnsignedTo == "") {
+			createUnsignedCommand.Usage()
+			runtime.Goexit()
+		}
+
+		var payments []types.Payment
+		if *createUnsignedFile != "" {
+			var err error
+			payments, err = readPayments(*createUnsignedFile, cfg.Params.Bech32HRP)
+			errutil.Handle(err)
+		} else {
+			if !wallet.ValidateAddress(*createUnsignedTo, cfg.Params.Bech32HRP) {
+				log.Panic("Invalid to address")
+			}
+			if *createUnsignedAmount <= 0 {
+				log.Panic("Amount must be positive")
+			}
+			payments = []types.Payment{{Address: *createUnsignedTo, Amount: *createUnsignedAmount}}
+		}
+		if *createUnsignedPledge < 0 {
+			log.Panic("Pledge must be positive")
+		}
+		selector, err := coinselect.GetSelector(*createUnsignedCoinSelection)
+		errutil.Handle(err)
+		createUnsigned(cfg, *createUnsignedFrom, payments, *createUnsignedChange, *createUnsignedPledge, selector, *createUnsignedOut)
+	}
+
+	if signOfflineCommand.Parsed() {
+		if *signOfflineIn == "" {
+			signOfflineCommand.Usage()
+			runtime.Goexit()
+		}
+
+		out := *signOfflineOut
+		if out == "" {
+			out = *signOfflineIn
+		}
+		hashType := types.SigHashDefault
+		if *signOfflineSigHash != "" {
+			var err error
+			hashType, err = types.ParseSigHashType(*signOfflineSigHash)
+			errutil.Handle(err)
+		}
+		signOffline(cfg, *signOfflineIn, out, hashType)
+	}
+
+	if combinePartialCommand.Parsed() {
+		if *combinePartialIn == "" || *combinePartialOut == "" {
+			combinePartialCommand.Usage()
+			runtime.Goexit()
+		}
+
+		combinePartial(strings.Split(*combinePartialIn, ","), *combinePartialOut)
+	}
+
+	if finalizeCommand.Parsed() {
+		if *finalizeIn == "" {
+			finalizeCommand.Usage()
+			runtime.Goexit()
+		}
+
+		finalizeAndBroadcast(cfg, *finalizeIn, *finalizeReward)
+	}
+
+	if utxoStatsCommand.Parsed() {
+		utxoStats(cfg)
+	}
+
+	if walletRestoreCommand.Parsed() {
+		if *walletRestoreMnemonic == "" {
+			walletRestoreCommand.Usage()
+			runtime.Goexit()
+		}
+
+		curve, err := keys.ParseCurve(*walletRestoreCurve)
+		errutil.Handle(err)
+		walletRestore(cfg, *walletRestoreMnemonic, curve)
+	}
+
+	if walletBalanceCommand.Parsed() {
+		walletBalance(cfg)
+	}
+
+	if walletChangePassphraseCommand.Parsed() {
+		walletChangePassphrase(cfg)
+	}
+
+	if walletEncryptCommand.Parsed() {
+		walletEncrypt(cfg)
+	}
+
+	if walletLockCommand.Parsed() {
+		walletLock(cfg)
+	}
+
+	if walletUnlockCommand.Parsed() {
+		if *walletUnlockTimeout <= 0 {
+			walletUnlockCommand.Usage()
+			runtime.Goexit()
+		}
+
+		if *walletUnlockAgent {
+			serveUnlocked(cfg, time.Duration(*walletUnlockTimeout)*time.Second)
+		} else {
+			walletUnlock(cfg, *walletUnlockTimeout)
+		}
+	}
+
+}
+
+// loadUTXO creates the chain from a UTXO set file pinned in the chain params
+func loadUTXO(cfg *config.Config, in string) {
+	file, err := os.Open(in)
+	errutil.Handle(err)
+	defer file.Close()
+
+	bc, err := core.LoadUTXOSnapshot(cfg, file, func(done, total int) {
+		fmt.Printf("\rLoaded %d/%d UTXO entries", done, total)
+	})
+	if err != nil {
+		fmt.Println()
 	}
+	errutil.Handle(err)
+	defer bc.Close()
 
+	fmt.Printf("\nLoad complete! The chain is at height %d, the data of its blocks is not available.\n", bc.Height-1)
 }
 
 // addressList iterates through current Wallets and prints each Wallet address
-func addressList() {
-	ws, _ := wallet.InitWallets()
+func addressList(cfg *config.Config) {
+	ws, _ := wallet.InitWallets(cfg.WalletFile())
 	addresses := ws.GetAddresses()
 	for _, address := range addresses {
-		fmt.Println(address)
+		if w := ws.Wallets[address]; w.IsWatchOnly() {
+			fmt.Printf("%s watch-only\n", address)
+		} else if w.Path != "" {
+			fmt.Printf("%s %s\n", address, w.Path)
+		} else {
+			fmt.Println(address)
+		}
 	}
 }
 
 // getBalance prints the balance of the given address
-func getBalance(address string) {
-	if !wallet.ValidateAddress(address) {
+func getBalance(cfg *config.Config, address string) {
+	if !wallet.ValidateAddress(address, cfg.Params.Bech32HRP) {
 		log.Panic("Invalid address")
 	}
 
-	bc := core.GetBlockChain()
-	defer bc.ChainDB.CloseDB()
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
 
 	pubKeyHash := wallet.GetPubKeyHashFromAddress(address)
 
@@ -146,79 +623,850 @@ func getBalance(address string) {
 	fmt.Printf("Balance of %s: %d\n", address, balance)
 }
 
-// createWallet instantiates current Wallets and adds a new Wallet to it, then prints out the address
-func createWallet() {
-	ws, _ := wallet.InitWallets()
-	fmt.Println(ws.CreateWallet())
+// createWallet instantiates current Wallets and adds the Wallet of the next key of a chain of an account to it, with a
+// Schnorr pub key if schnorr and an address of an AddressType, then prints out the address - Wallets without a seed get
+// a new one on a curve first, whose mnemonic is printed once
+func createWallet(cfg *config.Config, account uint32, change bool, curve keys.Curve, schnorr bool, addressType wallet.AddressType) {
+	ws, _ := wallet.InitWallets(cfg.WalletFile())
+	if ws.HD != nil && curve != 0 && curve != ws.HD.Curve {
+		log.Panic(fmt.Sprintf("The wallet seed derives %s keys, not %s", ws.HD.Curve, curve))
+	}
+
+	if ws.HD == nil {
+		if curve == 0 {
+			curve = keys.DefaultCurve
+		}
+		mnemonic, err := ws.InitSeed(curve)
+		errutil.Handle(err)
+
+		fmt.Println("New wallet seed - write these words down, they restore every address with wallet-restore:")
+		fmt.Println(mnemonic)
+		fmt.Println()
+	}
+
+	chain := wallet.ExternalChain
+	if change {
+		chain = wallet.InternalChain
+	}
+	createAccountWallet := ws.CreateAccountWallet
+	if schnorr {
+		createAccountWallet = ws.CreateSchnorrWallet
+	}
+	hrp := ""
+	if addressType == wallet.Bech32Address {
+		hrp = cfg.Params.Bech32HRP
+	}
+	address, err := createAccountWallet(account, chain, hrp)
+	errutil.Handle(err)
 	ws.SaveToFile()
+
+	fmt.Println(address)
+}
+
+// aggregatePubKeys prints the MuSig aggregate of the Schnorr pub keys of cosigners in hex and its address, which they
+// spend from together with one Schnorr signature - optionally adds it to the Wallets as watch-only
+func aggregatePubKeys(cfg *config.Config, pubKeysHex []string, watch bool) {
+	aggPubKey, err := keys.AggregatePubKeys(parseSchnorrPubKeys(pubKeysHex))
+	errutil.Handle(err)
+	address := wallet.GetAddressFromPubKeyHash(wallet.HashPubKey(aggPubKey))
+
+	fmt.Printf("Aggregated public key: %x\n", aggPubKey)
+	fmt.Printf("Address: %s\n", address)
+
+	if watch {
+		ws, _ := wallet.InitWallets(cfg.WalletFile())
+		_, err := ws.ImportPubKey(aggPubKey)
+		if err == wallet.ErrAddressExists {
+			fmt.Printf("%s is already in the wallet\n", address)
+		} else {
+			errutil.Handle(err)
+			ws.SaveToFile()
+			fmt.Printf("Watching %s\n", address)
+		}
+	}
+}
+
+// parseSchnorrPubKeys reads Schnorr pub keys in hex
+func parseSchnorrPubKeys(pubKeysHex []string) [][]byte {
+	var pubKeys [][]byte
+	for _, pubKeyHex := range pubKeysHex {
+		pubKey, err := hex.DecodeString(strings.TrimSpace(pubKeyHex))
+		if err != nil || !keys.IsSchnorrPubKey(pubKey) {
+			log.Panic(fmt.Sprintf("Invalid Schnorr public key %q", pubKeyHex))
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	return pubKeys
+}
+
+// dumpUTXO writes the UTXO set to a file, printing what is needed to pin it in the chain params
+func dumpUTXO(cfg *config.Config, out string) {
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+
+	file, err := os.Create(out)
+	errutil.Handle(err)
+	defer file.Close()
+
+	info, err := bc.DumpUTXOSet(file)
+	errutil.Handle(err)
+
+	fmt.Printf("Dumped %d transactions with unspent outputs to %s\n", info.TxCount, out)
+	fmt.Printf("Height: %d\nBlock hash: %x\nContent hash: %x\n", info.Height, info.BlockHash, info.ContentHash)
+}
+
+// exportChain writes every Block of the chain to a chain file
+func exportChain(cfg *config.Config, out string) {
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+
+	file, err := os.Create(out)
+	errutil.Handle(err)
+	defer file.Close()
+
+	count, err := bc.ExportChain(file)
+	errutil.Handle(err)
+
+	fmt.Printf("Exported %d blocks to %s\n", count, out)
+}
+
+// importChain creates the chain from a chain file, validating every Block
+func importChain(cfg *config.Config, in string) {
+	file, err := os.Open(in)
+	errutil.Handle(err)
+	defer file.Close()
+
+	bc, err := core.ImportBlockChain(cfg, file, func(done, total int) {
+		fmt.Printf("\rImported %d/%d blocks", done, total)
+	})
+	if bc != nil {
+		defer bc.Close()
+	}
+	if err != nil {
+		fmt.Println()
+	}
+	errutil.Handle(err)
+
+	fmt.Printf("\nImport complete! The chain is at height %d.\n", bc.Height-1)
+}
+
+// getHistory prints every credit and debit of the given address with its number of confirmations
+func getHistory(cfg *config.Config, address string) {
+	if !wallet.ValidateAddress(address, cfg.Params.Bech32HRP) {
+		log.Panic("Invalid address")
+	}
+
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+
+	pubKeyHash := wallet.GetPubKeyHashFromAddress(address)
+
+	history, err := bc.GetAddressHistory(pubKeyHash)
+	errutil.Handle(err)
+
+	fmt.Printf("History of %s:\n", address)
+	balance := 0
+	for _, entry := range history {
+		balance += entry.Received - entry.Sent
+		fmt.Printf("Block %d (%d confirmations) tx %x: +%d -%d, balance %d\n",
+			entry.Height, bc.Height-entry.Height, entry.TxID, entry.Received, entry.Sent, balance)
+	}
+}
+
+// indexAddresses enables the address index and builds it for the existing chain
+func indexAddresses(cfg *config.Config) {
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+	err := bc.BuildAddressIndex()
+	errutil.Handle(err)
+
+	fmt.Println("Address index complete! It will be kept up to date as new blocks are added.")
 }
 
 // initChain initializes a new BlockChain with a given address
-func initChain(address string) {
-	if !wallet.ValidateAddress(address) {
+func initChain(cfg *config.Config, address string) {
+	if !wallet.ValidateAddress(address, cfg.Params.Bech32HRP) {
 		log.Panic("Invalid address")
 	}
-	bc := core.InitBlockChain(address)
-	defer bc.ChainDB.CloseDB()
+	bc := core.InitBlockChain(cfg, address)
+	defer bc.Close()
 }
 
 // printChain prints the chain from newest to oldest Block
-func printChain() {
-	bc := core.GetBlockChain()
+func printChain(cfg *config.Config) {
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
 	iter := bc.Iterator()
 
 	for {
-		currBlock := iter.Next()
+		header, err := iter.NextHeader()
+		errutil.Handle(err)
 
-		fmt.Printf("Block\t %d\n", currBlock.Index)
-		fmt.Println("----------")
-		fmt.Printf("Hash: %x\n", currBlock.Hash)
-		fmt.Printf("Mined Date: %s\n", currBlock.TimeStamp)
-		fmt.Println("Verified:", currBlock.ValidateProof())
-		for _, tx := range currBlock.Transactions {
-			fmt.Println(tx)
+		currBlock, err := bc.ChainDB.ReadBlockWithHash(header.Hash)
+		if err == chaindb.ErrBlockPruned {
+			printPrunedBlock(header)
+		} else {
+			errutil.Handle(err)
+			printBlock(currBlock)
 		}
-		fmt.Println()
 
 		// Reached the beginning of the chain
-		if len(currBlock.PrevHash) == 0 {
+		if len(header.PrevHash) == 0 {
 			break
 		}
 	}
 }
 
+// printBlockWithHeight prints the Block at a given height of the chain
+func printBlockWithHeight(cfg *config.Config, height int) {
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+
+	block, err := bc.GetBlockByHeight(height)
+	errutil.Handle(err)
+
+	printBlock(block)
+}
+
+// printBlock prints the details of a Block and its Transactions
+func printBlock(block *types.Block) {
+	fmt.Printf("Block\t %d\n", block.Index)
+	fmt.Println("----------")
+	fmt.Printf("Hash: %x\n", block.Hash)
+	fmt.Printf("Mined Date: %s\n", block.TimeStamp)
+	fmt.Println("Verified:", block.ValidateProof())
+	for _, tx := range block.Transactions {
+		fmt.Println(tx)
+	}
+	fmt.Println()
+}
+
+// printPrunedBlock prints the details of a Block whose data has been pruned, from its BlockHeader
+func printPrunedBlock(header *types.BlockHeader) {
+	fmt.Printf("Block\t %d\n", header.Index)
+	fmt.Println("----------")
+	fmt.Printf("Hash: %x\n", header.Hash)
+	fmt.Printf("Mined Date: %s\n", header.TimeStamp)
+	fmt.Println("Verified:", header.ValidateProof())
+	fmt.Println("--- Transactions pruned")
+	fmt.Println()
+}
+
 // printHelp prints the instructions for the cli
 func printHelp() {
-	fmt.Println("Usage: go run main.go <command>")
+	fmt.Println("Usage: go run main.go [-datadir <dir>] [-network <name>] [-backend <name>] [-prune <depth>] [-utxocache <MiB>] <command>")
 	fmt.Println()
 	fmt.Println("where <command> is one of:")
-	fmt.Println("\taddress-list, balance, create-wallet, help, init-chain, print-chain, reindex, send")
+	fmt.Println("\taddress-list, aggregate-pubkeys, balance, combine-partial, create-unsigned, create-wallet, dump-utxo, export-chain, export-key, finalize-and-broadcast, help, history, import-address, import-chain, import-key, import-pubkey, index-addresses, init-chain, load-utxo, musig-combine, musig-nonce, musig-sign, print-block, print-chain, reindex, send, send-many, sign-offline, utxo-stats, wallet-balance, wallet-change-passphrase, wallet-encrypt, wallet-lock, wallet-restore, wallet-unlock")
 	fmt.Println()
 	//fmt.Println("./main.go <command> h\t\tquick help on <command>")
 
 }
 
-// reindex reindexes UTXO set
-func reindex() {
-	bc := core.GetBlockChain()
-	defer bc.ChainDB.CloseDB()
-	bc.Reindex()
+// reindex reindexes the height index, UTXO set and (if enabled) address index
+func reindex(cfg *config.Config) {
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+	bc.ReindexHeights()
+	err := bc.Reindex()
+	errutil.Handle(err)
+	if bc.ChainDB.HasAddressIndex() {
+		err = bc.BuildAddressIndex()
+		errutil.Handle(err)
+	}
 
 	count := bc.CountUTX()
 	fmt.Printf("Reindex complete! There are %d transactions in the UTXO set.\n", count)
 }
 
-// send initiates the addition of a Transaction to the chain given a sender, reciever, and amount
-func send(from, to string, amount int) {
-	if !wallet.ValidateAddress(from) {
+// send initiates the addition of a Transaction to the chain given a sender, reciever, amount and coin Selector
+func send(cfg *config.Config, from, to string, amount int, selector coinselect.Selector) {
+	if !wallet.ValidateAddress(from, cfg.Params.Bech32HRP) {
 		log.Panic("Invalid from address")
 	}
-	if !wallet.ValidateAddress(to) {
+	if !wallet.ValidateAddress(to, cfg.Params.Bech32HRP) {
 		log.Panic("Invalid to address")
 	}
 	var txns []*types.Transaction
-	bc := core.GetBlockChain()
-	defer bc.ChainDB.CloseDB()
-	txns = append(txns, types.CoinbaseTx(from), bc.CreateTransaction(from, to, amount))
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+	txns = append(txns, types.CoinbaseTx(from, bc.Height), bc.CreateTransaction(from, to, amount, selector))
 	bc.AddBlock(txns)
 }
+
+// utxoStats prints the hash and totals of the UTXO set, which match on nodes that agree on the chain
+func utxoStats(cfg *config.Config) {
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+
+	stats := bc.UTXOCache.Stats()
+
+	fmt.Printf("UTXO set at height %d (block %x)\n", bc.Height-1, bc.LastHash)
+	fmt.Printf("Hash: %x\n", stats.Hash.Sum())
+	fmt.Printf("Outputs: %d\n", stats.Outputs)
+	fmt.Printf("Total supply: %d\n", stats.Supply)
+	fmt.Printf("Serialized size: %d bytes\n", stats.Size)
+}
+
+// sendMany initiates the addition of a Transaction paying every Payment to the chain, then prints its ID
+func sendMany(cfg *config.Config, from string, payments []types.Payment, selector coinselect.Selector) {
+	if !wallet.ValidateAddress(from, cfg.Params.Bech32HRP) {
+		log.Panic("Invalid from address")
+	}
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+
+	tx := bc.CreateTransactionWithPayments(from, payments, selector)
+	bc.AddBlock([]*types.Transaction{types.CoinbaseTx(from, bc.Height), tx})
+
+	total := 0
+	for _, payment := range payments {
+		total += payment.Amount
+	}
+	fmt.Printf("Sent %d to %d recipients in transaction %x\n", total, len(payments), tx.ID)
+}
+
+// sendFromWallet initiates the addition of a Transaction paying every Payment from any addresses of the wallet to the
+// chain, with change and the coinbase reward going to a new address, then prints its ID
+func sendFromWallet(cfg *config.Config, payments []types.Payment, selector coinselect.Selector) {
+	for _, payment := range payments {
+		if !wallet.ValidateAddress(payment.Address, cfg.Params.Bech32HRP) {
+			log.Panic("Invalid to address")
+		}
+	}
+	ws, err := wallet.InitWallets(cfg.WalletFile())
+	errutil.Handle(err)
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+
+	// Saved before anything is sent to it, so its key is never lost
+	changeAddress, err := ws.CreateChangeWallet()
+	errutil.Handle(err)
+	ws.SaveToFile()
+
+	tx, err := bc.CreateWalletTransaction(ws, payments, changeAddress, selector)
+	if err == coinselect.ErrInsufficientFunds {
+		log.Panic("Error: Not enough funds in wallet")
+	}
+	errutil.Handle(err)
+	bc.AddBlock([]*types.Transaction{types.CoinbaseTx(changeAddress, bc.Height), tx})
+
+	total := 0
+	for _, payment := range payments {
+		total += payment.Amount
+	}
+	fmt.Printf("Sent %d to %d recipients in transaction %x spending %d outputs\n", total, len(payments), tx.ID, len(tx.Inputs))
+	fmt.Printf("Change address: %s\n", changeAddress)
+}
+
+// walletRestore gives the Wallets the seed of a mnemonic deriving keys on a curve, then adds the Wallets of it used in
+// the chain
+func walletRestore(cfg *config.Config, mnemonic string, curve keys.Curve) {
+	ws, _ := wallet.InitWallets(cfg.WalletFile())
+	err := ws.Restore(mnemonic, curve)
+	errutil.Handle(err)
+
+	db := chaindb.InitDB(cfg)
+	if !db.HasChain() {
+		db.CloseDB()
+		ws.SaveToFile()
+		fmt.Println("Restored the wallet seed. There is no chain to find its used addresses in yet.")
+		return
+	}
+	bc := core.GetBlockChainWithDB(cfg, db)
+	defer bc.Close()
+
+	used, err := bc.GetUsedPubKeyHashes()
+	errutil.Handle(err)
+	added, err := ws.Discover(func(pubKeyHash []byte) bool {
+		return used[string(pubKeyHash)]
+	})
+	errutil.Handle(err)
+	ws.SaveToFile()
+
+	fmt.Printf("Restored the wallet seed and %d addresses used in the chain.\n", added)
+}
+
+// walletEncrypt encrypts the priv keys and seed of the Wallets with a new passphrase
+func walletEncrypt(cfg *config.Config) {
+	ws, err := wallet.InitWallets(cfg.WalletFile())
+	errutil.Handle(err)
+	if ws.IsEncrypted() {
+		log.Panic(wallet.ErrEncrypted)
+	}
+
+	passphrase, err := readNewPassphrase()
+	errutil.Handle(err)
+	err = ws.Encrypt(passphrase)
+	errutil.Handle(err)
+	ws.SaveToFile()
+
+	fmt.Println("Wallet encrypted and locked. Run wallet-unlock before sending.")
+}
+
+// walletUnlock keeps the Wallets unlocked for a number of seconds, given their passphrase - an agent process started
+// in the background holds their key in memory, so it is never written to disk
+func walletUnlock(cfg *config.Config, timeout int) {
+	ws, err := wallet.InitWallets(cfg.WalletFile())
+	errutil.Handle(err)
+	if !ws.IsEncrypted() {
+		log.Panic(wallet.ErrNotEncrypted)
+	}
+
+	passphrase, err := readPassphrase("Passphrase: ")
+	errutil.Handle(err)
+	err = ws.Unlock(passphrase)
+	errutil.Handle(err)
+
+	executable, err := os.Executable()
+	errutil.Handle(err)
+	agent := exec.Command(executable, "-datadir", cfg.DataDir, "-network", cfg.Params.Name, "wallet-unlock", "-agent", "-timeout", strconv.Itoa(timeout))
+	agentIn, err := agent.StdinPipe()
+	errutil.Handle(err)
+	agentOut, err := agent.StdoutPipe()
+	errutil.Handle(err)
+	err = agent.Start()
+	errutil.Handle(err)
+
+	// The passphrase goes over a pipe rather than the args, which other users can see
+	fmt.Fprintln(agentIn, passphrase)
+	agentIn.Close()
+	ready := false
+	for scanner := bufio.NewScanner(agentOut); !ready && scanner.Scan(); {
+		ready = scanner.Text() == agentReady
+	}
+	if !ready {
+		agent.Wait()
+		log.Panic("The unlock agent failed to start")
+	}
+	agent.Process.Release()
+
+	fmt.Printf("Wallet unlocked until %s.\n", time.Now().Add(time.Duration(timeout)*time.Second).Format(time.RFC1123))
+}
+
+// serveUnlocked is the agent started by walletUnlock - unlocks the Wallets with the passphrase on stdin and keeps them
+// unlocked for a duration, telling walletUnlock once later commands can use them
+func serveUnlocked(cfg *config.Config, timeout time.Duration) {
+	ws, err := wallet.InitWallets(cfg.WalletFile())
+	errutil.Handle(err)
+
+	passphrase, err := readPassphrase("")
+	errutil.Handle(err)
+	err = ws.Unlock(passphrase)
+	errutil.Handle(err)
+
+	err = ws.ServeUnlocked(timeout, func() { fmt.Println(agentReady) })
+	errutil.Handle(err)
+}
+
+// walletLock locks the Wallets before their unlock timeout
+func walletLock(cfg *config.Config) {
+	ws, err := wallet.InitWallets(cfg.WalletFile())
+	errutil.Handle(err)
+	err = ws.Lock()
+	errutil.Handle(err)
+
+	fmt.Println("Wallet locked.")
+}
+
+// walletChangePassphrase encrypts the Wallets with a new passphrase, given the current one
+func walletChangePassphrase(cfg *config.Config) {
+	ws, err := wallet.InitWallets(cfg.WalletFile())
+	errutil.Handle(err)
+	if !ws.IsEncrypted() {
+		log.Panic(wallet.ErrNotEncrypted)
+	}
+
+	oldPassphrase, err := readPassphrase("Current passphrase: ")
+	errutil.Handle(err)
+	if err = ws.Unlock(oldPassphrase); err != nil {
+		log.Panic(err)
+	}
+	newPassphrase, err := readNewPassphrase()
+	errutil.Handle(err)
+	err = ws.ChangePassphrase(oldPassphrase, newPassphrase)
+	errutil.Handle(err)
+	ws.SaveToFile()
+
+	fmt.Println("Passphrase changed, the wallet is locked.")
+}
+
+// exportKey prints the priv key of an address of the Wallets in WIF, or its pub key in hex
+func exportKey(cfg *config.Config, address string, pubKey bool) {
+	ws, err := wallet.InitWallets(cfg.WalletFile())
+	errutil.Handle(err)
+
+	if pubKey {
+		w, ok := ws.Wallets[address]
+		if !ok || w.PublicKey == nil {
+			log.Panic("The public key of the address is not in the wallet")
+		}
+		fmt.Printf("%x\n", w.PublicKey)
+		return
+	}
+
+	wif, err := ws.ExportKey(address, cfg.Params.WIFPrefix)
+	errutil.Handle(err)
+
+	fmt.Println(wif)
+}
+
+// importKey adds a priv key in WIF to the Wallets and prints its address, then optionally scans the chain for payments
+// to it
+func importKey(cfg *config.Config, wif string, rescan bool) {
+	ws, _ := wallet.InitWallets(cfg.WalletFile())
+
+	address, err := ws.ImportKey(wif, cfg.Params.WIFPrefix)
+	if err == wallet.ErrKeyExists {
+		fmt.Printf("%s is already in the wallet\n", address)
+	} else {
+		errutil.Handle(err)
+		ws.SaveToFile()
+		fmt.Printf("Imported %s\n", address)
+	}
+
+	if rescan {
+		rescanAddress(cfg, address)
+	}
+}
+
+// rescanAddress prints whether an address has been paid in the chain, and its balance
+func rescanAddress(cfg *config.Config, address string) {
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+
+	pubKeyHash := wallet.GetPubKeyHashFromAddress(address)
+	used, err := bc.GetUsedPubKeyHashes()
+	errutil.Handle(err)
+	if !used[string(pubKeyHash)] {
+		fmt.Println("Rescan complete, the address has not been paid in the chain.")
+		return
+	}
+
+	_, balance := bc.GetUTXOWithPubKey(pubKeyHash, math.MaxInt32)
+	fmt.Printf("Rescan complete, the address has been paid in the chain. Balance of %s: %d\n", address, balance)
+}
+
+// importAddress adds a watch-only address to the Wallets, then optionally scans the chain for payments to it
+func importAddress(cfg *config.Config, address string, rescan bool) {
+	ws, _ := wallet.InitWallets(cfg.WalletFile())
+
+	err := ws.ImportAddress(address, cfg.Params.Bech32HRP)
+	if err == wallet.ErrAddressExists {
+		fmt.Printf("%s is already in the wallet\n", address)
+	} else {
+		errutil.Handle(err)
+		ws.SaveToFile()
+		fmt.Printf("Watching %s\n", address)
+	}
+
+	if rescan {
+		rescanAddress(cfg, address)
+	}
+}
+
+// importPubKey adds a watch-only pub key in hex to the Wallets and prints its address, then optionally scans the
+// chain for payments to it
+func importPubKey(cfg *config.Config, pubKeyHex string, rescan bool) {
+	pubKey, err := hex.DecodeString(pubKeyHex)
+	if err != nil {
+		log.Panic(wallet.ErrInvalidPubKey)
+	}
+	ws, _ := wallet.InitWallets(cfg.WalletFile())
+
+	address, err := ws.ImportPubKey(pubKey)
+	if err == wallet.ErrAddressExists {
+		fmt.Printf("%s is already in the wallet\n", address)
+	} else {
+		errutil.Handle(err)
+		ws.SaveToFile()
+		fmt.Printf("Watching %s\n", address)
+	}
+
+	if rescan {
+		rescanAddress(cfg, address)
+	}
+}
+
+// walletBalance prints the balance of each address of the Wallets, and the totals of the spendable and watch-only ones
+func walletBalance(cfg *config.Config) {
+	ws, err := wallet.InitWallets(cfg.WalletFile())
+	errutil.Handle(err)
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+
+	addresses := ws.GetAddresses()
+	sort.Strings(addresses)
+	var pubKeyHashes [][]byte
+	for _, address := range addresses {
+		pubKeyHashes = append(pubKeyHashes, ws.Wallets[address].GetPubKeyHash())
+	}
+	coins := bc.GetCoinsWithPubKeys(pubKeyHashes)
+
+	spendable, watchOnly := 0, 0
+	for _, address := range addresses {
+		w := ws.Wallets[address]
+		balance := coinselect.Sum(coins[string(w.GetPubKeyHash())])
+
+		if w.IsWatchOnly() {
+			watchOnly += balance
+			fmt.Printf("%s: %d (watch-only)\n", address, balance)
+		} else {
+			spendable += balance
+			fmt.Printf("%s: %d\n", address, balance)
+		}
+	}
+
+	fmt.Printf("Total: %d spendable, %d watch-only\n", spendable, watchOnly)
+}
+
+// createUnsigned writes a Transaction paying every Payment from the wallet to a file, to be signed with sign-offline -
+// or funding only a pledged amount of them with no change, if pledge isn't 0
+func createUnsigned(cfg *config.Config, from string, payments []types.Payment, changeAddress string, pledge int, selector coinselect.Selector, out string) {
+	if from != "" && !wallet.ValidateAddress(from, cfg.Params.Bech32HRP) {
+		log.Panic("Invalid from address")
+	}
+	if changeAddress != "" && !wallet.ValidateAddress(changeAddress, cfg.Params.Bech32HRP) {
+		log.Panic("Invalid change address")
+	}
+	ws, err := wallet.InitWallets(cfg.WalletFile())
+	errutil.Handle(err)
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+
+	var ptx *types.PartialTransaction
+	if pledge > 0 {
+		ptx, err = bc.CreatePledge(ws, from, payments, pledge, selector)
+	} else {
+		if changeAddress == "" {
+			changeAddress = from
+		}
+		if changeAddress == "" {
+			// Saved before anything is sent to it, so its key is never lost
+			changeAddress, err = ws.CreateChangeWallet()
+			errutil.Handle(err)
+			ws.SaveToFile()
+		}
+
+		ptx, err = bc.CreateUnsignedTransaction(ws, from, payments, changeAddress, selector)
+	}
+	if err == coinselect.ErrInsufficientFunds {
+		log.Panic("Error: Not enough funds in wallet")
+	}
+	errutil.Handle(err)
+
+	file, err := os.Create(out)
+	errutil.Handle(err)
+	defer file.Close()
+	err = types.EncodePartialTransaction(file, ptx)
+	errutil.Handle(err)
+
+	printPartialTransaction(ptx)
+	fmt.Printf("Wrote the unsigned transaction to %s, sign it with sign-offline\n", out)
+}
+
+// signOffline signs the inputs of a Transaction in a file that the wallet has the keys of, without the chain, covering
+// what a SigHashType selects
+func signOffline(cfg *config.Config, in, out string, hashType types.SigHashType) {
+	ptx := readPartialTransaction(in)
+	if ptx.Network != cfg.Params.Name {
+		log.Panic(fmt.Sprintf("Transaction is for network %q, not %q", ptx.Network, cfg.Params.Name))
+	}
+	ws, err := wallet.InitWallets(cfg.WalletFile())
+	errutil.Handle(err)
+	if ws.IsLocked() {
+		log.Panic(wallet.ErrLocked)
+	}
+
+	printPartialTransaction(ptx)
+	signed, err := ptx.Sign(hashType, ws.GetKey)
+	errutil.Handle(err)
+
+	file, err := os.Create(out)
+	errutil.Handle(err)
+	defer file.Close()
+	err = types.EncodePartialTransaction(file, ptx)
+	errutil.Handle(err)
+
+	fmt.Printf("Signed %d inputs, %d left unsigned. Wrote the transaction to %s\n", signed, ptx.Unsigned(), out)
+}
+
+// combinePartial joins the inputs of Transactions in files paying the same outputs into one Transaction, written to a
+// file
+func combinePartial(ins []string, out string) {
+	var ptxs []*types.PartialTransaction
+	for _, in := range ins {
+		ptxs = append(ptxs, readPartialTransaction(strings.TrimSpace(in)))
+	}
+
+	ptx, err := types.CombinePartialTransactions(ptxs)
+	errutil.Handle(err)
+	printPartialTransaction(ptx)
+
+	file, err := os.Create(out)
+	errutil.Handle(err)
+	defer file.Close()
+	err = types.EncodePartialTransaction(file, ptx)
+	errutil.Handle(err)
+
+	fmt.Printf("Combined %d inputs, %d left unsigned. Wrote the transaction to %s\n", len(ptx.Tx.Inputs), ptx.Unsigned(), out)
+}
+
+// muSigNonce adds a MuSig nonce for each key of the wallet among the cosigners of each input of a Transaction in a
+// file locked with their aggregate, starting to sign the inputs locked with the aggregate of pub keys if given
+func muSigNonce(cfg *config.Config, in, out string, pubKeysHex []string) {
+	ptx := readPartialTransaction(in)
+	if ptx.Network != cfg.Params.Name {
+		log.Panic(fmt.Sprintf("Transaction is for network %q, not %q", ptx.Network, cfg.Params.Name))
+	}
+	ws, err := wallet.InitWallets(cfg.WalletFile())
+	errutil.Handle(err)
+	if ws.IsLocked() {
+		log.Panic(wallet.ErrLocked)
+	}
+
+	if pubKeysHex != nil {
+		_, err := ptx.StartMuSig(parseSchnorrPubKeys(pubKeysHex))
+		errutil.Handle(err)
+	}
+	printPartialTransaction(ptx)
+	added, err := ptx.AddMuSigNonces(ws.NewMuSigNonce)
+	errutil.Handle(err)
+	// Saved before the nonces are shared, so their secrets are never lost
+	ws.SaveToFile()
+
+	file, err := os.Create(out)
+	errutil.Handle(err)
+	defer file.Close()
+	err = types.EncodePartialTransaction(file, ptx)
+	errutil.Handle(err)
+
+	fmt.Printf("Added %d nonces. Wrote the transaction to %s, sign it with musig-sign once every cosigner has added theirs\n", added, out)
+}
+
+// muSigSign adds the MuSig partial signatures of the wallet to the inputs of a Transaction in a file that every
+// cosigner has added a nonce to, with the nonces the wallet added
+func muSigSign(cfg *config.Config, in, out string) {
+	ptx := readPartialTransaction(in)
+	if ptx.Network != cfg.Params.Name {
+		log.Panic(fmt.Sprintf("Transaction is for network %q, not %q", ptx.Network, cfg.Params.Name))
+	}
+	ws, err := wallet.InitWallets(cfg.WalletFile())
+	errutil.Handle(err)
+	if ws.IsLocked() {
+		log.Panic(wallet.ErrLocked)
+	}
+
+	printPartialTransaction(ptx)
+	signed, err := ptx.MuSigSign(ws.MuSigSign)
+	// Saved before the partial signatures are shared, so their nonces are never signed with again
+	ws.SaveToFile()
+	errutil.Handle(err)
+
+	file, err := os.Create(out)
+	errutil.Handle(err)
+	defer file.Close()
+	err = types.EncodePartialTransaction(file, ptx)
+	errutil.Handle(err)
+
+	fmt.Printf("Added %d partial signatures, %d inputs left unsigned. Wrote the transaction to %s\n", signed, ptx.Unsigned(), out)
+}
+
+// muSigCombine joins the MuSig nonces, partial signatures and signatures cosigners added to copies of a Transaction in
+// files into one Transaction, written to a file
+func muSigCombine(ins []string, out string) {
+	var ptxs []*types.PartialTransaction
+	for _, in := range ins {
+		ptxs = append(ptxs, readPartialTransaction(strings.TrimSpace(in)))
+	}
+
+	ptx, err := types.CombineMuSigSessions(ptxs)
+	errutil.Handle(err)
+	printPartialTransaction(ptx)
+
+	file, err := os.Create(out)
+	errutil.Handle(err)
+	defer file.Close()
+	err = types.EncodePartialTransaction(file, ptx)
+	errutil.Handle(err)
+
+	fmt.Printf("Combined %d copies, %d inputs left unsigned. Wrote the transaction to %s\n", len(ptxs), ptx.Unsigned(), out)
+}
+
+// finalizeAndBroadcast adds a fully signed Transaction in a file to the chain, then prints its ID
+func finalizeAndBroadcast(cfg *config.Config, in, rewardAddress string) {
+	ptx := readPartialTransaction(in)
+	if rewardAddress == "" {
+		ws, _ := wallet.InitWallets(cfg.WalletFile())
+		var err error
+		rewardAddress, err = ws.CreateWallet()
+		errutil.Handle(err)
+		ws.SaveToFile()
+	} else if !wallet.ValidateAddress(rewardAddress, cfg.Params.Bech32HRP) {
+		log.Panic("Invalid reward address")
+	}
+	bc := core.GetBlockChain(cfg)
+	defer bc.Close()
+
+	tx, err := bc.FinalizeTransaction(ptx, rewardAddress)
+	errutil.Handle(err)
+
+	fmt.Printf("Transaction %x added to the chain at height %d\n", tx.ID, bc.Height-1)
+}
+
+// readPartialTransaction reads a PartialTransaction from a file
+func readPartialTransaction(in string) *types.PartialTransaction {
+	file, err := os.Open(in)
+	errutil.Handle(err)
+	defer file.Close()
+
+	ptx, err := types.DecodePartialTransaction(file)
+	errutil.Handle(err)
+
+	return ptx
+}
+
+// printPartialTransaction prints what a PartialTransaction pays, for review before signing
+func printPartialTransaction(ptx *types.PartialTransaction) {
+	fmt.Printf("Transaction %x on %s\n", ptx.Tx.ID, ptx.Network)
+	for txinID, txo := range ptx.PrevOutputs {
+		signed := ""
+		if witness := ptx.Tx.Witnesses[txinID]; witness.Signature != nil {
+			signed = fmt.Sprintf(" (signed %s)", witness.HashType)
+		} else if session, ok := ptx.MuSig[txinID]; ok {
+			nonces, partials := 0, 0
+			for i := range session.PubKeys {
+				if session.Nonces[i] != nil {
+					nonces++
+				}
+				if session.Partials[i] != nil {
+					partials++
+				}
+			}
+			signed = fmt.Sprintf(" (MuSig of %d cosigners, %d nonces, %d partial signatures)", len(session.PubKeys), nonces, partials)
+		}
+		fmt.Printf("  Input %d: %d from %s%s\n", txinID, txo.Amount, formatAddresses(txo.PubKeyHash, ptx.Network, ptx.Tx.Inputs[txinID].PubKey), signed)
+	}
+	for txoIdx, txo := range ptx.Tx.Outputs {
+		fmt.Printf("  Output %d: %d to %s\n", txoIdx, txo.Amount, formatAddresses(txo.PubKeyHash, ptx.Network, nil))
+	}
+	fmt.Printf("  Fee: %d\n", ptx.Fee())
+}
+
+// formatAddresses lists the addresses of a pub key hash on a network, so it can be checked against the one that was
+// entered - Base58 first, then Bech32 of the pub key if it is known, otherwise both Bech32 and Bech32m, as a txo
+// doesn't keep which of them it was paid to
+func formatAddresses(pubKeyHash []byte, network string, pubKey []byte) string {
+	base58 := wallet.GetAddressFromPubKeyHash(pubKeyHash)
+	params, ok := config.GetParams(network)
+	if !ok {
+		return base58
+	}
+
+	if pubKey != nil {
+		return fmt.Sprintf("%s / %s", base58, wallet.EncodeBech32Address(pubKeyHash, params.Bech32HRP, keys.IsSchnorrPubKey(pubKey)))
+	}
+	return fmt.Sprintf("%s / %s / %s", base58, wallet.EncodeBech32Address(pubKeyHash, params.Bech32HRP, false),
+		wallet.EncodeBech32Address(pubKeyHash, params.Bech32HRP, true))
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// passphrase is reading wallet passphrases without echoing them, or from stdin when it is not a terminal
+
+// stdin reads passphrases piped in, one per line
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassphrase prompts for a passphrase
+func readPassphrase(prompt string) (string, error) {
+	fmt.Print(prompt)
+
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		passphrase, err := terminal.ReadPassword(fd)
+		fmt.Println()
+		return string(passphrase), err
+	}
+
+	line, err := stdin.ReadString('\n')
+	fmt.Println()
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readNewPassphrase prompts for a new passphrase twice, to rule out typos
+func readNewPassphrase() (string, error) {
+	passphrase, err := readPassphrase("New passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("Passphrase must not be empty")
+	}
+
+	repeated, err := readPassphrase("Repeat new passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if repeated != passphrase {
+		return "", errors.New("Passphrases do not match")
+	}
+
+	return passphrase, nil
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/danitello/go-blockchain/core/types"
+	"github.com/danitello/go-blockchain/wallet"
+)
+
+// payments is reading the recipients of send-many from a file
+
+// readPayments reads the Payments in a .json file (an array of {"address": ..., "amount": ...} objects) or any other
+// file as csv (address,amount lines, optionally under an address,amount header) - Bech32 addresses must be under the
+// prefix of the network
+func readPayments(path, hrp string) ([]types.Payment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var payments []types.Payment
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		payments, err = readJSONPayments(file)
+	} else {
+		payments, err = readCSVPayments(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Reading %s: %s", path, err)
+	}
+
+	if len(payments) == 0 {
+		return nil, fmt.Errorf("No payments in %s", path)
+	}
+	for i, payment := range payments {
+		if !wallet.ValidateAddress(payment.Address, hrp) {
+			return nil, fmt.Errorf("Payment %d: invalid address %q", i+1, payment.Address)
+		}
+		if payment.Amount <= 0 {
+			return nil, fmt.Errorf("Payment %d: amount must be positive", i+1)
+		}
+	}
+
+	return payments, nil
+}
+
+// readJSONPayments reads Payments from a json array
+func readJSONPayments(r io.Reader) ([]types.Payment, error) {
+	var entries []struct {
+		Address string `json:"address"`
+		Amount  int    `json:"amount"`
+	}
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	payments := make([]types.Payment, len(entries))
+	for i, entry := range entries {
+		payments[i] = types.Payment{Address: entry.Address, Amount: entry.Amount}
+	}
+
+	return payments, nil
+}
+
+// readCSVPayments reads Payments from address,amount csv records
+func readCSVPayments(r io.Reader) ([]types.Payment, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	firstLine := 1
+	if len(records) > 0 && strings.EqualFold(records[0][0], "address") {
+		records = records[1:]
+		firstLine++
+	}
+
+	payments := make([]types.Payment, len(records))
+	for i, record := range records {
+		amount, err := strconv.Atoi(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid amount %q", firstLine+i, record[1])
+		}
+		payments[i] = types.Payment{Address: record[0], Amount: amount}
+	}
+
+	return payments, nil
+}
@@ -0,0 +1,349 @@
+package keys
+
+// Keys on the secp256k1 and P-256 curves - pub keys are encoded as a byte naming the curve followed by the compressed
+// SEC1 point, so each encoding has a fixed length and one meaning. Pub keys of the first P-256 wallets are still read,
+// they are the unpadded X and Y coordinates joined together. Signatures are ECDSA with RFC 6979 nonces, written as
+// 32 byte R and S with S in the lower half of the order of the curve, so there is exactly one valid signature of a hash.
+// Schnorr pub keys (see schnorr) sign with Schnorr signatures instead
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Curve is the curve of a key, written as the first byte of its pub key
+type Curve byte
+
+const (
+	// Secp256k1 is the curve of bitcoin keys, used for new keys
+	Secp256k1 = Curve(0x01)
+	// P256 is the NIST P-256 curve of the first wallets
+	P256 = Curve(0x02)
+
+	// DefaultCurve is the curve of new keys when none is specified
+	DefaultCurve = Secp256k1
+
+	// PrivKeyLen is the length of a priv key
+	PrivKeyLen = 32
+	// PubKeyLen is the length of an encoded pub key - the curve byte and the compressed point
+	PubKeyLen = 1 + 1 + 32
+	// SignatureLen is the length of a signature - R and S
+	SignatureLen = 2 * 32
+	// legacyPubKeyLen is the most a legacy P-256 pub key can be, both coordinates at full length
+	legacyPubKeyLen = 2 * 32
+)
+
+var (
+	// ErrUnknownCurve is returned for a curve other than Secp256k1 and P256
+	ErrUnknownCurve = errors.New("Unknown curve")
+	// ErrInvalidPubKey is returned when a pub key is malformed or not a point on its curve
+	ErrInvalidPubKey = errors.New("Invalid public key")
+	// ErrInvalidPrivKey is returned when a priv key is 0 or past the order of its curve
+	ErrInvalidPrivKey = errors.New("Invalid private key")
+	// ErrSignatureLen is returned for a signature that isn't SignatureLen bytes
+	ErrSignatureLen = fmt.Errorf("Signature is not %d bytes", SignatureLen)
+	// ErrSignatureRange is returned for a signature whose R or S is 0 or past the order of the curve
+	ErrSignatureRange = errors.New("Signature R or S is out of range")
+	// ErrHighS is returned for a signature whose S is in the upper half of the order of the curve
+	ErrHighS = errors.New("Signature S is not low, it can be replaced by its negation")
+)
+
+// ParseCurve gets the Curve of its name
+func ParseCurve(name string) (Curve, error) {
+	switch strings.ToLower(name) {
+	case "secp256k1":
+		return Secp256k1, nil
+	case "p256", "p-256":
+		return P256, nil
+	}
+
+	return 0, fmt.Errorf("Unknown curve %q, use secp256k1 or p256", name)
+}
+
+// String gets the name of a Curve
+func (c Curve) String() string {
+	switch c {
+	case Secp256k1:
+		return "secp256k1"
+	case P256:
+		return "p256"
+	}
+
+	return fmt.Sprintf("curve(%#x)", byte(c))
+}
+
+// Params gets the elliptic.Curve implementing a Curve, nil if it is unknown
+func (c Curve) Params() elliptic.Curve {
+	switch c {
+	case Secp256k1:
+		return secp256k1.S256()
+	case P256:
+		return elliptic.P256()
+	}
+
+	return nil
+}
+
+// CurveOf gets the Curve of a key
+func CurveOf(pubKey ecdsa.PublicKey) Curve {
+	switch pubKey.Curve {
+	case secp256k1.S256():
+		return Secp256k1
+	case elliptic.P256():
+		return P256
+	}
+
+	return 0
+}
+
+// GenerateKey makes a new random priv key on a Curve
+func GenerateKey(c Curve) (ecdsa.PrivateKey, error) {
+	curve := c.Params()
+	if curve == nil {
+		return ecdsa.PrivateKey{}, ErrUnknownCurve
+	}
+
+	privKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return ecdsa.PrivateKey{}, err
+	}
+
+	return *privKey, nil
+}
+
+// ValidPrivateKey determines if bytes are a priv key on a Curve - neither 0 nor past its order
+func ValidPrivateKey(c Curve, d []byte) bool {
+	curve := c.Params()
+	if curve == nil || len(d) > PrivKeyLen {
+		return false
+	}
+
+	k := new(big.Int).SetBytes(d)
+	return k.Sign() != 0 && k.Cmp(curve.Params().N) < 0
+}
+
+// PrivateKeyFromBytes makes the priv key on a Curve of its bytes
+func PrivateKeyFromBytes(c Curve, d []byte) (ecdsa.PrivateKey, error) {
+	if !ValidPrivateKey(c, d) {
+		return ecdsa.PrivateKey{}, ErrInvalidPrivKey
+	}
+
+	curve := c.Params()
+	privKey := ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	privKey.PublicKey.Curve = curve
+	privKey.PublicKey.X, privKey.PublicKey.Y = curve.ScalarBaseMult(d)
+
+	return privKey, nil
+}
+
+// PrivateKeyBytes writes a priv key as PrivKeyLen bytes
+func PrivateKeyBytes(privKey ecdsa.PrivateKey) []byte {
+	return privKey.D.FillBytes(make([]byte, PrivKeyLen))
+}
+
+// EncodePubKey writes a pub key as its Curve byte and compressed point
+func EncodePubKey(pubKey ecdsa.PublicKey) []byte {
+	return append([]byte{byte(CurveOf(pubKey))}, CompressPoint(pubKey.X, pubKey.Y)...)
+}
+
+// EncodeLegacyPubKey writes a P-256 pub key as the first wallets did, the unpadded coordinates joined together
+func EncodeLegacyPubKey(pubKey ecdsa.PublicKey) []byte {
+	return append(pubKey.X.Bytes(), pubKey.Y.Bytes()...)
+}
+
+// IsLegacyPubKey determines if a pub key is in the encoding of the first wallets rather than EncodePubKey's or
+// EncodeSchnorrPubKey's
+func IsLegacyPubKey(pubKey []byte) bool {
+	return len(pubKey) != PubKeyLen && !IsSchnorrPubKey(pubKey)
+}
+
+// CompressPoint writes a point as compressed SEC1 - a byte for the parity of Y, then X
+func CompressPoint(x, y *big.Int) []byte {
+	point := make([]byte, 1+32)
+	point[0] = 0x02 + byte(y.Bit(0))
+	x.FillBytes(point[1:])
+
+	return point
+}
+
+// ParsePubKey reads a pub key written by EncodePubKey, EncodeLegacyPubKey or EncodeSchnorrPubKey
+func ParsePubKey(pubKey []byte) (ecdsa.PublicKey, error) {
+	if IsLegacyPubKey(pubKey) {
+		return parseLegacyPubKey(pubKey)
+	}
+	if IsSchnorrPubKey(pubKey) {
+		return parseSchnorrPubKey(pubKey)
+	}
+
+	c := Curve(pubKey[0])
+	point := pubKey[1:]
+	switch c {
+	case Secp256k1:
+		key, err := secp256k1.ParsePubKey(point)
+		if err != nil {
+			return ecdsa.PublicKey{}, ErrInvalidPubKey
+		}
+		return *key.ToECDSA(), nil
+	case P256:
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), point)
+		if x == nil {
+			return ecdsa.PublicKey{}, ErrInvalidPubKey
+		}
+		return ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+
+	return ecdsa.PublicKey{}, ErrUnknownCurve
+}
+
+// parseLegacyPubKey reads a P-256 pub key of the first wallets - the coordinates are written without leading zeros,
+// so it is the split of the bytes near the middle that is a point on the curve
+func parseLegacyPubKey(pubKey []byte) (ecdsa.PublicKey, error) {
+	curve := elliptic.P256()
+	if len(pubKey) > legacyPubKeyLen {
+		return ecdsa.PublicKey{}, ErrInvalidPubKey
+	}
+
+	// Try the even split first, the only one when neither coordinate has a leading zero
+	half := len(pubKey) / 2
+	splits := []int{half}
+	for xLen := len(pubKey) - 32; xLen <= 32; xLen++ {
+		if xLen > 0 && xLen < len(pubKey) && xLen != half {
+			splits = append(splits, xLen)
+		}
+	}
+
+	for _, xLen := range splits {
+		x := new(big.Int).SetBytes(pubKey[:xLen])
+		y := new(big.Int).SetBytes(pubKey[xLen:])
+		if curve.IsOnCurve(x, y) {
+			return ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+		}
+	}
+
+	return ecdsa.PublicKey{}, ErrInvalidPubKey
+}
+
+// Sign signs a hash with a priv key - the nonce is derived from both as in RFC 6979, so the same key and hash always
+// give the same signature
+func Sign(privKey ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	curve := privKey.Curve
+	if curve == nil || privKey.D == nil {
+		return nil, ErrInvalidPrivKey
+	}
+	N := curve.Params().N
+	e := hashToInt(hash, N)
+
+	nonces := newNonceGenerator(privKey.D, hash, N)
+	for {
+		k := nonces.next()
+
+		x, _ := curve.ScalarBaseMult(k.FillBytes(make([]byte, PrivKeyLen)))
+		r := new(big.Int).Mod(x, N)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		// s = k^-1 (e + r d) mod N
+		s := new(big.Int).Mul(r, privKey.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, N))
+		s.Mod(s, N)
+		if s.Sign() == 0 {
+			continue
+		}
+
+		// -S is just as valid, only the lower one is accepted
+		if s.Cmp(halfOrder(N)) > 0 {
+			s.Sub(N, s)
+		}
+
+		signature := make([]byte, SignatureLen)
+		r.FillBytes(signature[:SignatureLen/2])
+		s.FillBytes(signature[SignatureLen/2:])
+		return signature, nil
+	}
+}
+
+// SignFor signs a hash with the priv key of a pub key, with the kind of signature the encoding of the pub key calls for
+func SignFor(pubKey []byte, privKey ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	if IsSchnorrPubKey(pubKey) {
+		return SignSchnorr(privKey, hash)
+	}
+
+	return Sign(privKey, hash)
+}
+
+// Verify determines if a signature of a hash was made by the priv key of a pub key, and is the one canonical
+// signature of it - a Schnorr signature if it is a Schnorr pub key
+func Verify(pubKey, hash, signature []byte) bool {
+	if IsSchnorrPubKey(pubKey) {
+		return VerifySchnorr(pubKey, hash, signature)
+	}
+
+	key, err := ParsePubKey(pubKey)
+	if err != nil {
+		return false
+	}
+	r, s, err := parseSignature(key.Curve, signature)
+	if err != nil {
+		return false
+	}
+
+	return ecdsa.Verify(&key, hash, r, s)
+}
+
+// CheckSignature gets why a signature by the priv key of a pub key is not canonical, nil if it is
+func CheckSignature(pubKey, signature []byte) error {
+	if IsSchnorrPubKey(pubKey) {
+		return checkSchnorr(pubKey, signature)
+	}
+
+	key, err := ParsePubKey(pubKey)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = parseSignature(key.Curve, signature)
+	return err
+}
+
+// parseSignature reads the R and S of a signature, which must be canonical on a curve
+func parseSignature(curve elliptic.Curve, signature []byte) (*big.Int, *big.Int, error) {
+	if len(signature) != SignatureLen {
+		return nil, nil, ErrSignatureLen
+	}
+
+	N := curve.Params().N
+	r := new(big.Int).SetBytes(signature[:SignatureLen/2])
+	s := new(big.Int).SetBytes(signature[SignatureLen/2:])
+	if r.Sign() == 0 || s.Sign() == 0 || r.Cmp(N) >= 0 || s.Cmp(N) >= 0 {
+		return nil, nil, ErrSignatureRange
+	}
+	if s.Cmp(halfOrder(N)) > 0 {
+		return nil, nil, ErrHighS
+	}
+
+	return r, s, nil
+}
+
+// halfOrder gets half the order of a curve, the most a low S can be
+func halfOrder(N *big.Int) *big.Int {
+	return new(big.Int).Rsh(N, 1)
+}
+
+// hashToInt converts a hash to a number below the order of a curve, keeping its leftmost bits as ECDSA does
+func hashToInt(hash []byte, N *big.Int) *big.Int {
+	e := new(big.Int).SetBytes(hash)
+	if excess := len(hash)*8 - N.BitLen(); excess > 0 {
+		e.Rsh(e, uint(excess))
+	}
+
+	return e
+}
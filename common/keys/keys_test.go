@@ -0,0 +1,124 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// fromHex decodes a hex string of a test vector
+func fromHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// TestSign compares with known signatures - P-256 from RFC 6979 A.2.5, with the S of "sample" negated to the low S,
+// and secp256k1 from the vectors bitcoin libraries share
+func TestSign(t *testing.T) {
+	for _, test := range []struct {
+		curve     Curve
+		privKey   string
+		message   string
+		nonce     string
+		signature string
+	}{
+		{P256, "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721", "sample",
+			"a6e3c57dd01abe90086538398355dd4c3b17aa873382b0f24d6129493d8aad60",
+			"efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716" +
+				"0834e36ad29a83bf2bc9385e491d6099c8fdf9d1ed67aa7ea5f51f93782857a9"},
+		{P256, "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721", "test",
+			"d16b6ae827f17175e040871a1c7ec3500192c4c92677336ec2537acaee0008e0",
+			"f1abb023518351cd71d881567b1ea663ed3efcf6c5132b354f28d3b0b7d38367" +
+				"019f4113742a2b14bd25926b49c649155f267e60d3814b4c0cc84250e46f0083"},
+		{Secp256k1, "0000000000000000000000000000000000000000000000000000000000000001", "Satoshi Nakamoto", "",
+			"934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d8" +
+				"2442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5"},
+		{Secp256k1, "0000000000000000000000000000000000000000000000000000000000000001",
+			"All those moments will be lost in time, like tears in rain. Time to die...", "",
+			"8600dbd41e348fe5c9465ab92d23e3db8b98b873beecd930736488696438cb6b" +
+				"547fe64427496db33bf66019dacbf0039c04199abb0122918601db38a72cfc21"},
+		{Secp256k1, "fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364140", "Satoshi Nakamoto", "",
+			"fd567d121db66e382991534ada77a6bd3106f0a1098c231e47993447cd6af2d0" +
+				"6b39cd0eb1bc8603e159ef5c20a5c8ad685a45b06ce9bebed3f153d10d93bed5"},
+		{Secp256k1, "f8b8af8ce3c7cca5e300d33939540c10d45ce001b8f252bfbc57ba0342904181", "Alan Turing", "",
+			"7063ae83e7f62bbb171798131b4a0564b956930092b33b07b395615d9ec7e15c" +
+				"58dfcc1e00a35e1572f366ffe34ba0fc47db1e7189759b9fb233c5b05ab388ea"},
+	} {
+		privKey, err := PrivateKeyFromBytes(test.curve, fromHex(t, test.privKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash := sha256.Sum256([]byte(test.message))
+
+		if test.nonce != "" {
+			nonce := newNonceGenerator(privKey.D, hash[:], privKey.Curve.Params().N).next()
+			if want := new(big.Int).SetBytes(fromHex(t, test.nonce)); nonce.Cmp(want) != 0 {
+				t.Errorf("%s %q: got nonce %x, want %x", test.curve, test.message, nonce, want)
+			}
+		}
+
+		signature, err := Sign(privKey, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fromHex(t, test.signature); !bytes.Equal(signature, want) {
+			t.Errorf("%s %q: got %x, want %x", test.curve, test.message, signature, want)
+		}
+		if !Verify(EncodePubKey(privKey.PublicKey), hash[:], signature) {
+			t.Errorf("%s %q: signature is invalid", test.curve, test.message)
+		}
+	}
+}
+
+// TestCheckSignature checks that the other signatures of a hash that ECDSA accepts are rejected
+func TestCheckSignature(t *testing.T) {
+	for _, curve := range []Curve{Secp256k1, P256} {
+		privKey, err := GenerateKey(curve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKey := EncodePubKey(privKey.PublicKey)
+		hash := sha256.Sum256([]byte("low s"))
+		signature, err := Sign(privKey, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckSignature(pubKey, signature); err != nil {
+			t.Fatalf("%s: %s", curve, err)
+		}
+
+		N := privKey.Curve.Params().N
+		r := new(big.Int).SetBytes(signature[:SignatureLen/2])
+		s := new(big.Int).SetBytes(signature[SignatureLen/2:])
+		join := func(r, s *big.Int) []byte {
+			return append(r.FillBytes(make([]byte, SignatureLen/2)), s.FillBytes(make([]byte, SignatureLen/2))...)
+		}
+
+		for _, test := range []struct {
+			name      string
+			signature []byte
+			err       error
+		}{
+			{"high s", join(r, new(big.Int).Sub(N, s)), ErrHighS},
+			{"zero r", join(big.NewInt(0), s), ErrSignatureRange},
+			{"s of the order", join(r, N), ErrSignatureRange},
+			{"short", signature[1:], ErrSignatureLen},
+			{"long", append([]byte{0}, signature...), ErrSignatureLen},
+		} {
+			if err := CheckSignature(pubKey, test.signature); err != test.err {
+				t.Errorf("%s %s: got %v, want %v", curve, test.name, err, test.err)
+			}
+			if Verify(pubKey, hash[:], test.signature) {
+				t.Errorf("%s %s: signature is valid", curve, test.name)
+			}
+		}
+	}
+}
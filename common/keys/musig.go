@@ -0,0 +1,355 @@
+package keys
+
+// musig is MuSig2 key aggregation - several Schnorr pub keys are combined into one aggregated Schnorr pub key, and the
+// cosigners holding their priv keys sign together in two rounds into one Schnorr signature for it. First each cosigner
+// makes a MuSigNonce and shares its public part, then each signs the hash with its own nonce and the aggregate of all
+// of them, and the partial signatures are combined. Nothing on the chain tells the signature apart from one of a
+// single key
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"sort"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+const (
+	// MuSigNonceLen is the length of the public part of a MuSigNonce, and of the aggregate of them - two compressed
+	// points
+	MuSigNonceLen = 2 * 33
+	// MuSigPartialLen is the length of a partial signature
+	MuSigPartialLen = 32
+	// MuSigSecretLen is the length of the secret part of a MuSigNonce - its two scalars
+	MuSigSecretLen = 2 * 32
+
+	// tags of the tagged hashes of key aggregation and signing
+	tagKeyAggList = "KeyAgg list"
+	tagKeyAggCoef = "KeyAgg coefficient"
+	tagNonceCoef  = "MuSig/noncecoef"
+)
+
+var (
+	// ErrNotCosigner is returned when signing with a priv key whose pub key is not one of the aggregated ones
+	ErrNotCosigner = errors.New("Key is not one of the aggregated keys")
+	// ErrNonceUsed is returned when signing twice with a MuSigNonce, which would reveal the priv key
+	ErrNonceUsed = errors.New("MuSig nonce has already been used")
+	// ErrInvalidNonce is returned when the public part of a MuSigNonce is malformed
+	ErrInvalidNonce = errors.New("Invalid MuSig nonce")
+)
+
+// MuSigNonce is the secret nonce of one cosigner for one signature -
+// Public - the nonce points to share with the other cosigners
+// k1, k2 - the secret scalars of the nonce points, cleared once used
+type MuSigNonce struct {
+	Public []byte
+	k1     secp256k1.ModNScalar
+	k2     secp256k1.ModNScalar
+	used   bool
+}
+
+// keyAgg is the aggregate of a set of pub keys -
+// Q - the aggregated point, with the Y it has before being made even
+// negate - whether Q has an odd Y, so the aggregated pub key is -Q
+// list - the hash of the sorted Xs of the pub keys
+type keyAgg struct {
+	Q      secp256k1.JacobianPoint
+	negate bool
+	list   []byte
+}
+
+// AggregatePubKeys combines Schnorr pub keys into the Schnorr pub key the cosigners sign for together - the order of
+// the pub keys doesn't matter
+func AggregatePubKeys(pubKeys [][]byte) ([]byte, error) {
+	agg, err := aggregateKeys(pubKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	qx := agg.Q.X.Bytes()
+	return append([]byte{SchnorrPubKey}, qx[:]...), nil
+}
+
+// NewMuSigNonce makes a random MuSigNonce for signing one hash
+func NewMuSigNonce() (*MuSigNonce, error) {
+	nonce := &MuSigNonce{}
+	for _, k := range []*secp256k1.ModNScalar{&nonce.k1, &nonce.k2} {
+		random := make([]byte, 32)
+		for k.IsZero() {
+			if _, err := rand.Read(random); err != nil {
+				return nil, err
+			}
+			k.SetByteSlice(random)
+		}
+	}
+	nonce.setPublic()
+
+	return nonce, nil
+}
+
+// MuSigNonceFromSecret makes the MuSigNonce of the secret part of one, as kept between the rounds of signing
+func MuSigNonceFromSecret(secret []byte) (*MuSigNonce, error) {
+	if len(secret) != MuSigSecretLen {
+		return nil, ErrInvalidNonce
+	}
+
+	nonce := &MuSigNonce{}
+	for i, k := range []*secp256k1.ModNScalar{&nonce.k1, &nonce.k2} {
+		if overflow := k.SetByteSlice(secret[i*32 : (i+1)*32]); overflow || k.IsZero() {
+			return nil, ErrInvalidNonce
+		}
+	}
+	nonce.setPublic()
+
+	return nonce, nil
+}
+
+// Secret gets the secret part of a MuSigNonce, to keep it until the other cosigners have shared theirs - it must be
+// used for one signature only, like the MuSigNonce itself
+func (nonce *MuSigNonce) Secret() ([]byte, error) {
+	if nonce.used {
+		return nil, ErrNonceUsed
+	}
+
+	k1, k2 := nonce.k1.Bytes(), nonce.k2.Bytes()
+	return append(k1[:], k2[:]...), nil
+}
+
+// setPublic computes the public part of a MuSigNonce from its secret scalars
+func (nonce *MuSigNonce) setPublic() {
+	nonce.Public = nil
+	for _, k := range []*secp256k1.ModNScalar{&nonce.k1, &nonce.k2} {
+		R := baseMult(k)
+		nonce.Public = append(nonce.Public, secp256k1.NewPublicKey(&R.X, &R.Y).SerializeCompressed()...)
+	}
+}
+
+// AggregateNonces combines the public parts of the MuSigNonces of every cosigner
+func AggregateNonces(pubNonces [][]byte) ([]byte, error) {
+	var R1, R2 secp256k1.JacobianPoint
+	for _, pubNonce := range pubNonces {
+		R1i, R2i, err := parseMuSigNonce(pubNonce)
+		if err != nil {
+			return nil, err
+		}
+
+		addPoint(&R1, &R1i)
+		addPoint(&R2, &R2i)
+	}
+
+	var aggNonce []byte
+	for _, R := range []*secp256k1.JacobianPoint{&R1, &R2} {
+		if isInfinity(R) {
+			return nil, ErrInvalidNonce
+		}
+		R.ToAffine()
+		aggNonce = append(aggNonce, secp256k1.NewPublicKey(&R.X, &R.Y).SerializeCompressed()...)
+	}
+
+	return aggNonce, nil
+}
+
+// MuSigSign makes the partial signature of a cosigner of a 32 byte hash -
+// nonce - of the cosigner, which can't be used again
+// pubKeys - every aggregated Schnorr pub key, the priv key's among them
+// aggNonce - the aggregate of the nonces of every cosigner
+func MuSigSign(privKey ecdsa.PrivateKey, nonce *MuSigNonce, pubKeys [][]byte, aggNonce, hash []byte) ([]byte, error) {
+	if nonce.used {
+		return nil, ErrNonceUsed
+	}
+	if CurveOf(privKey.PublicKey) != Secp256k1 {
+		return nil, ErrNotSecp256k1
+	}
+	if len(hash) != 32 {
+		return nil, errors.New("Schnorr signatures sign 32 byte hashes")
+	}
+
+	agg, err := aggregateKeys(pubKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	var d secp256k1.ModNScalar
+	if overflow := d.SetByteSlice(PrivateKeyBytes(privKey)); overflow || d.IsZero() {
+		return nil, ErrInvalidPrivKey
+	}
+	P := baseMult(&d)
+	px := P.X.Bytes()
+	if !hasKey(pubKeys, px[:]) {
+		return nil, ErrNotCosigner
+	}
+	// The pub keys are the points with even Y, and the aggregated pub key is -Q if Q has an odd Y
+	if P.Y.IsOdd() != agg.negate {
+		d.Negate()
+	}
+
+	R, b, e, err := agg.session(aggNonce, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// The nonce is spent whether or not signing goes on, a second signature with it would give the priv key away
+	k1, k2 := nonce.k1, nonce.k2
+	nonce.k1.Zero()
+	nonce.k2.Zero()
+	nonce.used = true
+	if R.Y.IsOdd() {
+		k1.Negate()
+		k2.Negate()
+	}
+
+	// s = k1 + b k2 + e a d
+	a := agg.coefficient(px[:])
+	s := new(secp256k1.ModNScalar).Mul2(&e, &a).Mul(&d)
+	s.Add(k2.Mul(&b)).Add(&k1)
+	sBytes := s.Bytes()
+
+	return sBytes[:], nil
+}
+
+// CombineMuSig combines the partial signatures of every cosigner of a 32 byte hash into the Schnorr signature of the
+// aggregate of their pub keys
+func CombineMuSig(pubKeys [][]byte, aggNonce, hash []byte, partials [][]byte) ([]byte, error) {
+	agg, err := aggregateKeys(pubKeys)
+	if err != nil {
+		return nil, err
+	}
+	R, _, _, err := agg.session(aggNonce, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var s secp256k1.ModNScalar
+	for _, partial := range partials {
+		var si secp256k1.ModNScalar
+		if len(partial) != MuSigPartialLen {
+			return nil, errors.New("Invalid MuSig partial signature")
+		}
+		if overflow := si.SetByteSlice(partial); overflow {
+			return nil, errors.New("Invalid MuSig partial signature")
+		}
+		s.Add(&si)
+	}
+
+	rx := R.X.Bytes()
+	sBytes := s.Bytes()
+	return append(rx[:], sBytes[:]...), nil
+}
+
+// aggregateKeys computes the keyAgg of Schnorr pub keys, sorted so their order doesn't matter
+func aggregateKeys(pubKeys [][]byte) (*keyAgg, error) {
+	if len(pubKeys) == 0 {
+		return nil, errors.New("No keys to aggregate")
+	}
+
+	var xs [][]byte
+	for _, pubKey := range pubKeys {
+		if !IsSchnorrPubKey(pubKey) {
+			return nil, ErrInvalidPubKey
+		}
+		xs = append(xs, pubKey[1:])
+	}
+	sort.Slice(xs, func(i, j int) bool { return bytes.Compare(xs[i], xs[j]) < 0 })
+
+	agg := &keyAgg{list: taggedHash(tagKeyAggList, xs...)}
+	for _, x := range xs {
+		P, err := liftX(x)
+		if err != nil {
+			return nil, err
+		}
+
+		var aP secp256k1.JacobianPoint
+		a := agg.coefficient(x)
+		secp256k1.ScalarMultNonConst(&a, &P, &aP)
+		addPoint(&agg.Q, &aP)
+	}
+	if isInfinity(&agg.Q) {
+		return nil, ErrInvalidPubKey
+	}
+
+	agg.Q.ToAffine()
+	agg.negate = agg.Q.Y.IsOdd()
+	return agg, nil
+}
+
+// coefficient computes the factor the pub key with an X is multiplied by in the aggregate, which keeps a cosigner
+// from choosing its key to cancel out the others'
+func (agg *keyAgg) coefficient(x []byte) secp256k1.ModNScalar {
+	var a secp256k1.ModNScalar
+	a.SetByteSlice(taggedHash(tagKeyAggCoef, agg.list, x))
+
+	return a
+}
+
+// session computes the values of signing a hash with an aggregated nonce - the nonce point R = R1 + b R2, b, and the
+// challenge e of the signature
+func (agg *keyAgg) session(aggNonce, hash []byte) (secp256k1.JacobianPoint, secp256k1.ModNScalar, secp256k1.ModNScalar, error) {
+	var R secp256k1.JacobianPoint
+	var b, e secp256k1.ModNScalar
+
+	R1, R2, err := parseMuSigNonce(aggNonce)
+	if err != nil {
+		return R, b, e, err
+	}
+
+	qx := agg.Q.X.Bytes()
+	b.SetByteSlice(taggedHash(tagNonceCoef, aggNonce, qx[:], hash))
+
+	var bR2 secp256k1.JacobianPoint
+	secp256k1.ScalarMultNonConst(&b, &R2, &bR2)
+	secp256k1.AddNonConst(&R1, &bR2, &R)
+	if isInfinity(&R) {
+		return R, b, e, ErrInvalidNonce
+	}
+	R.ToAffine()
+
+	rx := R.X.Bytes()
+	e = challenge(rx[:], qx[:], hash)
+	return R, b, e, nil
+}
+
+// parseMuSigNonce reads the two compressed points of the public part of a MuSigNonce
+func parseMuSigNonce(pubNonce []byte) (secp256k1.JacobianPoint, secp256k1.JacobianPoint, error) {
+	var R1, R2 secp256k1.JacobianPoint
+	if len(pubNonce) != MuSigNonceLen {
+		return R1, R2, ErrInvalidNonce
+	}
+
+	key1, err := secp256k1.ParsePubKey(pubNonce[:MuSigNonceLen/2])
+	if err != nil {
+		return R1, R2, ErrInvalidNonce
+	}
+	key2, err := secp256k1.ParsePubKey(pubNonce[MuSigNonceLen/2:])
+	if err != nil {
+		return R1, R2, ErrInvalidNonce
+	}
+
+	key1.AsJacobian(&R1)
+	key2.AsJacobian(&R2)
+	return R1, R2, nil
+}
+
+// hasKey determines if the X of a point is the X of one of the Schnorr pub keys
+func hasKey(pubKeys [][]byte, x []byte) bool {
+	for _, pubKey := range pubKeys {
+		if IsSchnorrPubKey(pubKey) && bytes.Equal(pubKey[1:], x) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addPoint adds a point to a sum
+func addPoint(sum, point *secp256k1.JacobianPoint) {
+	var next secp256k1.JacobianPoint
+	secp256k1.AddNonConst(sum, point, &next)
+	sum.Set(&next)
+}
+
+// isInfinity determines if a point is the point at infinity
+func isInfinity(point *secp256k1.JacobianPoint) bool {
+	return (point.X.IsZero() && point.Y.IsZero()) || point.Z.IsZero()
+}
@@ -0,0 +1,100 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"testing"
+)
+
+// TestMuSig signs a hash with three cosigners, checking the combined signature is a valid Schnorr signature of the
+// aggregated pub key whatever order the pub keys are given in
+func TestMuSig(t *testing.T) {
+	var privKeys []ecdsa.PrivateKey
+	var pubKeys [][]byte
+	for i := 0; i < 3; i++ {
+		privKey, err := GenerateKey(Secp256k1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		privKeys = append(privKeys, privKey)
+		pubKeys = append(pubKeys, EncodeSchnorrPubKey(privKey.PublicKey))
+	}
+	aggPubKey, err := AggregatePubKeys(pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed := [][]byte{pubKeys[2], pubKeys[1], pubKeys[0]}
+	if got, err := AggregatePubKeys(reversed); err != nil || string(got) != string(aggPubKey) {
+		t.Fatalf("got aggregated pub key %x, %v for the reversed pub keys, want %x", got, err, aggPubKey)
+	}
+
+	// Round one - every cosigner shares a nonce
+	var nonces []*MuSigNonce
+	var pubNonces [][]byte
+	for range privKeys {
+		nonce, err := NewMuSigNonce()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonces = append(nonces, nonce)
+		pubNonces = append(pubNonces, nonce.Public)
+	}
+	aggNonce, err := AggregateNonces(pubNonces)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A cosigner may keep only the secret part of its nonce between the rounds
+	secret, err := nonces[1].Secret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonces[1], err = MuSigNonceFromSecret(secret); err != nil || string(nonces[1].Public) != string(pubNonces[1]) {
+		t.Fatalf("got nonce %x, %v from the secret, want %x", nonces[1].Public, err, pubNonces[1])
+	}
+
+	// Round two - every cosigner signs, each given the pub keys in another order
+	hash := sha256.Sum256([]byte("musig"))
+	var partials [][]byte
+	for i, privKey := range privKeys {
+		order := pubKeys
+		if i%2 == 1 {
+			order = reversed
+		}
+		partial, err := MuSigSign(privKey, nonces[i], order, aggNonce, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		partials = append(partials, partial)
+	}
+
+	signature, err := CombineMuSig(pubKeys, aggNonce, hash[:], partials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySchnorr(aggPubKey, hash[:], signature) {
+		t.Fatal("combined signature is invalid")
+	}
+
+	if _, err := MuSigSign(privKeys[0], nonces[0], pubKeys, aggNonce, hash[:]); err != ErrNonceUsed {
+		t.Errorf("got %v signing with a used nonce, want %v", err, ErrNonceUsed)
+	}
+	if _, err := nonces[1].Secret(); err != ErrNonceUsed {
+		t.Errorf("got %v getting the secret of a used nonce, want %v", err, ErrNonceUsed)
+	}
+	if signature, err := CombineMuSig(pubKeys, aggNonce, hash[:], partials[:2]); err != nil || VerifySchnorr(aggPubKey, hash[:], signature) {
+		t.Errorf("signature without a cosigner's partial signature is valid, %v", err)
+	}
+
+	outsider, err := GenerateKey(Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := NewMuSigNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MuSigSign(outsider, nonce, pubKeys, aggNonce, hash[:]); err != ErrNotCosigner {
+		t.Errorf("got %v signing with a key that isn't aggregated, want %v", err, ErrNotCosigner)
+	}
+}
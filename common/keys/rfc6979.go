@@ -0,0 +1,78 @@
+package keys
+
+// rfc6979 is deriving ECDSA nonces from the priv key and hash being signed (RFC 6979 section 3.2, with HMAC-SHA256),
+// so signing needs no randomness and never reuses a nonce for different hashes
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"math/big"
+)
+
+// nonceGenerator gives the nonces of signing one hash, in order -
+// k, v - the HMAC key and value of the RFC 6979 state
+// N - the order of the curve
+type nonceGenerator struct {
+	k []byte
+	v []byte
+	N *big.Int
+}
+
+// newNonceGenerator makes the nonceGenerator of a priv key and hash on a curve of order N
+func newNonceGenerator(d *big.Int, hash []byte, N *big.Int) *nonceGenerator {
+	rolen := (N.BitLen() + 7) / 8
+	seed := append(d.FillBytes(make([]byte, rolen)), bits2octets(hash, N)...)
+
+	g := &nonceGenerator{k: make([]byte, sha256.Size), v: make([]byte, sha256.Size), N: N}
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+
+	g.k = g.mac(g.v, []byte{0x00}, seed)
+	g.v = g.mac(g.v)
+	g.k = g.mac(g.v, []byte{0x01}, seed)
+	g.v = g.mac(g.v)
+
+	return g
+}
+
+// next gets the next nonce, in 1 to N-1
+func (g *nonceGenerator) next() *big.Int {
+	rolen := (g.N.BitLen() + 7) / 8
+	for {
+		var t []byte
+		for len(t) < rolen {
+			g.v = g.mac(g.v)
+			t = append(t, g.v...)
+		}
+		nonce := hashToInt(t[:rolen], g.N)
+
+		// Step the state either way, so a nonce rejected by the caller isn't given again
+		g.k = g.mac(g.v, []byte{0x00})
+		g.v = g.mac(g.v)
+
+		if nonce.Sign() > 0 && nonce.Cmp(g.N) < 0 {
+			return nonce
+		}
+	}
+}
+
+// mac computes the HMAC-SHA256 of parts joined together with the current key
+func (g *nonceGenerator) mac(parts ...[]byte) []byte {
+	h := hmac.New(sha256.New, g.k)
+	for _, part := range parts {
+		h.Write(part)
+	}
+
+	return h.Sum(nil)
+}
+
+// bits2octets converts a hash to a number below N, written at the length of N
+func bits2octets(hash []byte, N *big.Int) []byte {
+	z := hashToInt(hash, N)
+	if z.Cmp(N) >= 0 {
+		z.Sub(z, N)
+	}
+
+	return z.FillBytes(make([]byte, (N.BitLen()+7)/8))
+}
@@ -0,0 +1,274 @@
+package keys
+
+// schnorr is BIP340 Schnorr signatures on secp256k1 - pub keys are only the X of the point, whose Y is even, and
+// signatures are the X of the nonce point and S. Several signatures can be verified together faster than one by one
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+const (
+	// SchnorrPubKey is the first byte of an encoded Schnorr pub key, in place of the Curve of ecdsa pub keys
+	SchnorrPubKey = byte(0x03)
+	// SchnorrPubKeyLen is the length of an encoded Schnorr pub key - SchnorrPubKey and X
+	SchnorrPubKeyLen = 1 + 32
+
+	// tags of the tagged hashes of BIP340
+	tagAux       = "BIP0340/aux"
+	tagNonce     = "BIP0340/nonce"
+	tagChallenge = "BIP0340/challenge"
+)
+
+// ErrNotSecp256k1 is returned when a Schnorr key is requested on a curve other than secp256k1
+var ErrNotSecp256k1 = errors.New("Schnorr keys must be on secp256k1")
+
+// SchnorrBatch collects Schnorr signatures to verify together
+type SchnorrBatch struct {
+	items []schnorrItem
+}
+
+// schnorrItem is a Schnorr signature in a SchnorrBatch, parsed
+type schnorrItem struct {
+	P secp256k1.JacobianPoint
+	R secp256k1.JacobianPoint
+	s secp256k1.ModNScalar
+	e secp256k1.ModNScalar
+}
+
+// EncodeSchnorrPubKey writes a pub key on secp256k1 as a Schnorr pub key, SchnorrPubKey and X
+func EncodeSchnorrPubKey(pubKey ecdsa.PublicKey) []byte {
+	encoded := make([]byte, SchnorrPubKeyLen)
+	encoded[0] = SchnorrPubKey
+	pubKey.X.FillBytes(encoded[1:])
+
+	return encoded
+}
+
+// IsSchnorrPubKey determines if a pub key signs with Schnorr signatures rather than ecdsa
+func IsSchnorrPubKey(pubKey []byte) bool {
+	return len(pubKey) == SchnorrPubKeyLen && pubKey[0] == SchnorrPubKey
+}
+
+// parseSchnorrPubKey reads a Schnorr pub key as the point with its X and an even Y
+func parseSchnorrPubKey(pubKey []byte) (ecdsa.PublicKey, error) {
+	point, err := liftX(pubKey[1:])
+	if err != nil {
+		return ecdsa.PublicKey{}, err
+	}
+
+	return *secp256k1.NewPublicKey(&point.X, &point.Y).ToECDSA(), nil
+}
+
+// SignSchnorr signs a 32 byte hash with a priv key on secp256k1 - with no auxiliary randomness, so the same key and
+// hash always give the same signature
+func SignSchnorr(privKey ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	if CurveOf(privKey.PublicKey) != Secp256k1 {
+		return nil, ErrNotSecp256k1
+	}
+	if len(hash) != 32 {
+		return nil, errors.New("Schnorr signatures sign 32 byte hashes")
+	}
+
+	var d secp256k1.ModNScalar
+	if overflow := d.SetByteSlice(PrivateKeyBytes(privKey)); overflow || d.IsZero() {
+		return nil, ErrInvalidPrivKey
+	}
+	P := baseMult(&d)
+	if P.Y.IsOdd() {
+		d.Negate()
+	}
+	px := P.X.Bytes()
+
+	// The nonce hashes the key with the hash, masked by the (empty) auxiliary randomness
+	dBytes := d.Bytes()
+	t := taggedHash(tagAux, make([]byte, 32))
+	for i := range t {
+		t[i] ^= dBytes[i]
+	}
+
+	var k secp256k1.ModNScalar
+	k.SetByteSlice(taggedHash(tagNonce, t, px[:], hash))
+	if k.IsZero() {
+		return nil, errors.New("Schnorr nonce is zero")
+	}
+	R := baseMult(&k)
+	if R.Y.IsOdd() {
+		k.Negate()
+	}
+	rx := R.X.Bytes()
+
+	e := challenge(rx[:], px[:], hash)
+
+	// s = k + e d
+	s := new(secp256k1.ModNScalar).Mul2(&e, &d).Add(&k)
+	sBytes := s.Bytes()
+
+	return append(rx[:], sBytes[:]...), nil
+}
+
+// VerifySchnorr determines if a Schnorr signature of a 32 byte hash was made by the priv key of a Schnorr pub key
+func VerifySchnorr(pubKey, hash, signature []byte) bool {
+	item, err := parseSchnorr(pubKey, hash, signature)
+	if err != nil {
+		return false
+	}
+
+	// R = s G - e P must be the nonce point of the signature
+	var eP, R secp256k1.JacobianPoint
+	negE := new(secp256k1.ModNScalar).NegateVal(&item.e)
+	secp256k1.ScalarMultNonConst(negE, &item.P, &eP)
+	sG := baseMult(&item.s)
+	secp256k1.AddNonConst(&sG, &eP, &R)
+	if (R.X.IsZero() && R.Y.IsZero()) || R.Z.IsZero() {
+		return false
+	}
+	R.ToAffine()
+
+	return !R.Y.IsOdd() && R.X.Equals(&item.R.X)
+}
+
+// checkSchnorr gets why a Schnorr signature by the priv key of a Schnorr pub key is malformed, nil if it isn't - the
+// X of its nonce point must be on the curve and S below its order, so there is one encoding of the signature
+func checkSchnorr(pubKey, signature []byte) error {
+	_, err := parseSchnorr(pubKey, make([]byte, 32), signature)
+	return err
+}
+
+// NewSchnorrBatch makes an empty SchnorrBatch
+func NewSchnorrBatch() *SchnorrBatch {
+	return &SchnorrBatch{}
+}
+
+// Add adds a Schnorr signature of a 32 byte hash to a SchnorrBatch, failing at once if it is malformed
+func (b *SchnorrBatch) Add(pubKey, hash, signature []byte) error {
+	item, err := parseSchnorr(pubKey, hash, signature)
+	if err != nil {
+		return err
+	}
+
+	b.items = append(b.items, item)
+	return nil
+}
+
+// Len gets the number of signatures in a SchnorrBatch
+func (b *SchnorrBatch) Len() int {
+	return len(b.items)
+}
+
+// Verify determines if every signature in a SchnorrBatch is valid - checks that the sum of each signature equation
+// times a random factor holds, which one bad signature breaks with overwhelming probability
+func (b *SchnorrBatch) Verify() bool {
+	if len(b.items) == 0 {
+		return true
+	}
+
+	// sum(a_i s_i) G = sum(a_i R_i) + sum(a_i e_i P_i), with a_0 = 1
+	var sSum secp256k1.ModNScalar
+	var sum, term, next secp256k1.JacobianPoint
+	for i, item := range b.items {
+		var a secp256k1.ModNScalar
+		a.SetInt(1)
+		if i > 0 {
+			random := make([]byte, 32)
+			if _, err := rand.Read(random); err != nil {
+				return false
+			}
+			a.SetByteSlice(random)
+		}
+
+		sSum.Add(new(secp256k1.ModNScalar).Mul2(&a, &item.s))
+
+		secp256k1.ScalarMultNonConst(&a, &item.R, &term)
+		secp256k1.AddNonConst(&sum, &term, &next)
+		sum.Set(&next)
+		ae := new(secp256k1.ModNScalar).Mul2(&a, &item.e)
+		secp256k1.ScalarMultNonConst(ae, &item.P, &term)
+		secp256k1.AddNonConst(&sum, &term, &next)
+		sum.Set(&next)
+	}
+
+	lhs := baseMult(&sSum)
+	return lhs.EquivalentNonConst(&sum)
+}
+
+// parseSchnorr reads the points and scalars of a Schnorr signature, which must be in range
+func parseSchnorr(pubKey, hash, signature []byte) (schnorrItem, error) {
+	var item schnorrItem
+	if !IsSchnorrPubKey(pubKey) {
+		return item, ErrInvalidPubKey
+	}
+	if len(signature) != SignatureLen || len(hash) != 32 {
+		return item, ErrSignatureLen
+	}
+
+	P, err := liftX(pubKey[1:])
+	if err != nil {
+		return item, ErrInvalidPubKey
+	}
+	R, err := liftX(signature[:32])
+	if err != nil {
+		return item, ErrSignatureRange
+	}
+	if overflow := item.s.SetByteSlice(signature[32:]); overflow {
+		return item, ErrSignatureRange
+	}
+
+	item.P, item.R = P, R
+	item.e = challenge(signature[:32], pubKey[1:], hash)
+	return item, nil
+}
+
+// liftX gets the point with an X and even Y
+func liftX(x []byte) (secp256k1.JacobianPoint, error) {
+	var point secp256k1.JacobianPoint
+	if len(x) != 32 {
+		return point, ErrInvalidPubKey
+	}
+	if overflow := point.X.SetByteSlice(x); overflow {
+		return point, ErrInvalidPubKey
+	}
+	if !secp256k1.DecompressY(&point.X, false, &point.Y) {
+		return point, ErrInvalidPubKey
+	}
+
+	point.Y.Normalize()
+	point.Z.SetInt(1)
+	return point, nil
+}
+
+// baseMult computes k G in affine coordinates
+func baseMult(k *secp256k1.ModNScalar) secp256k1.JacobianPoint {
+	var point secp256k1.JacobianPoint
+	secp256k1.ScalarBaseMultNonConst(k, &point)
+	point.ToAffine()
+
+	return point
+}
+
+// challenge computes the challenge e of a Schnorr signature, from the X of its nonce point and pub key and the hash
+func challenge(rx, px, hash []byte) secp256k1.ModNScalar {
+	var e secp256k1.ModNScalar
+	e.SetByteSlice(taggedHash(tagChallenge, rx, px, hash))
+
+	return e
+}
+
+// taggedHash computes the BIP340 tagged hash of parts joined together - sha256 of the sha256 of the tag twice, then
+// the parts
+func taggedHash(tag string, parts ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, part := range parts {
+		h.Write(part)
+	}
+
+	return h.Sum(nil)
+}
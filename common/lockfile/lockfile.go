@@ -0,0 +1,34 @@
+package lockfile
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrLocked is returned when another process already holds the lock
+var ErrLocked = errors.New("Lock is held by another process")
+
+// Lock is an exclusive, inter-process lock backed by a file
+type Lock struct {
+	file *os.File
+}
+
+// Acquire takes the lock at a given path, creating the file if necessary, or returns ErrLocked
+func Acquire(path string) (*Lock, error) {
+	file, err := openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &Lock{file}, nil
+}
+
+// Release gives up the lock
+func (l *Lock) Release() error {
+	return unlockFile(l.file)
+}
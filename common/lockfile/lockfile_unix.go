@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+package lockfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// openLockFile opens (or creates) the file backing a Lock
+func openLockFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+}
+
+// lockFile takes an exclusive flock on the file without blocking -
+// the kernel drops it if the process dies, so a crash never leaves a stale lock
+func lockFile(file *os.File) error {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return ErrLocked
+	}
+
+	return err
+}
+
+// unlockFile releases the flock on the file and closes it
+func unlockFile(file *os.File) error {
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_UN); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
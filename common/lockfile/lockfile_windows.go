@@ -0,0 +1,33 @@
+//go:build windows
+// +build windows
+
+package lockfile
+
+import (
+	"os"
+)
+
+// openLockFile creates the file backing a Lock, failing if it already exists -
+// a crashed process leaves the file behind and it has to be removed by hand
+func openLockFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return nil, ErrLocked
+	}
+
+	return file, err
+}
+
+// lockFile is a no-op, exclusive creation of the file is the lock
+func lockFile(file *os.File) error {
+	return nil
+}
+
+// unlockFile closes and removes the file so the lock can be taken again
+func unlockFile(file *os.File) error {
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(file.Name())
+}
@@ -0,0 +1,93 @@
+package muhash
+
+// MuHash3072 set hash - elements are hashed to numbers mod a 3072 bit prime and multiplied together, so the hash of a
+// set can be updated by adding or removing single elements in any order
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+const (
+	// byteLen is the size of the numbers being multiplied
+	byteLen = 384
+)
+
+var (
+	// prime is 2^3072 - 1103717, the largest 3072 bit safe prime
+	prime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 3072), big.NewInt(1103717))
+
+	// ErrInvalidLength is returned when unmarshaling data that isn't a MuHash
+	ErrInvalidLength = errors.New("Invalid MuHash length")
+)
+
+// MuHash is the hash of a set, kept as a fraction so removing an element doesn't need a modular inverse
+type MuHash struct {
+	numerator   *big.Int
+	denominator *big.Int
+}
+
+// New creates the MuHash of the empty set
+func New() *MuHash {
+	return &MuHash{big.NewInt(1), big.NewInt(1)}
+}
+
+// Insert adds an element to the set
+func (m *MuHash) Insert(data []byte) {
+	m.numerator.Mul(m.numerator, toNum(data))
+	m.numerator.Mod(m.numerator, prime)
+}
+
+// Remove takes an element out of the set
+func (m *MuHash) Remove(data []byte) {
+	m.denominator.Mul(m.denominator, toNum(data))
+	m.denominator.Mod(m.denominator, prime)
+}
+
+// Sum gets the 32 byte hash of the set
+func (m *MuHash) Sum() []byte {
+	result := new(big.Int).ModInverse(m.denominator, prime)
+	result.Mul(result, m.numerator)
+	result.Mod(result, prime)
+
+	hash := sha256.Sum256(result.FillBytes(make([]byte, byteLen)))
+	return hash[:]
+}
+
+// MarshalBinary converts the MuHash into a []byte for database compatibility
+func (m *MuHash) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 2*byteLen)
+	m.numerator.FillBytes(data[:byteLen])
+	m.denominator.FillBytes(data[byteLen:])
+
+	return data, nil
+}
+
+// UnmarshalBinary sets the MuHash from a []byte created by MarshalBinary
+func (m *MuHash) UnmarshalBinary(data []byte) error {
+	if len(data) != 2*byteLen {
+		return ErrInvalidLength
+	}
+
+	m.numerator = new(big.Int).SetBytes(data[:byteLen])
+	m.denominator = new(big.Int).SetBytes(data[byteLen:])
+	return nil
+}
+
+// toNum hashes an element to a number mod prime, expanding its sha256 with sha256 in counter mode
+func toNum(data []byte) *big.Int {
+	seed := sha256.Sum256(data)
+	expanded := make([]byte, 0, byteLen)
+	counter := make([]byte, 4)
+
+	for i := uint32(0); len(expanded) < byteLen; i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		block := sha256.Sum256(append(seed[:], counter...))
+		expanded = append(expanded, block[:]...)
+	}
+
+	num := new(big.Int).SetBytes(expanded)
+	return num.Mod(num, prime)
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+const (
+	// DefaultDataDir is the data directory used when none is specified
+	DefaultDataDir = "./tmp"
+	// DefaultNetwork is the network used when none is specified
+	DefaultNetwork = "mainnet"
+	// DefaultBackend is the storage backend used when none is specified
+	DefaultBackend = "badger"
+
+	// DefaultUTXOCacheSize is the memory limit of the UTXO cache in MiB used when none is specified
+	DefaultUTXOCacheSize = 16
+
+	// MinPruneDepth is the number of most recent Blocks whose data is always kept when pruning,
+	// so the tip of the chain can still be read and validated against
+	MinPruneDepth = 10
+
+	// blocksDir is the name of the directory holding block data inside a network directory
+	blocksDir = "blocks"
+	// walletFile is the name of the wallet file inside a network directory
+	walletFile = "wallets.dat"
+)
+
+// Config holds the settings that locate and describe the data of a node -
+// DataDir - root directory of all data
+// Params - the network whose data is used
+// Backend - name of the storage backend for the chain database
+// PruneDepth - number of most recent Blocks whose data is kept, older ones keep only their header (0 keeps all)
+// UTXOCacheSize - memory limit in MiB of the UTXO changes kept before writing them to the chain database
+type Config struct {
+	DataDir       string
+	Params        *Params
+	Backend       string
+	PruneDepth    int
+	UTXOCacheSize int
+}
+
+// InitConfig creates a new Config, given the data directory, network name and storage backend
+func InitConfig(dataDir, network, backend string) (*Config, error) {
+	params, ok := GetParams(network)
+	if !ok {
+		return nil, fmt.Errorf("Unknown network %q", network)
+	}
+
+	if dataDir == "" {
+		dataDir = DefaultDataDir
+	}
+	if backend == "" {
+		backend = DefaultBackend
+	}
+
+	return &Config{DataDir: dataDir, Params: params, Backend: backend, UTXOCacheSize: DefaultUTXOCacheSize}, nil
+}
+
+// DefaultConfig creates the Config used when nothing is specified
+func DefaultConfig() *Config {
+	return &Config{DataDir: DefaultDataDir, Params: &MainNetParams, Backend: DefaultBackend, UTXOCacheSize: DefaultUTXOCacheSize}
+}
+
+// SetPruneDepth enables pruning the data of Blocks deeper than a given depth (0 disables pruning)
+func (cfg *Config) SetPruneDepth(depth int) error {
+	if depth != 0 && depth < MinPruneDepth {
+		return fmt.Errorf("Prune depth must be 0 or at least %d", MinPruneDepth)
+	}
+
+	cfg.PruneDepth = depth
+	return nil
+}
+
+// SetUTXOCacheSize sets the memory limit of the UTXO cache in MiB (0 writes the changes of every Block right away)
+func (cfg *Config) SetUTXOCacheSize(size int) error {
+	if size < 0 {
+		return fmt.Errorf("UTXO cache size must not be negative")
+	}
+
+	cfg.UTXOCacheSize = size
+	return nil
+}
+
+// NetworkDir gets the directory holding the data of the network -
+// the main network uses the data directory itself, other networks use a subdirectory named after them
+func (cfg *Config) NetworkDir() string {
+	if cfg.Params.Name == MainNetParams.Name {
+		return cfg.DataDir
+	}
+
+	return filepath.Join(cfg.DataDir, cfg.Params.Name)
+}
+
+// ChainDir gets the directory holding the chain database
+func (cfg *Config) ChainDir() string {
+	return filepath.Join(cfg.NetworkDir(), blocksDir)
+}
+
+// WalletFile gets the path of the wallet file
+func (cfg *Config) WalletFile() string {
+	return filepath.Join(cfg.NetworkDir(), walletFile)
+}
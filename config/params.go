@@ -0,0 +1,74 @@
+package config
+
+// Params are the settings that differ between networks -
+// WIFPrefix - version byte of priv keys exported in wallet import format, so they aren't imported on another network
+// Bech32HRP - human-readable prefix of Bech32 addresses, so they aren't paid on another network
+// UTXOSnapshots - the UTXO set dumps a node of the network can be bootstrapped from
+type Params struct {
+	Name          string
+	WIFPrefix     byte
+	Bech32HRP     string
+	UTXOSnapshots []UTXOSnapshot
+}
+
+// UTXOSnapshot pins the content of the UTXO set at a Block, so a dump of it can be trusted without the Blocks -
+// BlockHash - hex hash of the Block at Height
+// ContentHash - hex hash of the UTXO set as written by dump-utxo
+type UTXOSnapshot struct {
+	Height      int
+	BlockHash   string
+	ContentHash string
+}
+
+var (
+	// MainNetParams are the Params of the main network
+	MainNetParams = Params{
+		Name:      "mainnet",
+		WIFPrefix: 0x80,
+		Bech32HRP: "gb",
+	}
+
+	// TestNetParams are the Params of the test network
+	TestNetParams = Params{
+		Name:      "testnet",
+		WIFPrefix: 0xef,
+		Bech32HRP: "tgb",
+	}
+
+	// RegTestParams are the Params of a local regression test network
+	RegTestParams = Params{
+		Name:      "regtest",
+		WIFPrefix: 0xef,
+		Bech32HRP: "gbrt",
+		// The chain the core tests make from fixed keys, which comes out the same on every run
+		UTXOSnapshots: []UTXOSnapshot{{
+			Height:      2,
+			BlockHash:   "000162af8c65f019889c15c35c6a66792a7452f92d6e8a5908efeed2bcf0cf08",
+			ContentHash: "be305f54342971c6642cc9d8631ecd5eb15f3cef551d6020c7387ddf6d87cdcb",
+		}},
+	}
+
+	// networks are all Params by name
+	networks = map[string]*Params{
+		MainNetParams.Name: &MainNetParams,
+		TestNetParams.Name: &TestNetParams,
+		RegTestParams.Name: &RegTestParams,
+	}
+)
+
+// GetParams gets the Params of a network by name, if it is known
+func GetParams(network string) (*Params, bool) {
+	params, ok := networks[network]
+	return params, ok
+}
+
+// GetUTXOSnapshot gets the UTXOSnapshot pinned at a given height, if there is one
+func (p *Params) GetUTXOSnapshot(height int) (UTXOSnapshot, bool) {
+	for _, snapshot := range p.UTXOSnapshots {
+		if snapshot.Height == height {
+			return snapshot, true
+		}
+	}
+
+	return UTXOSnapshot{}, false
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/danitello/go-blockchain/chaindb"
+	"github.com/danitello/go-blockchain/common/errutil"
+	"github.com/danitello/go-blockchain/core/types"
+)
+
+// address_index is additional database functions for BlockChain involving the history of each pub key hash
+
+// ErrNoAddressIndex is returned when history is requested but the address index is disabled
+var ErrNoAddressIndex = errors.New("Address index is not enabled, run index-addresses first")
+
+// BuildAddressIndex enables the address index and (re)builds it from every Block in the chain
+func (bc *BlockChain) BuildAddressIndex() error {
+	if bc.ChainDB.IsPruned() {
+		return ErrChainPruned
+	}
+
+	bc.ChainDB.DeleteAddressIndex()
+
+	txos := make(map[string]types.TxOutput) // every txo seen so far, to look up what txins spend
+	iter := bc.ForwardIterator(0)
+	for iter.HasNext() {
+		block, err := iter.Next()
+		if err != nil {
+			return err
+		}
+
+		for _, tx := range block.Transactions {
+			for txoIdx, txo := range tx.Outputs {
+				txos[outpoint(tx.ID, txoIdx)] = txo
+			}
+		}
+
+		batch := bc.ChainDB.Store.NewBatch()
+		bc.ChainDB.PutAddressTxs(batch, addressTxs(block, txos))
+		err = batch.Write()
+		errutil.Handle(err)
+	}
+
+	bc.ChainDB.EnableAddressIndex()
+	return nil
+}
+
+// GetAddressHistory gets every Transaction that changed the balance of a given pub key hash, oldest first
+func (bc *BlockChain) GetAddressHistory(pubKeyHash []byte) ([]chaindb.AddressTx, error) {
+	if !bc.ChainDB.HasAddressIndex() {
+		return nil, ErrNoAddressIndex
+	}
+
+	return bc.ChainDB.ReadAddressTxs(pubKeyHash), nil
+}
+
+// addressTxs computes the credits and debits of each pub key hash made by the Transactions in a Block -
+// spent must hold the txo referenced by each txin, keyed by outpoint
+func addressTxs(block *types.Block, spent map[string]types.TxOutput) []chaindb.AddressTx {
+	var addressTxs []chaindb.AddressTx
+
+	for _, tx := range block.Transactions {
+		changes := make(map[string]*chaindb.AddressTx)
+		var order []string
+
+		getChange := func(pubKeyHash []byte) *chaindb.AddressTx {
+			key := hex.EncodeToString(pubKeyHash)
+			if changes[key] == nil {
+				changes[key] = &chaindb.AddressTx{PubKeyHash: pubKeyHash, TxID: tx.ID, Height: block.Index}
+				order = append(order, key)
+			}
+			return changes[key]
+		}
+
+		if !tx.IsCoinbase() {
+			for _, txin := range tx.Inputs {
+				txo := spent[outpoint(txin.TxID, txin.OutputIdx)]
+				getChange(txo.PubKeyHash).Sent += txo.Amount
+			}
+		}
+
+		for _, txo := range tx.Outputs {
+			getChange(txo.PubKeyHash).Received += txo.Amount
+		}
+
+		for _, key := range order {
+			addressTxs = append(addressTxs, *changes[key])
+		}
+	}
+
+	return addressTxs
+}
+
+// GetUsedPubKeyHashes gets every pub key hash paid in the Blocks whose data is kept, or holding a utxo - keyed by the
+// (string) pub key hash
+func (bc *BlockChain) GetUsedPubKeyHashes() (map[string]bool, error) {
+	used := make(map[string]bool)
+
+	iter := bc.ForwardIterator(bc.ChainDB.ReadPrunedHeight() + 1)
+	for iter.HasNext() {
+		block, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tx := range block.Transactions {
+			for _, txo := range tx.Outputs {
+				used[string(txo.PubKeyHash)] = true
+			}
+		}
+	}
+
+	// Payments in pruned Blocks are only known while unspent
+	err := bc.UTXOCache.Iterate(func(txID []byte, TXO types.TxOutputs) error {
+		for _, txo := range TXO.Outputs {
+			used[string(txo.PubKeyHash)] = true
+		}
+		return nil
+	})
+
+	return used, err
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/danitello/go-blockchain/common/errutil"
+	"github.com/danitello/go-blockchain/core/types"
+)
+
+// block_index is additional database functions for BlockChain involving the height -> hash index of the active chain
+
+// GetBlockByHeight gets the Block at a given height of the active chain
+func (bc *BlockChain) GetBlockByHeight(height int) (*types.Block, error) {
+	if height < 0 || height >= bc.Height {
+		return nil, fmt.Errorf("Height %d is out of range [0, %d]", height, bc.Height-1)
+	}
+
+	hash, err := bc.ChainDB.ReadHashWithHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return bc.ChainDB.ReadBlockWithHash(hash)
+}
+
+// GetBlocksInRange gets the Blocks from height start to height end (inclusive), oldest first
+func (bc *BlockChain) GetBlocksInRange(start, end int) ([]*types.Block, error) {
+	if start > end {
+		return nil, fmt.Errorf("Invalid range: start %d is after end %d", start, end)
+	}
+	if start < 0 || end >= bc.Height {
+		return nil, fmt.Errorf("Range [%d, %d] is out of range [0, %d]", start, end, bc.Height-1)
+	}
+
+	var blocks []*types.Block
+	iter := bc.ForwardIterator(start)
+
+	for iter.HasNext() && len(blocks) < end-start+1 {
+		block, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
+// ReindexHeights rebuilds the height index by walking the active chain back from the last Block
+func (bc *BlockChain) ReindexHeights() {
+	iter := bc.Iterator()
+
+	for {
+		header, err := iter.NextHeader()
+		errutil.Handle(err)
+		bc.ChainDB.WriteHeightIndex(header.Index, header.Hash)
+
+		// Reached the beginning of the chain
+		if len(header.PrevHash) == 0 {
+			break
+		}
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"log"
 
 	"github.com/danitello/go-blockchain/common/errutil"
+	"github.com/danitello/go-blockchain/config"
+	"github.com/danitello/go-blockchain/core/coinselect"
 	"github.com/danitello/go-blockchain/wallet"
 
 	"github.com/danitello/go-blockchain/chaindb"
@@ -21,23 +23,25 @@ const (
 
 // BlockChain is a complete blockchain
 type BlockChain struct {
-	Height   int
-	LastHash []byte
-	ChainDB  *chaindb.ChainDB
+	Height    int
+	LastHash  []byte
+	ChainDB   *chaindb.ChainDB
+	UTXOCache *UTXOCache
+	Config    *config.Config
 }
 
-// InitBlockChain instantiates a new instance of a BlockChain
-func InitBlockChain(address string) *BlockChain {
+// InitBlockChain instantiates a new instance of a BlockChain in the database of a given Config
+func InitBlockChain(cfg *config.Config, address string) *BlockChain {
+	return InitBlockChainWithDB(cfg, chaindb.InitDB(cfg), address)
+}
 
-	db := chaindb.InitDB()
-	resChain := &BlockChain{
-		Height:   0,
-		LastHash: []byte{0},
-		ChainDB:  db}
+// InitBlockChainWithDB instantiates a new instance of a BlockChain in a given ChainDB
+func InitBlockChainWithDB(cfg *config.Config, db *chaindb.ChainDB, address string) *BlockChain {
+	resChain := newBlockChain(cfg, db)
 
 	// If a BlockChain can be found, use it, otherwise make a new one
 	if db.HasChain() {
-		log.Panic(fmt.Sprintf("BlockChain already exists in %s", chaindb.Dir))
+		log.Panic(fmt.Sprintf("BlockChain already exists in %s", cfg.ChainDir()))
 	} else {
 		genesisBlock := createGenesisBlock(address)
 		fmt.Println("Genesis block signed")
@@ -49,23 +53,52 @@ func InitBlockChain(address string) *BlockChain {
 
 }
 
-// GetBlockChain gets an existing BlockChain from the database
-func GetBlockChain() *BlockChain {
-	db := chaindb.InitDB()
+// GetBlockChain gets an existing BlockChain from the database of a given Config
+func GetBlockChain(cfg *config.Config) *BlockChain {
+	return GetBlockChainWithDB(cfg, chaindb.InitDB(cfg))
+}
 
+// GetBlockChainWithDB gets an existing BlockChain from a given ChainDB
+func GetBlockChainWithDB(cfg *config.Config, db *chaindb.ChainDB) *BlockChain {
 	if !db.HasChain() {
 		log.Panic("Error: No BlockChain exists")
 	}
-	resChain := &BlockChain{
-		Height:   0,
-		LastHash: []byte{0},
-		ChainDB:  db}
+	resChain := newBlockChain(cfg, db)
 	resChain.LastHash = db.ReadLastHash()
-	resChain.Height = db.ReadBlockWithHash(resChain.LastHash).Index + 1
+	lastHeader, err := db.ReadHeaderWithHash(resChain.LastHash)
+	errutil.Handle(err)
+	resChain.Height = lastHeader.Index + 1
+
+	// A crash or schema migration may have left the UTXO set out of step with the chain
+	resChain.CheckUTXOSet()
+	resChain.Prune()
 
 	return resChain
 }
 
+// newBlockChain creates a BlockChain in a given ChainDB, with the UTXOCache sized by the Config
+func newBlockChain(cfg *config.Config, db *chaindb.ChainDB) *BlockChain {
+	cacheSize := config.DefaultUTXOCacheSize
+	if cfg != nil {
+		cacheSize = cfg.UTXOCacheSize
+	}
+
+	return &BlockChain{
+		Height:    0,
+		LastHash:  []byte{0},
+		ChainDB:   db,
+		UTXOCache: newUTXOCache(db, cacheSize<<20),
+		Config:    cfg}
+}
+
+// Close writes the changes in the UTXOCache to the ChainDB and closes it
+func (bc *BlockChain) Close() {
+	defer bc.ChainDB.CloseDB()
+
+	err := bc.UTXOCache.Flush()
+	errutil.Handle(err)
+}
+
 // AddBlock adds a new Block to a given BlockChain
 func (bc *BlockChain) AddBlock(txns []*types.Transaction) {
 	// Create a new block and save it
@@ -73,33 +106,48 @@ func (bc *BlockChain) AddBlock(txns []*types.Transaction) {
 	bc.saveNewLastBlock(newBlock)
 }
 
-// saveNewLastBlock saves the new Block to db, and updates BlockChain struct
+// saveNewLastBlock saves the new Block to db, and updates BlockChain struct -
+// the Block, last hash and index entries are written in one atomic Batch, the UTXO set changes go to the UTXOCache
 func (bc *BlockChain) saveNewLastBlock(newBlock *types.Block) {
+	batch := bc.ChainDB.Store.NewBatch()
+
+	bc.ChainDB.PutNewLastBlock(batch, newBlock)
+	spent := bc.UTXOCache.ConnectBlock(newBlock)
+	if bc.ChainDB.HasAddressIndex() {
+		bc.ChainDB.PutAddressTxs(batch, addressTxs(newBlock, spent))
+	}
 
 	// Update DB
-	bc.ChainDB.WriteNewLastBlock(newBlock)
+	err := batch.Write()
+	errutil.Handle(err)
+	err = bc.UTXOCache.FlushIfFull()
+	errutil.Handle(err)
 
 	// Update chain
 	bc.LastHash = newBlock.Hash
-	//bc.UpdateUTXOSet(newBlock)
-	bc.Reindex()
+	bc.Height = newBlock.Index + 1
 
+	// The effects of the Block are in the UTXO set now, so older Block data may no longer be needed
+	bc.Prune()
 }
 
 // createGenesisBlock creates the first Block
 func createGenesisBlock(address string) *types.Block {
-	cbtx := types.CoinbaseTx(address)
+	cbtx := types.CoinbaseTx(address, 0)
 	return types.InitBlock([]*types.Transaction{cbtx}, []byte{}, -1) // prevHash empty
 }
 
-// GetUTXO gets the all the utxos in the chain
-func (bc *BlockChain) GetUTXO() map[string]types.TxOutputs {
+// GetUTXO gets the all the utxos in the chain, which needs the data of every Block
+func (bc *BlockChain) GetUTXO() (map[string]types.TxOutputs, error) {
 	UTXO := make(map[string]types.TxOutputs)
 	spentTXO := make(map[string][]int)
 	iter := bc.Iterator()
 
 	for {
-		block := iter.Next()
+		block, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
 
 		for _, tx := range block.Transactions {
 			txID := hex.EncodeToString(tx.ID)
@@ -115,7 +163,10 @@ func (bc *BlockChain) GetUTXO() map[string]types.TxOutputs {
 					}
 				}
 				txos := UTXO[txID]
-				txos.Outputs = append(txos.Outputs, txo)
+				if txos.Outputs == nil {
+					txos.Outputs = make(map[int]types.TxOutput)
+				}
+				txos.Outputs[outIdx] = txo
 				UTXO[txID] = txos
 			}
 
@@ -132,51 +183,263 @@ func (bc *BlockChain) GetUTXO() map[string]types.TxOutputs {
 		}
 	}
 
-	return UTXO
+	return UTXO, nil
 }
 
-// CreateTransaction makes a new Transaction to be added to a Block
-func (bc *BlockChain) CreateTransaction(from, to string, amount int) *types.Transaction {
+// CreateTransaction makes a new Transaction to be added to a Block, funded by the utxos a Selector chooses
+func (bc *BlockChain) CreateTransaction(from, to string, amount int, selector coinselect.Selector) *types.Transaction {
+	return bc.CreateTransactionWithPayments(from, []types.Payment{{Address: to, Amount: amount}}, selector)
+}
+
+// CreateTransactionWithPayments makes a new Transaction paying each of the Payments from one address, funded by the
+// utxos a Selector chooses
+func (bc *BlockChain) CreateTransactionWithPayments(from string, payments []types.Payment, selector coinselect.Selector) *types.Transaction {
 	// Get wallet info using address
-	wallets, err := wallet.InitWallets()
+	wallets, err := wallet.InitWallets(bc.Config.WalletFile())
 	errutil.Handle(err)
 	w := wallets.GetWallet(from)
-	pubKeyHash := wallet.HashPubKey(w.PublicKey)
 
-	utxos, txoSum := bc.GetUTXOWithPubKey(pubKeyHash, amount)
-	newTx := types.CreateTransaction(from, to, pubKeyHash, amount, txoSum, utxos)
-	bc.SignTransaction(newTx, w.PrivateKey)
+	newTx, err := bc.createTransaction([]*wallet.Wallet{&w}, payments, from, selector)
+	if err == coinselect.ErrInsufficientFunds {
+		log.Panic(fmt.Sprintf("Error: Not enough funds in wallet address: %s", from))
+	}
+	errutil.Handle(err)
+
 	return newTx
 }
 
-// SignTransaction gathers necessary data and initiates the flow for signing a tx
-func (bc *BlockChain) SignTransaction(tx *types.Transaction, privKey ecdsa.PrivateKey) {
-	prevTxs := make(map[string]types.Transaction)
+// CreateWalletTransaction makes a new Transaction paying each of the Payments from any addresses of the Wallets that
+// aren't watch-only, funded by the utxos a Selector chooses -
+// changeAddress - receives change
+func (bc *BlockChain) CreateWalletTransaction(ws *wallet.Wallets, payments []types.Payment, changeAddress string, selector coinselect.Selector) (*types.Transaction, error) {
+	var owners []*wallet.Wallet
+	for _, address := range ws.GetAddresses() {
+		if !ws.Wallets[address].IsWatchOnly() {
+			owners = append(owners, ws.Wallets[address])
+		}
+	}
 
-	for _, txin := range tx.Inputs {
-		prevTx, err := bc.GetTransactionWithID(txin.TxID)
-		errutil.Handle(err)
-		prevTxs[hex.EncodeToString(prevTx.ID)] = prevTx
+	return bc.createTransaction(owners, payments, changeAddress, selector)
+}
+
+// CreateUnsignedTransaction makes a new PartialTransaction paying each of the Payments, funded by the utxos a Selector
+// chooses, to be signed where the priv keys are -
+// from - the address to spend from, or "" for any address of the Wallets with a known pub key, watch-only ones too
+// changeAddress - receives change
+func (bc *BlockChain) CreateUnsignedTransaction(ws *wallet.Wallets, from string, payments []types.Payment, changeAddress string, selector coinselect.Selector) (*types.PartialTransaction, error) {
+	owners, err := spendingWallets(ws, from)
+	if err != nil {
+		return nil, err
+	}
+
+	ptx, _, err := bc.createUnsignedTransaction(owners, payments, changeAddress, selector)
+	return ptx, err
+}
+
+// FinalizeTransaction checks that every txin of a PartialTransaction is signed and spends the txo it claims to, then
+// adds it to the chain in a new Block whose coinbase tx pays rewardAddress
+func (bc *BlockChain) FinalizeTransaction(ptx *types.PartialTransaction, rewardAddress string) (*types.Transaction, error) {
+	if ptx.Network != bc.Config.Params.Name {
+		return nil, fmt.Errorf("Transaction is for network %q, not %q", ptx.Network, bc.Config.Params.Name)
+	}
+	if err := ptx.Check(); err != nil {
+		return nil, err
+	}
+	if unsigned := ptx.Unsigned(); unsigned > 0 {
+		return nil, fmt.Errorf("%d of the inputs are not signed yet", unsigned)
+	}
+
+	// The signers were shown these txos, so the amounts they agreed to must be the real ones
+	for txinID, txin := range ptx.Tx.Inputs {
+		txo, err := bc.getUnspentOutput(txin, nil)
+		if err != nil {
+			return nil, err
+		}
+		if txo.Amount != ptx.PrevOutputs[txinID].Amount || !bytes.Equal(txo.PubKeyHash, ptx.PrevOutputs[txinID].PubKeyHash) {
+			return nil, fmt.Errorf("Input %d spends an output that differs from the one in the transaction file", txinID)
+		}
+	}
+
+	block := types.InitBlock([]*types.Transaction{types.CoinbaseTx(rewardAddress, bc.Height), ptx.Tx}, bc.LastHash, bc.Height-1)
+	if err := bc.AcceptBlock(block); err != nil {
+		return nil, err
+	}
+
+	return ptx.Tx, nil
+}
+
+// createTransaction makes a new Transaction paying each of the Payments with utxos owned by any of the Wallets, and
+// signs each txin with the key of the Wallet owning the txo it spends
+func (bc *BlockChain) createTransaction(owners []*wallet.Wallet, payments []types.Payment, changeAddress string, selector coinselect.Selector) (*types.Transaction, error) {
+	ptx, signers, err := bc.createUnsignedTransaction(owners, payments, changeAddress, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range signers {
+		if w.IsWatchOnly() {
+			return nil, fmt.Errorf("Address %s is watch-only, its private key is not in the wallet", w.GetAddress())
+		}
+		if !w.HasPrivateKey() {
+			return nil, wallet.ErrLocked
+		}
+	}
+	for txinID, w := range signers {
+		ptx.Tx.SignInput(txinID, w.PrivateKey, ptx.PrevOutputs)
 	}
 
+	return ptx.Tx, nil
+}
+
+// createUnsignedTransaction makes a new PartialTransaction paying each of the Payments with utxos owned by any of the
+// Wallets, which need their pub keys - returns the Wallet owning the txo spent by each txin too
+func (bc *BlockChain) createUnsignedTransaction(owners []*wallet.Wallet, payments []types.Payment, changeAddress string, selector coinselect.Selector) (*types.PartialTransaction, []*wallet.Wallet, error) {
+	amount := 0
+	for _, payment := range payments {
+		amount += payment.Amount
+	}
+
+	inputs, prevOutputs, signers, sum, err := bc.selectInputs(owners, amount, selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	newTx := types.CreateTransactionWithInputs(inputs, payments, changeAddress, sum-amount)
+	ptx := &types.PartialTransaction{Network: bc.Config.Params.Name, Tx: newTx, PrevOutputs: prevOutputs}
+
+	return ptx, signers, nil
+}
+
+// ErrInexactPledge is returned when no utxos are worth exactly a pledge
+var ErrInexactPledge = errors.New("No utxos are worth exactly the pledge, send it to yourself first")
+
+// CreatePledge makes a new PartialTransaction paying each of the Payments, funded by only a pledged amount of them
+// chosen by a Selector and with no change - signed with types.SigHashAnyoneCanPay, it is combined with the pledges of
+// others paying the same Payments until they are funded. The utxos spent must be worth exactly the pledge, since
+// anything over it would go to fees
+// from - the address to spend from, or "" for any address of the Wallets with a known pub key
+func (bc *BlockChain) CreatePledge(ws *wallet.Wallets, from string, payments []types.Payment, pledge int, selector coinselect.Selector) (*types.PartialTransaction, error) {
+	owners, err := spendingWallets(ws, from)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs, prevOutputs, _, sum, err := bc.selectInputs(owners, pledge, selector)
+	if err != nil {
+		return nil, err
+	}
+	if sum != pledge {
+		return nil, ErrInexactPledge
+	}
+
+	newTx := types.CreateTransactionWithInputs(inputs, payments, "", 0)
+	return &types.PartialTransaction{Network: bc.Config.Params.Name, Tx: newTx, PrevOutputs: prevOutputs}, nil
+}
+
+// spendingWallets gets the Wallet of the address to spend from, or every Wallet with a known pub key if it is ""
+func spendingWallets(ws *wallet.Wallets, from string) ([]*wallet.Wallet, error) {
+	if from != "" {
+		w, ok := ws.Wallets[from]
+		if !ok {
+			return nil, wallet.ErrUnknownAddress
+		}
+		return []*wallet.Wallet{w}, nil
+	}
+
+	var owners []*wallet.Wallet
+	for _, address := range ws.GetAddresses() {
+		if ws.Wallets[address].PublicKey != nil {
+			owners = append(owners, ws.Wallets[address])
+		}
+	}
+	return owners, nil
+}
+
+// selectInputs makes unsigned txins spending utxos owned by any of the Wallets worth at least an amount, chosen by a
+// Selector - returns the txo spent by each txin, the Wallet owning it, and their sum too
+func (bc *BlockChain) selectInputs(owners []*wallet.Wallet, amount int, selector coinselect.Selector) ([]types.TxInput, []types.TxOutput, []*wallet.Wallet, int, error) {
+	var pubKeyHashes [][]byte
+	ownersByPubKeyHash := make(map[string]*wallet.Wallet)
+	for _, w := range owners {
+		pubKeyHash := w.GetPubKeyHash()
+		pubKeyHashes = append(pubKeyHashes, pubKeyHash)
+		ownersByPubKeyHash[string(pubKeyHash)] = w
+	}
+
+	var coins []coinselect.Coin
+	owner := make(map[string]*wallet.Wallet) // by outpoint
+	for pubKeyHash, ownedCoins := range bc.GetCoinsWithPubKeys(pubKeyHashes) {
+		for _, coin := range ownedCoins {
+			coins = append(coins, coin)
+			owner[outpoint(coin.TxID, coin.Idx)] = ownersByPubKeyHash[pubKeyHash]
+		}
+	}
+
+	selected, err := selector.Select(coins, amount)
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+
+	inputs := make([]types.TxInput, len(selected))
+	prevOutputs := make([]types.TxOutput, len(selected))
+	signers := make([]*wallet.Wallet, len(selected))
+	for i, coin := range selected {
+		w := owner[outpoint(coin.TxID, coin.Idx)]
+		if w.PublicKey == nil {
+			return nil, nil, nil, 0, fmt.Errorf("Address %s is watch-only without its public key, add it with import-pubkey", w.GetAddress())
+		}
+
+		inputs[i] = types.TxInput{TxID: coin.TxID, OutputIdx: coin.Idx, PubKey: w.PublicKey}
+		prevOutputs[i] = types.TxOutput{Amount: coin.Amount, PubKeyHash: w.GetPubKeyHash()}
+		signers[i] = w
+	}
+
+	return inputs, prevOutputs, signers, coinselect.Sum(selected), nil
+}
+
+// SignTransaction gathers necessary data and initiates the flow for signing a tx
+func (bc *BlockChain) SignTransaction(tx *types.Transaction, privKey ecdsa.PrivateKey) {
+	prevTxs, err := bc.getPrevTransactions(tx)
+	errutil.Handle(err)
+
 	tx.Sign(privKey, prevTxs)
 }
 
+// SignTransactionInputs gathers necessary data and initiates the flow for signing a tx whose txins have different
+// owners, with the priv key of each txin at the same idx
+func (bc *BlockChain) SignTransactionInputs(tx *types.Transaction, privKeys []ecdsa.PrivateKey) {
+	prevTxs, err := bc.getPrevTransactions(tx)
+	errutil.Handle(err)
+
+	tx.SignInputs(privKeys, prevTxs)
+}
+
 // VerifyTransaction gathers necessary data and initiates the flow for verifying a tx
 func (bc *BlockChain) VerifyTransaction(tx *types.Transaction) bool {
 	if tx.IsCoinbase() {
 		return true
 	}
 
+	prevTxs, err := bc.getPrevTransactions(tx)
+	errutil.Handle(err)
+
+	return tx.Verify(prevTxs)
+}
+
+// getPrevTransactions gets the Transactions referenced by the txins of a tx, keyed by ID
+func (bc *BlockChain) getPrevTransactions(tx *types.Transaction) (map[string]types.Transaction, error) {
 	prevTxs := make(map[string]types.Transaction)
 
 	for _, txin := range tx.Inputs {
+		txID := hex.EncodeToString(txin.TxID)
 		prevTx, err := bc.GetTransactionWithID(txin.TxID)
-		errutil.Handle(err)
-		prevTxs[hex.EncodeToString(prevTx.ID)] = prevTx
+		if err != nil {
+			return nil, err
+		}
+		prevTxs[txID] = prevTx
 	}
 
-	return tx.Verify(prevTxs)
+	return prevTxs, nil
 }
 
 // GetTransactionWithID searches the bc for a Transaction with a given ID
@@ -184,7 +447,12 @@ func (bc *BlockChain) GetTransactionWithID(id []byte) (types.Transaction, error)
 	iter := bc.Iterator()
 
 	for {
-		block := iter.Next()
+		block, err := iter.Next()
+		if err == chaindb.ErrBlockPruned {
+			return types.Transaction{}, errors.New("Transaction not found, the data of older blocks has been pruned")
+		} else if err != nil {
+			return types.Transaction{}, err
+		}
 
 		for _, tx := range block.Transactions {
 			if bytes.Compare(tx.ID, id) == 0 {
@@ -11,18 +11,69 @@ type BlockChainIterator struct {
 	db          *chaindb.ChainDB
 }
 
+// BlockChainForwardIterator traverses a given BlockChain from an older Block towards the last Block
+type BlockChainForwardIterator struct {
+	currentHeight int
+	endHeight     int
+	db            *chaindb.ChainDB
+}
+
 // Iterator creates a new BlockChainIterator for a BlockChain instance
 func (bc *BlockChain) Iterator() *BlockChainIterator {
 	return &BlockChainIterator{bc.LastHash, bc.ChainDB}
 }
 
-// Next retrievies the next (older) Block in the chain
-func (iter *BlockChainIterator) Next() (resBlock *types.Block) {
+// ForwardIterator creates a new BlockChainForwardIterator for a BlockChain instance starting at a given height
+func (bc *BlockChain) ForwardIterator(start int) *BlockChainForwardIterator {
+	return &BlockChainForwardIterator{start, bc.Height - 1, bc.ChainDB}
+}
+
+// Next retrievies the next (older) Block in the chain, or chaindb.ErrBlockPruned once Blocks are pruned
+func (iter *BlockChainIterator) Next() (*types.Block, error) {
 	// Get the Block represented by the CurrentHash
-	resBlock = iter.db.ReadBlockWithHash(iter.currentHash)
+	resBlock, err := iter.db.ReadBlockWithHash(iter.currentHash)
+	if err != nil {
+		return nil, err
+	}
 
 	// Update iterator
 	iter.currentHash = resBlock.PrevHash
 
-	return
+	return resBlock, nil
+}
+
+// NextHeader retrieves the BlockHeader of the next (older) Block in the chain, which is available even if pruned
+func (iter *BlockChainIterator) NextHeader() (*types.BlockHeader, error) {
+	header, err := iter.db.ReadHeaderWithHash(iter.currentHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update iterator
+	iter.currentHash = header.PrevHash
+
+	return header, nil
+}
+
+// HasNext determines whether there is a (newer) Block left to traverse
+func (iter *BlockChainForwardIterator) HasNext() bool {
+	return iter.currentHeight <= iter.endHeight
+}
+
+// Next retrieves the next (newer) Block in the chain, or chaindb.ErrBlockPruned if its data has been pruned
+func (iter *BlockChainForwardIterator) Next() (*types.Block, error) {
+	hash, err := iter.db.ReadHashWithHeight(iter.currentHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := iter.db.ReadBlockWithHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update iterator
+	iter.currentHeight++
+
+	return block, nil
 }
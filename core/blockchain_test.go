@@ -0,0 +1,196 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/danitello/go-blockchain/chaindb"
+	"github.com/danitello/go-blockchain/common/keys"
+	"github.com/danitello/go-blockchain/config"
+	"github.com/danitello/go-blockchain/core/coinselect"
+	"github.com/danitello/go-blockchain/core/types"
+	"github.com/danitello/go-blockchain/wallet"
+)
+
+// testWallet is the Wallet of a fixed secp256k1 key, so the chains of the tests are the same on every run
+func testWallet(t *testing.T, d byte) *wallet.Wallet {
+	t.Helper()
+
+	privKey, err := keys.PrivateKeyFromBytes(keys.Secp256k1, append(make([]byte, 31), d))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &wallet.Wallet{PrivateKey: privKey, PublicKey: keys.EncodePubKey(privKey.PublicKey)}
+}
+
+// testAddress gets the Base58 address of a Wallet
+func testAddress(w *wallet.Wallet) string {
+	return string(w.GetAddress())
+}
+
+// newTestConfig makes a regtest Config of the in-memory store, with a UTXOCache limit in MiB
+func newTestConfig(t *testing.T, cacheSize int) *config.Config {
+	t.Helper()
+
+	cfg, err := config.InitConfig(t.TempDir(), config.RegTestParams.Name, chaindb.MemoryBackend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.SetUTXOCacheSize(cacheSize); err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+// newTestChain makes a BlockChain whose genesis Block pays the Wallet of key 1
+func newTestChain(t *testing.T, cfg *config.Config) *BlockChain {
+	t.Helper()
+
+	return InitBlockChain(cfg, testAddress(testWallet(t, 1)))
+}
+
+// pay makes a Transaction paying an amount from the Wallet of key 1 to the Wallet of key 2, with change back
+func pay(t *testing.T, bc *BlockChain, amount int) *types.Transaction {
+	t.Helper()
+
+	from := testWallet(t, 1)
+	payments := []types.Payment{{Address: testAddress(testWallet(t, 2)), Amount: amount}}
+	selector, err := coinselect.GetSelector("largest-first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := bc.createTransaction([]*wallet.Wallet{from}, payments, testAddress(from), selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+// nextBlock makes the next Block of a BlockChain with Transactions after a coinbase tx paying the Wallet of key 1
+func nextBlock(t *testing.T, bc *BlockChain, txs ...*types.Transaction) *types.Block {
+	t.Helper()
+
+	coinbase := types.CoinbaseTx(testAddress(testWallet(t, 1)), bc.Height)
+	return types.InitBlock(append([]*types.Transaction{coinbase}, txs...), bc.LastHash, bc.Height-1)
+}
+
+// utxoSet gets the UTXO set of a BlockChain as seen through its UTXOCache, by Transaction ID in hex
+func utxoSet(t *testing.T, bc *BlockChain) map[string]types.TxOutputs {
+	t.Helper()
+
+	set := make(map[string]types.TxOutputs)
+	err := bc.UTXOCache.Iterate(func(txID []byte, txos types.TxOutputs) error {
+		set[hex.EncodeToString(txID)] = txos
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return set
+}
+
+// expectUTXOSet fails the test unless the UTXO set of a BlockChain is the one its Blocks make, with matching UTXOStats
+func expectUTXOSet(t *testing.T, bc *BlockChain) {
+	t.Helper()
+
+	want, err := bc.GetUTXO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := utxoSet(t, bc); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got UTXO set %v, want %v", got, want)
+	}
+
+	if err := bc.UTXOCache.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := bc.ChainDB.ComputeUTXOStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := bc.ChainDB.ReadUTXOStats()
+	if !bytes.Equal(got.Hash.Sum(), stats.Hash.Sum()) || got.Outputs != stats.Outputs || got.Supply != stats.Supply || got.Size != stats.Size {
+		t.Fatalf("got UTXO stats %+v, want %+v", got, stats)
+	}
+}
+
+// TestAcceptBlock connects valid Blocks to a BlockChain and checks that invalid ones leave it as it was
+func TestAcceptBlock(t *testing.T) {
+	bc := newTestChain(t, newTestConfig(t, 0))
+	genesis := bc.LastHash
+
+	tx := pay(t, bc, 30)
+	block := nextBlock(t, bc, tx)
+	if err := bc.AcceptBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if bc.Height != 2 || !bytes.Equal(bc.LastHash, block.Hash) {
+		t.Fatalf("got height %d and last hash %x, want 2 and %x", bc.Height, bc.LastHash, block.Hash)
+	}
+	if _, ok := bc.UTXOCache.Get(block.Transactions[0].ID); !ok {
+		t.Fatal("coinbase tx of the block is not in the UTXO set")
+	}
+	if txos, ok := bc.UTXOCache.Get(tx.ID); !ok || len(txos.Outputs) != 2 {
+		t.Fatalf("got outputs %v of the connected tx", txos.Outputs)
+	}
+	if _, ok := bc.UTXOCache.Get(tx.Inputs[0].TxID); ok {
+		t.Fatal("spent genesis output is still in the UTXO set")
+	}
+	expectUTXOSet(t, bc)
+
+	// Spending the change of a tx of the last Block
+	change := pay(t, bc, 10)
+	if err := bc.AcceptBlock(nextBlock(t, bc, change)); err != nil {
+		t.Fatal(err)
+	}
+	spendChange := types.CreateTransactionWithInputs([]types.TxInput{{TxID: change.ID, OutputIdx: 1, PubKey: testWallet(t, 1).PublicKey}},
+		[]types.Payment{{Address: testAddress(testWallet(t, 2)), Amount: change.Outputs[1].Amount}}, "", 0)
+	spendChange.SignInput(0, testWallet(t, 1).PrivateKey, []types.TxOutput{change.Outputs[1]})
+	if err := bc.AcceptBlock(nextBlock(t, bc, spendChange)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bc.UTXOCache.Get(change.ID); !ok {
+		t.Fatal("unspent output of a tx with a spent change is not in the UTXO set")
+	}
+	expectUTXOSet(t, bc)
+
+	doubleSpend := pay(t, bc, 5)
+	badSignature := pay(t, bc, 5)
+	badSignature.Witnesses[0].Signature[10] ^= 1
+	unknownOutput := pay(t, bc, 5)
+	unknownOutput.Inputs[0].TxID = bytes.Repeat([]byte{1}, 32)
+	unknownOutput.ID = unknownOutput.Hash()
+	overpaid := nextBlock(t, bc)
+	overpaid.Transactions[0].Outputs[0].Amount++
+	overpaid.Transactions[0].ID = overpaid.Transactions[0].Hash()
+	legacy := nextBlock(t, bc)
+	legacy.Version = types.LegacyBlockVersion
+
+	for _, test := range []struct {
+		name  string
+		block *types.Block
+	}{
+		{"genesis block", types.InitBlock([]*types.Transaction{types.CoinbaseTx(testAddress(testWallet(t, 1)), 0)}, []byte{}, -1)},
+		{"block off an older block", types.InitBlock(nextBlock(t, bc).Transactions, genesis, 0)},
+		{"double spend", nextBlock(t, bc, doubleSpend, doubleSpend)},
+		{"bad signature", nextBlock(t, bc, badSignature)},
+		{"unknown output", nextBlock(t, bc, unknownOutput)},
+		{"coinbase paying more than the reward", overpaid},
+		{"legacy block", legacy},
+	} {
+		height, lastHash := bc.Height, bc.LastHash
+		if err := bc.AcceptBlock(test.block); err == nil {
+			t.Errorf("%s: accepted", test.name)
+		}
+		if bc.Height != height || !bytes.Equal(bc.LastHash, lastHash) {
+			t.Fatalf("%s: chain changed", test.name)
+		}
+	}
+	expectUTXOSet(t, bc)
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/danitello/go-blockchain/chaindb"
+	"github.com/danitello/go-blockchain/config"
+	"github.com/danitello/go-blockchain/core/types"
+)
+
+// chain_export is functions for writing a BlockChain to a portable bootstrap file and reading one back -
+// the file starts with chainFileMagic, the format version, the network name (uint32 length prefixed) and the
+// number of Blocks (uint32), then every Block from genesis to tip as its uint32 length and canonical encoding
+
+const (
+	chainFileVersion = 2
+	maxBlockSize     = 1 << 25
+)
+
+var (
+	chainFileMagic = []byte("GBCF")
+
+	// ErrNotChainFile is returned when importing a file that isn't a chain file
+	ErrNotChainFile = errors.New("Not a chain file")
+	// ErrLegacyChain is returned when exporting a BlockChain that starts with legacy Blocks, which can't be validated
+	// when imported
+	ErrLegacyChain = errors.New("The chain starts with legacy blocks, which can't be imported - dump the UTXO set instead")
+)
+
+// ExportChain writes every Block of the BlockChain from genesis to tip to w, returning the number of Blocks written
+func (bc *BlockChain) ExportChain(w io.Writer) (int, error) {
+	if bc.ChainDB.IsPruned() {
+		return 0, ErrChainPruned
+	}
+	// Legacy Blocks only come before every Block of BlockVersion
+	if bc.Height > 0 {
+		genesis, err := bc.GetBlockByHeight(0)
+		if err != nil {
+			return 0, err
+		}
+		if genesis.Version != types.BlockVersion {
+			return 0, ErrLegacyChain
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := writeChainFileHeader(bw, bc.Config.Params.Name, bc.Height); err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	count := 0
+	iter := bc.ForwardIterator(0)
+	for iter.HasNext() {
+		block, err := iter.Next()
+		if err != nil {
+			return count, err
+		}
+
+		buf.Reset()
+		if err := types.EncodeBlock(&buf, block); err != nil {
+			return count, err
+		}
+		if err := binary.Write(bw, binary.BigEndian, uint32(buf.Len())); err != nil {
+			return count, err
+		}
+		if _, err := bw.Write(buf.Bytes()); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, bw.Flush()
+}
+
+// ImportBlockChain creates a BlockChain in the (empty) database of a given Config from a chain file, validating
+// every Block as it is added - on error the returned BlockChain holds the Blocks imported so far, if any were
+// progress - called after each Block with the number of Blocks imported and in the file
+func ImportBlockChain(cfg *config.Config, r io.Reader, progress func(done, total int)) (*BlockChain, error) {
+	br := bufio.NewReader(r)
+	network, total, err := readChainFileHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if network != cfg.Params.Name {
+		return nil, fmt.Errorf("Chain file is for network %q, not %q", network, cfg.Params.Name)
+	}
+	if total == 0 {
+		return nil, errors.New("Chain file has no blocks")
+	}
+
+	db := chaindb.InitDB(cfg)
+	if db.HasChain() {
+		db.CloseDB()
+		return nil, fmt.Errorf("BlockChain already exists in %s", cfg.ChainDir())
+	}
+	bc := newBlockChain(cfg, db)
+
+	for i := 0; i < total; i++ {
+		var size uint32
+		if err := binary.Read(br, binary.BigEndian, &size); err != nil {
+			return bc, fmt.Errorf("Reading block %d: %s", i, err)
+		}
+		if size > maxBlockSize {
+			return bc, fmt.Errorf("Reading block %d: size %d is too large", i, size)
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return bc, fmt.Errorf("Reading block %d: %s", i, err)
+		}
+		dataReader := bytes.NewReader(data)
+		block, err := types.DecodeBlock(dataReader)
+		if err == nil && dataReader.Len() > 0 {
+			err = errors.New("trailing data")
+		}
+		if err != nil {
+			return bc, fmt.Errorf("Reading block %d: %s", i, err)
+		}
+		if err := bc.AcceptBlock(block); err != nil {
+			return bc, err
+		}
+		progress(i+1, total)
+	}
+
+	return bc, nil
+}
+
+// writeChainFileHeader writes the header of a chain file
+func writeChainFileHeader(w io.Writer, network string, count int) error {
+	if _, err := w.Write(chainFileMagic); err != nil {
+		return err
+	}
+
+	for _, v := range []interface{}{uint32(chainFileVersion), uint32(len(network)), []byte(network), uint32(count)} {
+		if err := binary.Write(w, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readChainFileHeader reads the header of a chain file, returning its network name and number of Blocks
+func readChainFileHeader(r io.Reader) (string, int, error) {
+	magic := make([]byte, len(chainFileMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, chainFileMagic) {
+		return "", 0, ErrNotChainFile
+	}
+
+	var version, nameLen uint32
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return "", 0, ErrNotChainFile
+	}
+	if version != chainFileVersion {
+		return "", 0, fmt.Errorf("Unsupported chain file version %d", version)
+	}
+	if err := binary.Read(r, binary.BigEndian, &nameLen); err != nil || nameLen > 64 {
+		return "", 0, ErrNotChainFile
+	}
+
+	name := make([]byte, nameLen)
+	var count uint32
+	if _, err := io.ReadFull(r, name); err != nil {
+		return "", 0, ErrNotChainFile
+	}
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return "", 0, ErrNotChainFile
+	}
+
+	return string(name), int(count), nil
+}
@@ -0,0 +1,82 @@
+package coinselect
+
+// maxBnBTries caps the branches visited by branchAndBound, after which the best selection found so far is used
+const maxBnBTries = 100000
+
+// branchAndBound searches for Coins adding up to exactly the target, so the Transaction needs no change output -
+// among those found it keeps the one with the fewest inputs, and falls back to largestFirst if there are none
+type branchAndBound struct{}
+
+// Select chooses Coins adding up to exactly the target if possible
+func (branchAndBound) Select(coins []Coin, target int) ([]Coin, error) {
+	if Sum(coins) < target {
+		return nil, ErrInsufficientFunds
+	}
+
+	// Largest first reaches the target with few Coins, so better selections cut off more branches
+	sorted := sortedCoins(coins)
+	for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+		sorted[i], sorted[j] = sorted[j], sorted[i]
+	}
+
+	s := &bnbSearch{coins: sorted, target: target, remaining: make([]int, len(sorted)+1)}
+	for i := len(sorted) - 1; i >= 0; i-- {
+		s.remaining[i] = s.remaining[i+1] + sorted[i].Amount
+	}
+	s.search(0, 0)
+
+	if s.best == nil {
+		return largestFirst{}.Select(coins, target)
+	}
+
+	selected := make([]Coin, len(s.best))
+	for i, idx := range s.best {
+		selected[i] = sorted[idx]
+	}
+
+	return selected, nil
+}
+
+// bnbSearch is the state of a depth first search over including or excluding each Coin -
+// coins - in descending order of Amount
+// remaining - sum of the Amounts of coins from each idx on
+// current, best - idxs of the Coins in the branch being searched, and of the best exact match so far
+type bnbSearch struct {
+	coins     []Coin
+	target    int
+	remaining []int
+	current   []int
+	best      []int
+	tries     int
+}
+
+// search explores the branches from the Coin at a given idx, with the Coins included so far adding up to sum
+func (s *bnbSearch) search(i, sum int) {
+	if s.tries >= maxBnBTries || sum > s.target || sum+s.remaining[i] < s.target {
+		return
+	}
+	s.tries++
+
+	if sum == s.target {
+		if s.best == nil || len(s.current) < len(s.best) {
+			s.best = append([]int{}, s.current...)
+		}
+		return
+	}
+	// Another Coin can't beat the best selection
+	if i == len(s.coins) || (s.best != nil && len(s.current)+1 >= len(s.best)) {
+		return
+	}
+
+	// Include the Coin
+	s.current = append(s.current, i)
+	s.search(i+1, sum+s.coins[i].Amount)
+	s.current = s.current[:len(s.current)-1]
+
+	// Exclude it, along with Coins of the same Amount - including one of those is the same as including this one
+	next := i + 1
+	for next < len(s.coins) && s.coins[next].Amount == s.coins[i].Amount {
+		next++
+	}
+	s.search(next, sum)
+}
@@ -0,0 +1,163 @@
+package coinselect
+
+// Strategies for choosing which utxos fund a Transaction
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+const (
+	// BranchAndBound is the name of the Selector looking for inputs that need no change, falling back to LargestFirst
+	BranchAndBound = "bnb"
+	// LargestFirst is the name of the Selector spending the largest utxos first
+	LargestFirst = "largest-first"
+	// SmallestFirst is the name of the Selector spending the smallest utxos first
+	SmallestFirst = "smallest-first"
+	// Random is the name of the Selector spending utxos in random order
+	Random = "random"
+
+	// DefaultStrategy is the name of the Selector used when none is specified
+	DefaultStrategy = BranchAndBound
+)
+
+var (
+	// ErrInsufficientFunds is returned when the Coins don't add up to the target
+	ErrInsufficientFunds = errors.New("Not enough funds")
+
+	// selectors are all Selectors by name
+	selectors = map[string]Selector{
+		BranchAndBound: branchAndBound{},
+		LargestFirst:   largestFirst{},
+		SmallestFirst:  smallestFirst{},
+		Random:         random{},
+	}
+)
+
+// Coin is a utxo that can be spent -
+// TxID - ID of the Transaction the txo is in
+// Idx - idx of the txo in the Transaction
+// Amount - amount of the txo
+type Coin struct {
+	TxID   []byte
+	Idx    int
+	Amount int
+}
+
+// Selector chooses Coins whose Amounts add up to at least a target
+type Selector interface {
+	Select(coins []Coin, target int) ([]Coin, error)
+}
+
+// GetSelector gets the Selector with a given name
+func GetSelector(name string) (Selector, error) {
+	selector, ok := selectors[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown coin selection strategy %q (one of %s)", name, strings.Join(Names(), ", "))
+	}
+
+	return selector, nil
+}
+
+// Names gets the names of all Selectors in alphabetical order
+func Names() []string {
+	var names []string
+	for name := range selectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Sum adds up the Amounts of Coins
+func Sum(coins []Coin) int {
+	sum := 0
+	for _, coin := range coins {
+		sum += coin.Amount
+	}
+
+	return sum
+}
+
+// largestFirst spends the largest Coins first, for the fewest inputs
+type largestFirst struct{}
+
+// Select chooses Coins from largest to smallest until they reach the target
+func (largestFirst) Select(coins []Coin, target int) ([]Coin, error) {
+	sorted := sortedCoins(coins)
+	for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+		sorted[i], sorted[j] = sorted[j], sorted[i]
+	}
+
+	return accumulate(sorted, target)
+}
+
+// smallestFirst spends the smallest Coins first, consolidating dust
+type smallestFirst struct{}
+
+// Select chooses Coins from smallest to largest until they reach the target
+func (smallestFirst) Select(coins []Coin, target int) ([]Coin, error) {
+	return accumulate(sortedCoins(coins), target)
+}
+
+// random spends Coins in random order, so the inputs reveal less about the wallet -
+// rng - source of the order, the shared one of math/rand if nil
+type random struct {
+	rng *rand.Rand
+}
+
+// Select chooses Coins in random order until they reach the target
+func (r random) Select(coins []Coin, target int) ([]Coin, error) {
+	shuffle := rand.Shuffle
+	if r.rng != nil {
+		shuffle = r.rng.Shuffle
+	}
+
+	shuffled := append([]Coin{}, coins...)
+	shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	return accumulate(shuffled, target)
+}
+
+// accumulate takes Coins in order until they reach the target
+func accumulate(coins []Coin, target int) ([]Coin, error) {
+	var selected []Coin
+	sum := 0
+
+	for _, coin := range coins {
+		if sum >= target {
+			break
+		}
+		selected = append(selected, coin)
+		sum += coin.Amount
+	}
+
+	if sum < target {
+		return nil, ErrInsufficientFunds
+	}
+
+	return selected, nil
+}
+
+// sortedCoins copies Coins into ascending order of Amount, ties ordered by outpoint so the result is deterministic
+func sortedCoins(coins []Coin) []Coin {
+	sorted := append([]Coin{}, coins...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Amount != sorted[j].Amount {
+			return sorted[i].Amount < sorted[j].Amount
+		}
+		if c := bytes.Compare(sorted[i].TxID, sorted[j].TxID); c != 0 {
+			return c < 0
+		}
+		return sorted[i].Idx < sorted[j].Idx
+	})
+
+	return sorted
+}
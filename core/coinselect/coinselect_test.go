@@ -0,0 +1,104 @@
+package coinselect
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// makeCoins makes a Coin of each amount, the one at idx i in a Transaction with ID i
+func makeCoins(amounts ...int) []Coin {
+	coins := make([]Coin, len(amounts))
+	for i, amount := range amounts {
+		coins[i] = Coin{TxID: []byte{byte(i)}, Idx: 0, Amount: amount}
+	}
+
+	return coins
+}
+
+// describe writes selected Coins as their Amounts and TxIDs in the order they were selected
+func describe(coins []Coin) string {
+	s := ""
+	for _, coin := range coins {
+		s += fmt.Sprintf("%d@%d ", coin.Amount, coin.TxID[0])
+	}
+
+	return s
+}
+
+func TestSelect(t *testing.T) {
+	wallet := makeCoins(5, 10, 3, 7, 1)
+
+	tests := []struct {
+		name     string
+		selector Selector
+		coins    []Coin
+		target   int
+		want     string
+		wantErr  error
+	}{
+		{"bnb exact match", branchAndBound{}, wallet, 8, "7@3 1@4 ", nil},
+		{"bnb exact match of two large coins", branchAndBound{}, wallet, 15, "10@1 5@0 ", nil},
+		{"bnb exact match of a single coin", branchAndBound{}, wallet, 3, "3@2 ", nil},
+		{"bnb fewest coins among exact matches", branchAndBound{}, makeCoins(1, 2, 3, 4, 6), 6, "6@4 ", nil},
+		{"bnb exact match of every coin", branchAndBound{}, wallet, 26, "10@1 7@3 5@0 3@2 1@4 ", nil},
+		{"bnb no exact match falls back to largest first", branchAndBound{}, makeCoins(10, 20, 40), 25, "40@2 ", nil},
+		{"bnb no exact match needs several coins", branchAndBound{}, makeCoins(10, 20, 40), 65, "40@2 20@1 10@0 ", nil},
+		{"bnb insufficient funds", branchAndBound{}, wallet, 27, "", ErrInsufficientFunds},
+		{"bnb no coins", branchAndBound{}, nil, 1, "", ErrInsufficientFunds},
+
+		{"largest first", largestFirst{}, wallet, 12, "10@1 7@3 ", nil},
+		{"largest first single coin", largestFirst{}, wallet, 10, "10@1 ", nil},
+		{"largest first ties ordered by outpoint", largestFirst{}, makeCoins(4, 4, 4), 8, "4@2 4@1 ", nil},
+		{"largest first insufficient funds", largestFirst{}, wallet, 27, "", ErrInsufficientFunds},
+
+		{"smallest first", smallestFirst{}, wallet, 12, "1@4 3@2 5@0 7@3 ", nil},
+		{"smallest first every coin", smallestFirst{}, wallet, 26, "1@4 3@2 5@0 7@3 10@1 ", nil},
+		{"smallest first ties ordered by outpoint", smallestFirst{}, makeCoins(4, 4, 4), 8, "4@0 4@1 ", nil},
+		{"smallest first insufficient funds", smallestFirst{}, wallet, 27, "", ErrInsufficientFunds},
+
+		{"random with a fixed seed", random{rand.New(rand.NewSource(1))}, wallet, 12, "3@2 5@0 10@1 ", nil},
+		{"random with another seed", random{rand.New(rand.NewSource(2))}, wallet, 12, "7@3 3@2 1@4 10@1 ", nil},
+		{"random insufficient funds", random{rand.New(rand.NewSource(1))}, wallet, 27, "", ErrInsufficientFunds},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, err := test.selector.Select(test.coins, test.target)
+			if err != test.wantErr {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if got := describe(selected); got != test.want {
+				t.Fatalf("selected %q, want %q", got, test.want)
+			}
+			if err == nil && Sum(selected) < test.target {
+				t.Fatalf("selected %d, short of %d", Sum(selected), test.target)
+			}
+		})
+	}
+}
+
+func TestSelectDoesNotReorderCoins(t *testing.T) {
+	coins := makeCoins(5, 10, 3)
+	for _, name := range Names() {
+		selector, err := GetSelector(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := selector.Select(coins, 13); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := describe(coins); got != "5@0 10@1 3@2 " {
+			t.Fatalf("%s reordered the Coins to %q", name, got)
+		}
+	}
+}
+
+func TestGetSelector(t *testing.T) {
+	if _, err := GetSelector("unknown"); err == nil {
+		t.Fatal("got a Selector for an unknown name")
+	}
+	if got := fmt.Sprint(Names()); got != "[bnb largest-first random smallest-first]" {
+		t.Fatalf("got names %s", got)
+	}
+}
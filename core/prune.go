@@ -0,0 +1,38 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/danitello/go-blockchain/common/errutil"
+)
+
+// prune is additional functions for BlockChain involving deleting the data of old Blocks
+
+// ErrChainPruned is returned by operations that need the data of every Block when some has been pruned
+var ErrChainPruned = errors.New("The data of older blocks has been pruned, this needs a chain with every block")
+
+// Prune deletes the data of the Blocks deeper than the prune depth of the Config, if pruning is enabled -
+// their headers are kept, and their effects are already in the UTXO set
+func (bc *BlockChain) Prune() {
+	if bc.Config == nil || bc.Config.PruneDepth == 0 {
+		return
+	}
+
+	pruneHeight := bc.Height - 1 - bc.Config.PruneDepth
+	if pruneHeight < 0 {
+		return
+	}
+
+	if pruneHeight <= bc.ChainDB.ReadPrunedHeight() {
+		return
+	}
+
+	// Catching up the UTXO set in the db after a crash needs the data of the Blocks since it was last written
+	err := bc.UTXOCache.Flush()
+	errutil.Handle(err)
+
+	if pruned := bc.ChainDB.PruneBlocks(pruneHeight); pruned > 0 {
+		fmt.Printf("Pruned the data of %d blocks (up to height %d)\n", pruned, pruneHeight)
+	}
+}
@@ -9,12 +9,12 @@ import (
 	"math/big"
 	"time"
 
-	"github.com/danitello/go-blockchain/common/byteutil"
 	"github.com/danitello/go-blockchain/common/errutil"
 	"github.com/danitello/go-blockchain/common/hexutil"
 )
 
 // Block is a block in the blockchain with
+// Version - LegacyBlockVersion for Blocks made before TxWitnesses, which are kept but can't be validated again
 // Index - index of this Block in the BlockChain
 // Nonce - integer that completes hash of Block for successful signing
 // Difficulty - determines the target value to sign the Block
@@ -23,6 +23,7 @@ import (
 // TimeStamp - the time this Blocks proof
 // Transactions - the transactions contained in this Block
 type Block struct {
+	Version      int
 	Index        int
 	Nonce        int
 	Difficulty   int
@@ -32,12 +33,42 @@ type Block struct {
 	Transactions []*Transaction
 }
 
+// BlockHeader is the part of a Block needed to validate its proof and link it into the chain, kept when the Block
+// data is pruned -
+// MerkleRoot - root of the MerkleTree of the IDs of the Transactions in the Block, nil for legacy Blocks
+// WitnessRoot - root of the MerkleTree of the WitnessHashes of the Transactions, nil for legacy Blocks
+type BlockHeader struct {
+	Index       int
+	Nonce       int
+	Difficulty  int
+	Hash        []byte
+	PrevHash    []byte
+	TimeStamp   []byte
+	MerkleRoot  []byte
+	WitnessRoot []byte
+}
+
+const (
+	// Difficulty is the number of leading zero bits the Hash of every Block needs
+	Difficulty = 12
+
+	// LegacyBlockVersion is the Version of Blocks whose MerkleTree is of the gob encodings of their Transactions.
+	// gob numbers types in the order a process first encodes them, so what those encodings were depends on the
+	// process that made the Block, and the MerkleTree can't be computed again - only the Hash of legacy Blocks is
+	// checked against their Difficulty
+	LegacyBlockVersion = 0
+	// BlockVersion is the Version of new Blocks, whose MerkleTree is of the IDs of their Transactions, hashed from
+	// their canonical encoding, and whose TxWitnesses are committed to by a WitnessRoot
+	BlockVersion = 1
+)
+
 // InitBlock initializes a new Block
 func InitBlock(txns []*Transaction, prevHash []byte, prevIndex int) *Block {
 	newBlock := &Block{
+		Version:      BlockVersion,
 		Index:        prevIndex + 1,
 		Nonce:        0,
-		Difficulty:   12,
+		Difficulty:   Difficulty,
 		Hash:         []byte{},
 		Transactions: txns,
 		PrevHash:     prevHash,
@@ -72,10 +103,38 @@ func (b *Block) runProof() {
 // ValidateProof confirms that a given Block has been signed correctly and thus is a valid Block in the BlockChain
 // using the Nonce that has been computed for it
 func (b *Block) ValidateProof() bool {
+	return b.Header().ValidateProof()
+}
+
+// Header gets the BlockHeader of the Block
+func (b *Block) Header() *BlockHeader {
+	return &BlockHeader{
+		Index:       b.Index,
+		Nonce:       b.Nonce,
+		Difficulty:  b.Difficulty,
+		Hash:        b.Hash,
+		PrevHash:    b.PrevHash,
+		TimeStamp:   b.TimeStamp,
+		MerkleRoot:  b.getMerkleTree(),
+		WitnessRoot: b.getWitnessRoot()}
+}
+
+// ValidateProof confirms that the Block of a given BlockHeader has been signed correctly, without its Transactions -
+// the proof data of legacy Blocks can't be computed again, so only their Hash is checked against the target
+func (h *BlockHeader) ValidateProof() bool {
 	var bigIntHash big.Int
-	_, bigIntHash = b.computeHash(false)
+	if len(h.Hash) != sha256.Size {
+		return false
+	}
+	if h.WitnessRoot != nil {
+		hash := sha256.Sum256(proofData(h.PrevHash, h.MerkleRoot, h.WitnessRoot, h.Nonce, h.Difficulty))
+		if !bytes.Equal(hash[:], h.Hash) {
+			return false
+		}
+	}
+	bigIntHash.SetBytes(h.Hash)
 
-	target := new(big.Int).Lsh(big.NewInt(1), uint(256-b.Difficulty))
+	target := new(big.Int).Lsh(big.NewInt(1), uint(256-h.Difficulty))
 
 	return bigIntHash.Cmp(target) == -1
 }
@@ -95,16 +154,27 @@ func (b *Block) computeHash(print bool) ([32]byte, big.Int) {
 
 // compileProofData creates the comprehensive data slice that will be hashed during the POW
 func (b *Block) compileProofData() []byte {
-	return bytes.Join([][]byte{b.PrevHash, b.getMerkleTree(), hexutil.ToHex(int64(b.Nonce)), hexutil.ToHex(int64(b.Difficulty))}, []byte{})
+	return proofData(b.PrevHash, b.getMerkleTree(), b.getWitnessRoot(), b.Nonce, b.Difficulty)
 }
 
-// getMerkleTree gets the MerkleTree representation of the Transactions in the Block and returns the root
+// proofData joins the fields of a Block covered by the POW - witnessRoot is empty for legacy Blocks, which leaves
+// their proof data as it was
+func proofData(prevHash, merkleRoot, witnessRoot []byte, nonce, difficulty int) []byte {
+	return bytes.Join([][]byte{prevHash, merkleRoot, witnessRoot, hexutil.ToHex(int64(nonce)), hexutil.ToHex(int64(difficulty))}, []byte{})
+}
+
+// getMerkleTree gets the MerkleTree representation of the IDs of the Transactions in the Block and returns the root,
+// nil for legacy Blocks
 func (b *Block) getMerkleTree() []byte {
+	if b.Version == LegacyBlockVersion {
+		return nil
+	}
+
 	var txs [][]byte
 
 	// Get txs
 	for _, tx := range b.Transactions {
-		txs = append(txs, byteutil.Serialize(tx))
+		txs = append(txs, tx.ID)
 	}
 
 	// Create MerkleTree
@@ -113,6 +183,32 @@ func (b *Block) getMerkleTree() []byte {
 	return tree.Root.Data
 }
 
+// getWitnessRoot gets the root of the MerkleTree of the WitnessHashes of the Transactions in the Block, nil for legacy
+// Blocks
+func (b *Block) getWitnessRoot() []byte {
+	if b.Version == LegacyBlockVersion {
+		return nil
+	}
+
+	var hashes [][]byte
+	for _, tx := range b.Transactions {
+		hashes = append(hashes, tx.WitnessHash())
+	}
+
+	return InitMerkleTree(hashes).Root.Data
+}
+
+// DeserializeBlockHeader converts a []byte into a BlockHeader for database compatibility
+func DeserializeBlockHeader(data []byte) *BlockHeader {
+	var header BlockHeader
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&header)
+	errutil.Handle(err)
+
+	return &header
+}
+
 // DeserializeBlock converts a []byte into a Block for database compatibility
 func DeserializeBlock(data []byte) *Block {
 	var block Block
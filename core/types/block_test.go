@@ -0,0 +1,90 @@
+package types
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// fromHex decodes a hex string of a test vector
+func fromHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// baselineBlock is the second Block of a chain made by the first version of the node, built with Go 1.17
+func baselineBlock(t *testing.T) *Block {
+	minerHash := fromHex(t, "13676948fdf15cfe3910debb4dd7feb26eb2356c")
+	coinbase := &Transaction{
+		ID:        fromHex(t, "313eb85f77d431071c17776894864c2338952e3f61a81d9bd0f7bc389b239350"),
+		Inputs:    []TxInput{{TxID: []byte{}, OutputIdx: -1, PubKey: []byte("CoinbaseTx: 100 coins to 12mbinaNfmTXG3xmLEQUkfoKJ3hvAtdmvn")}},
+		Outputs:   []TxOutput{{Amount: 100, PubKeyHash: minerHash}},
+		Witnesses: []TxWitness{{}}}
+	payment := &Transaction{
+		ID:      fromHex(t, "e202c6efb2c22956098a6016c1ba9a841b2ce9fdf4a849bfa535181184d08751"),
+		Inputs:  []TxInput{{TxID: coinbase.ID, OutputIdx: 0, PubKey: minerHash}},
+		Outputs: []TxOutput{{Amount: 30, PubKeyHash: fromHex(t, "755fda5d9e1673e17eb2e0e096ae25ccd5dc6d56")}, {Amount: 70, PubKeyHash: minerHash}},
+		Witnesses: []TxWitness{{Signature: fromHex(t, "80e9ee1a8cc7f8d1cd565b2e6af0edb66fd99956dce07a6f791c3f9dcd2f8d64"+
+			"73d934e1f59a6c855de79c5bf02271bb62de97b52c4f9cff0c47a133bf38c6b2")}}}
+
+	return &Block{
+		Version:      LegacyBlockVersion,
+		Index:        1,
+		Nonce:        16808,
+		Difficulty:   Difficulty,
+		Hash:         fromHex(t, "000764dab27adf8d39d5bfc5de55d66dc01b2b41db3ed48d67f956406895416f"),
+		PrevHash:     fromHex(t, "00025629ffea68578ae4ca06d5a4a6b1f9a50fc1ac7be5dabf5fb93ac9181b3f"),
+		TimeStamp:    []byte("2026-10-19 08:52:17.57503154 +0000 UTC m=+0.572008871"),
+		Transactions: []*Transaction{coinbase, payment}}
+}
+
+// TestLegacyBlock checks that only the Hash of a legacy Block is checked, and that it isn't valid as a new Block
+func TestLegacyBlock(t *testing.T) {
+	block := baselineBlock(t)
+	if header := block.Header(); header.MerkleRoot != nil || header.WitnessRoot != nil {
+		t.Fatal("legacy block has a merkle or witness root")
+	}
+	if !block.ValidateProof() {
+		t.Fatal("proof of the baseline block is invalid")
+	}
+
+	block.Hash = bytes.Repeat([]byte{0xff}, len(block.Hash))
+	if block.ValidateProof() {
+		t.Fatal("proof of a legacy block with a hash above the target is valid")
+	}
+
+	block = baselineBlock(t)
+	block.Version = BlockVersion
+	if block.Transactions[1].ValidateID() || block.ValidateProof() {
+		t.Fatal("legacy block is valid as a new block")
+	}
+}
+
+// TestBlockProof checks that the proof of a new Block covers the IDs and TxWitnesses of its Transactions
+func TestBlockProof(t *testing.T) {
+	coinbase := initTransaction([]TxInput{{TxID: []byte{}, OutputIdx: -1, PubKey: []byte("coinbase")}},
+		[]TxOutput{{Amount: CoinbaseReward, PubKeyHash: bytes.Repeat([]byte{1}, 20)}})
+	block := InitBlock([]*Transaction{coinbase}, bytes.Repeat([]byte{2}, 32), 0)
+	if !block.ValidateProof() || !block.Header().ValidateProof() {
+		t.Fatal("proof of a new block is invalid")
+	}
+
+	block.Transactions[0].Outputs[0].Amount++
+	block.Transactions[0].ID = block.Transactions[0].Hash()
+	if block.ValidateProof() {
+		t.Fatal("proof of a block with a changed transaction is valid")
+	}
+	block.Transactions[0].Outputs[0].Amount--
+	block.Transactions[0].ID = block.Transactions[0].Hash()
+
+	block.Transactions[0].Witnesses[0].Signature = []byte{3}
+	if block.ValidateProof() {
+		t.Fatal("proof of a block with a changed witness is valid")
+	}
+}
@@ -0,0 +1,277 @@
+package types
+
+// Canonical binary encoding of Blocks and Transactions, which unlike gob doesn't depend on the Go type definitions -
+// integers are big endian, []byte fields are prefixed with their uint32 length, lists with their uint32 count
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// maxEncodedBytes caps the length of a single []byte field when decoding, so corrupt input can't exhaust memory
+const maxEncodedBytes = 1 << 24
+
+// ErrEncodedTooLarge is returned when decoding a length prefix above maxEncodedBytes
+var ErrEncodedTooLarge = errors.New("Encoded field is too large")
+
+// EncodeBlock writes the canonical encoding of a Block
+func EncodeBlock(w io.Writer, b *Block) error {
+	e := encoder{w: w}
+	e.writeInt(b.Version)
+	e.writeInt(b.Index)
+	e.writeInt(b.Nonce)
+	e.writeInt(b.Difficulty)
+	e.writeBytes(b.Hash)
+	e.writeBytes(b.PrevHash)
+	e.writeBytes(b.TimeStamp)
+	e.writeUint32(uint32(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		e.writeTransaction(tx)
+	}
+
+	return e.err
+}
+
+// DecodeBlock reads a Block from its canonical encoding
+func DecodeBlock(r io.Reader) (*Block, error) {
+	d := decoder{r: r}
+	b := &Block{}
+	b.Version = d.readInt()
+	b.Index = d.readInt()
+	b.Nonce = d.readInt()
+	b.Difficulty = d.readInt()
+	b.Hash = d.readBytes()
+	b.PrevHash = d.readBytes()
+	b.TimeStamp = d.readBytes()
+	count := d.readCount()
+	for i := 0; i < count && d.err == nil; i++ {
+		b.Transactions = append(b.Transactions, d.readTransaction())
+	}
+
+	return b, d.err
+}
+
+// EncodeBlockHeader writes the canonical encoding of a BlockHeader
+func EncodeBlockHeader(w io.Writer, h *BlockHeader) error {
+	e := encoder{w: w}
+	e.writeInt(h.Index)
+	e.writeInt(h.Nonce)
+	e.writeInt(h.Difficulty)
+	e.writeBytes(h.Hash)
+	e.writeBytes(h.PrevHash)
+	e.writeBytes(h.TimeStamp)
+	e.writeBytes(h.MerkleRoot)
+	e.writeBytes(h.WitnessRoot)
+
+	return e.err
+}
+
+// DecodeBlockHeader reads a BlockHeader from its canonical encoding
+func DecodeBlockHeader(r io.Reader) (*BlockHeader, error) {
+	d := decoder{r: r}
+	h := &BlockHeader{}
+	h.Index = d.readInt()
+	h.Nonce = d.readInt()
+	h.Difficulty = d.readInt()
+	h.Hash = d.readBytes()
+	h.PrevHash = d.readBytes()
+	h.TimeStamp = d.readBytes()
+	h.MerkleRoot = d.readBytes()
+	h.WitnessRoot = d.readBytes()
+
+	return h, d.err
+}
+
+// EncodeTransaction writes the canonical encoding of a Transaction
+func EncodeTransaction(w io.Writer, tx *Transaction) error {
+	e := encoder{w: w}
+	e.writeTransaction(tx)
+
+	return e.err
+}
+
+// DecodeTransaction reads a Transaction from its canonical encoding
+func DecodeTransaction(r io.Reader) (*Transaction, error) {
+	d := decoder{r: r}
+	tx := d.readTransaction()
+
+	return tx, d.err
+}
+
+// EncodeUTXOEntry writes the canonical encoding of the unspent TxOutputs of a Transaction, in order of their idx
+func EncodeUTXOEntry(w io.Writer, txID []byte, txos TxOutputs) error {
+	idxs := make([]int, 0, len(txos.Outputs))
+	for idx := range txos.Outputs {
+		idxs = append(idxs, idx)
+	}
+	sort.Ints(idxs)
+
+	e := encoder{w: w}
+	e.writeBytes(txID)
+	e.writeUint32(uint32(len(idxs)))
+	for _, idx := range idxs {
+		e.writeUint32(uint32(idx))
+		e.writeInt(txos.Outputs[idx].Amount)
+		e.writeBytes(txos.Outputs[idx].PubKeyHash)
+	}
+
+	return e.err
+}
+
+// DecodeUTXOEntry reads the ID and unspent TxOutputs of a Transaction from their canonical encoding
+func DecodeUTXOEntry(r io.Reader) ([]byte, TxOutputs, error) {
+	d := decoder{r: r}
+	txID := d.readBytes()
+	txos := TxOutputs{Outputs: make(map[int]TxOutput)}
+	count := d.readCount()
+	for i := 0; i < count && d.err == nil; i++ {
+		idx := d.readCount()
+		txo := TxOutput{}
+		txo.Amount = d.readInt()
+		txo.PubKeyHash = d.readBytes()
+		txos.Outputs[idx] = txo
+	}
+
+	return txID, txos, d.err
+}
+
+// serializeTransaction gets the canonical encoding of a Transaction, which is what gets hashed - unlike gob it is the
+// same whatever else the process has encoded
+func serializeTransaction(tx *Transaction) []byte {
+	var buf bytes.Buffer
+	e := encoder{w: &buf}
+	e.writeTransaction(tx)
+
+	return buf.Bytes()
+}
+
+// encoder writes canonical encodings, keeping the first error so callers can check once at the end
+type encoder struct {
+	w   io.Writer
+	err error
+}
+
+// writeTransaction writes the canonical encoding of a Transaction - the TxWitness of each txin is written in the txin,
+// where its signature was before TxWitnesses, so leaving them out gives the encoding IDs are the hash of. A HashType
+// other than SigHashDefault is the byte after the signature
+func (e *encoder) writeTransaction(tx *Transaction) {
+	e.writeBytes(tx.ID)
+	e.writeUint32(uint32(len(tx.Inputs)))
+	for txinID, txin := range tx.Inputs {
+		e.writeBytes(txin.TxID)
+		e.writeInt(txin.OutputIdx)
+		e.writeBytes(tx.witness(txinID).encodeSignature())
+		e.writeBytes(txin.PubKey)
+	}
+	e.writeUint32(uint32(len(tx.Outputs)))
+	for _, txo := range tx.Outputs {
+		e.writeInt(txo.Amount)
+		e.writeBytes(txo.PubKeyHash)
+	}
+}
+
+// writeInt writes an int as 8 bytes
+func (e *encoder) writeInt(n int) {
+	if e.err == nil {
+		e.err = binary.Write(e.w, binary.BigEndian, int64(n))
+	}
+}
+
+// writeUint32 writes a uint32 as 4 bytes
+func (e *encoder) writeUint32(n uint32) {
+	if e.err == nil {
+		e.err = binary.Write(e.w, binary.BigEndian, n)
+	}
+}
+
+// writeBytes writes a []byte prefixed with its length
+func (e *encoder) writeBytes(b []byte) {
+	e.writeUint32(uint32(len(b)))
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+// decoder reads canonical encodings, keeping the first error so callers can check once at the end
+type decoder struct {
+	r   io.Reader
+	err error
+}
+
+// readTransaction reads a Transaction from its canonical encoding
+func (d *decoder) readTransaction() *Transaction {
+	tx := &Transaction{}
+	tx.ID = d.readBytes()
+	count := d.readCount()
+	for i := 0; i < count && d.err == nil; i++ {
+		txin := TxInput{}
+		txin.TxID = d.readBytes()
+		txin.OutputIdx = d.readInt()
+		witness := d.readWitness()
+		txin.PubKey = d.readBytes()
+		tx.Inputs = append(tx.Inputs, txin)
+		tx.Witnesses = append(tx.Witnesses, witness)
+	}
+	count = d.readCount()
+	for i := 0; i < count && d.err == nil; i++ {
+		txo := TxOutput{}
+		txo.Amount = d.readInt()
+		txo.PubKeyHash = d.readBytes()
+		tx.Outputs = append(tx.Outputs, txo)
+	}
+
+	return tx
+}
+
+// readInt reads an int written as 8 bytes
+func (d *decoder) readInt() int {
+	var n int64
+	if d.err == nil {
+		d.err = binary.Read(d.r, binary.BigEndian, &n)
+	}
+
+	return int(n)
+}
+
+// readCount reads the uint32 count of a list
+func (d *decoder) readCount() int {
+	var n uint32
+	if d.err == nil {
+		d.err = binary.Read(d.r, binary.BigEndian, &n)
+	}
+
+	return int(n)
+}
+
+// readWitness reads a TxWitness from its encoded signature
+func (d *decoder) readWitness() TxWitness {
+	signature := d.readBytes()
+	if d.err != nil {
+		return TxWitness{}
+	}
+
+	witness, err := decodeWitness(signature)
+	d.err = err
+
+	return witness
+}
+
+// readBytes reads a []byte prefixed with its length, empty fields decode as nil like they do with gob
+func (d *decoder) readBytes() []byte {
+	n := d.readCount()
+	if d.err != nil || n == 0 {
+		return nil
+	}
+	if n > maxEncodedBytes {
+		d.err = ErrEncodedTooLarge
+		return nil
+	}
+
+	b := make([]byte, n)
+	_, d.err = io.ReadFull(d.r, b)
+
+	return b
+}
@@ -0,0 +1,339 @@
+package types
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/danitello/go-blockchain/common/keys"
+)
+
+// musig_session is signing txins locked with a MuSig aggregated pub key in PartialTransactions - the cosigners add
+// their public nonces to the file, then their partial signatures once every nonce is in, and the last partial signature
+// is combined into the Schnorr signature of the txin
+
+var (
+	// ErrNoMuSigInputs is returned when no unsigned txin of a PartialTransaction is locked with the aggregate of the
+	// pub keys of a MuSigSession
+	ErrNoMuSigInputs = errors.New("No unsigned input is locked with the aggregate of these public keys")
+)
+
+// MuSigSession is the progress of the cosigners of a txin towards its signature -
+// PubKeys - the Schnorr pub keys of the cosigners in ascending order, aggregated into the pub key of the txin
+// Nonces - the public nonce of the cosigner of the pub key at the same idx, nil until it is added
+// Partials - the partial signature of the cosigner of the pub key at the same idx, nil until it signs
+type MuSigSession struct {
+	PubKeys  [][]byte
+	Nonces   [][]byte
+	Partials [][]byte
+}
+
+// newMuSigSession makes a MuSigSession with no nonces or partial signatures yet
+func newMuSigSession(pubKeys [][]byte) *MuSigSession {
+	return &MuSigSession{
+		PubKeys:  pubKeys,
+		Nonces:   make([][]byte, len(pubKeys)),
+		Partials: make([][]byte, len(pubKeys)),
+	}
+}
+
+// hasNonces determines if every cosigner of a MuSigSession has added its nonce
+func (session *MuSigSession) hasNonces() bool {
+	return countSet(session.Nonces) == len(session.PubKeys)
+}
+
+// isComplete determines if every cosigner of a MuSigSession has signed
+func (session *MuSigSession) isComplete() bool {
+	return countSet(session.Partials) == len(session.PubKeys)
+}
+
+// check makes sure a MuSigSession is well formed and its pub keys aggregate into a pub key
+func (session *MuSigSession) check(pubKey []byte) error {
+	if len(session.Nonces) != len(session.PubKeys) || len(session.Partials) != len(session.PubKeys) {
+		return errors.New("MuSig session needs a nonce and partial signature for each cosigner")
+	}
+	aggPubKey, err := keys.AggregatePubKeys(session.PubKeys)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(aggPubKey, pubKey) {
+		return errors.New("MuSig session public keys do not aggregate into the key of its input")
+	}
+
+	for i := range session.PubKeys {
+		if i > 0 && bytes.Compare(session.PubKeys[i-1], session.PubKeys[i]) >= 0 {
+			return errors.New("MuSig session public keys are not in ascending order")
+		}
+		if session.Nonces[i] != nil && len(session.Nonces[i]) != keys.MuSigNonceLen {
+			return keys.ErrInvalidNonce
+		}
+		if session.Partials[i] != nil && (len(session.Partials[i]) != keys.MuSigPartialLen || !session.hasNonces()) {
+			return errors.New("Invalid MuSig partial signature")
+		}
+	}
+
+	return nil
+}
+
+// merge adds the nonces and partial signatures of another MuSigSession of the same cosigners
+func (session *MuSigSession) merge(other *MuSigSession) error {
+	if !sameKeys(session.PubKeys, other.PubKeys) {
+		return errors.New("MuSig sessions have different cosigners")
+	}
+
+	for i := range session.PubKeys {
+		if err := mergeField(&session.Nonces[i], other.Nonces[i]); err != nil {
+			return fmt.Errorf("Cosigner %x has different nonces", session.PubKeys[i])
+		}
+		if err := mergeField(&session.Partials[i], other.Partials[i]); err != nil {
+			return fmt.Errorf("Cosigner %x has different partial signatures", session.PubKeys[i])
+		}
+	}
+
+	return nil
+}
+
+// mergeField sets a nonce or partial signature not added yet, failing if it was added with another value
+func mergeField(field *[]byte, value []byte) error {
+	if value == nil {
+		return nil
+	}
+	if *field != nil && !bytes.Equal(*field, value) {
+		return errors.New("Conflicting values")
+	}
+	*field = value
+
+	return nil
+}
+
+// StartMuSig starts a MuSigSession for each unsigned txin locked with the aggregate of Schnorr pub keys, keeping the
+// ones already started - returns the idxs of the txins
+func (ptx *PartialTransaction) StartMuSig(pubKeys [][]byte) ([]int, error) {
+	aggPubKey, err := keys.AggregatePubKeys(pubKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	// The order of the pub keys doesn't change the aggregate, so sessions keep them sorted to be merged
+	sorted := append([][]byte{}, pubKeys...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+
+	var txinIDs []int
+	for txinID, txin := range ptx.Tx.Inputs {
+		if ptx.Tx.Witnesses[txinID].Signature != nil || !bytes.Equal(txin.PubKey, aggPubKey) {
+			continue
+		}
+
+		if session, ok := ptx.MuSig[txinID]; ok {
+			if !sameKeys(session.PubKeys, sorted) {
+				return nil, fmt.Errorf("Input %d has a MuSig session of other cosigners", txinID)
+			}
+		} else {
+			if ptx.MuSig == nil {
+				ptx.MuSig = make(map[int]*MuSigSession)
+			}
+			ptx.MuSig[txinID] = newMuSigSession(sorted)
+		}
+		txinIDs = append(txinIDs, txinID)
+	}
+	if len(txinIDs) == 0 {
+		return nil, ErrNoMuSigInputs
+	}
+
+	return txinIDs, nil
+}
+
+// AddMuSigNonces adds a public nonce for each cosigner of each MuSigSession that newNonce makes one for, unless it
+// has one already - returns the number added
+func (ptx *PartialTransaction) AddMuSigNonces(newNonce func(pubKey []byte) ([]byte, bool, error)) (int, error) {
+	added := 0
+	for _, txinID := range ptx.muSigInputs() {
+		session := ptx.MuSig[txinID]
+		for i, pubKey := range session.PubKeys {
+			if session.Nonces[i] != nil {
+				continue
+			}
+
+			nonce, ok, err := newNonce(pubKey)
+			if err != nil {
+				return added, fmt.Errorf("Input %d: %s", txinID, err)
+			}
+			if ok {
+				session.Nonces[i] = nonce
+				added++
+			}
+		}
+	}
+
+	return added, nil
+}
+
+// MuSigSign adds a partial signature for each cosigner of each MuSigSession with every nonce in that sign makes one
+// for, with the nonce it added - completed sessions are combined into the Schnorr signatures of their txins.
+// Returns the number of partial signatures added
+func (ptx *PartialTransaction) MuSigSign(sign func(pubKey, nonce []byte, pubKeys [][]byte, aggNonce, hash []byte) ([]byte, bool, error)) (int, error) {
+	signed := 0
+	for _, txinID := range ptx.muSigInputs() {
+		session := ptx.MuSig[txinID]
+		if !session.hasNonces() {
+			continue
+		}
+
+		aggNonce, err := keys.AggregateNonces(session.Nonces)
+		if err != nil {
+			return signed, fmt.Errorf("Input %d: %s", txinID, err)
+		}
+		hash, err := ptx.Tx.signatureHash(txinID, SigHashDefault, ptx.PrevOutputs)
+		if err != nil {
+			return signed, fmt.Errorf("Input %d: %s", txinID, err)
+		}
+
+		for i, pubKey := range session.PubKeys {
+			if session.Partials[i] != nil {
+				continue
+			}
+
+			partial, ok, err := sign(pubKey, session.Nonces[i], session.PubKeys, aggNonce, hash)
+			if err != nil {
+				return signed, fmt.Errorf("Input %d: %s", txinID, err)
+			}
+			if ok {
+				session.Partials[i] = partial
+				signed++
+			}
+		}
+
+		if err := ptx.finishMuSig(txinID); err != nil {
+			return signed, err
+		}
+	}
+
+	return signed, nil
+}
+
+// CombineMuSigSessions joins copies of a PartialTransaction that cosigners added nonces, partial signatures and
+// signatures to separately into one
+func CombineMuSigSessions(ptxs []*PartialTransaction) (*PartialTransaction, error) {
+	if len(ptxs) == 0 {
+		return nil, errors.New("No transactions to combine")
+	}
+
+	first := ptxs[0]
+	combined := &PartialTransaction{Network: first.Network, PrevOutputs: first.PrevOutputs, MuSig: make(map[int]*MuSigSession)}
+	txCopy := *first.Tx
+	txCopy.Witnesses = append([]TxWitness{}, first.Tx.Witnesses...)
+	combined.Tx = &txCopy
+
+	for i, ptx := range ptxs {
+		if ptx.Network != first.Network {
+			return nil, fmt.Errorf("Transaction %d is for network %q, not %q", i, ptx.Network, first.Network)
+		}
+		if !bytes.Equal(ptx.Tx.ID, first.Tx.ID) {
+			return nil, fmt.Errorf("Transaction %d is %x, not %x", i, ptx.Tx.ID, first.Tx.ID)
+		}
+
+		for txinID, witness := range ptx.Tx.Witnesses {
+			if witness.Signature != nil && combined.Tx.Witnesses[txinID].Signature == nil {
+				combined.Tx.Witnesses[txinID] = witness
+				delete(combined.MuSig, txinID)
+			}
+		}
+
+		for _, txinID := range ptx.muSigInputs() {
+			if combined.Tx.Witnesses[txinID].Signature != nil {
+				continue
+			}
+
+			session := ptx.MuSig[txinID]
+			if existing, ok := combined.MuSig[txinID]; ok {
+				if err := existing.merge(session); err != nil {
+					return nil, fmt.Errorf("Transaction %d input %d: %s", i, txinID, err)
+				}
+			} else {
+				combined.MuSig[txinID] = &MuSigSession{
+					PubKeys:  session.PubKeys,
+					Nonces:   append([][]byte{}, session.Nonces...),
+					Partials: append([][]byte{}, session.Partials...),
+				}
+			}
+		}
+	}
+
+	for _, txinID := range combined.muSigInputs() {
+		if err := combined.finishMuSig(txinID); err != nil {
+			return nil, err
+		}
+	}
+
+	return combined, combined.Check()
+}
+
+// finishMuSig combines the partial signatures of a complete MuSigSession into the signature of its txin, which ends
+// the session
+func (ptx *PartialTransaction) finishMuSig(txinID int) error {
+	session := ptx.MuSig[txinID]
+	if !session.isComplete() {
+		return nil
+	}
+
+	aggNonce, err := keys.AggregateNonces(session.Nonces)
+	if err != nil {
+		return fmt.Errorf("Input %d: %s", txinID, err)
+	}
+	hash, err := ptx.Tx.signatureHash(txinID, SigHashDefault, ptx.PrevOutputs)
+	if err != nil {
+		return fmt.Errorf("Input %d: %s", txinID, err)
+	}
+	signature, err := keys.CombineMuSig(session.PubKeys, aggNonce, hash, session.Partials)
+	if err != nil {
+		return fmt.Errorf("Input %d: %s", txinID, err)
+	}
+
+	ptx.Tx.Witnesses[txinID] = TxWitness{Signature: signature, HashType: SigHashDefault}
+	if !ptx.Tx.VerifyInput(txinID, ptx.PrevOutputs) {
+		ptx.Tx.Witnesses[txinID] = TxWitness{}
+		return fmt.Errorf("Input %d: MuSig partial signatures combine into an invalid signature", txinID)
+	}
+	delete(ptx.MuSig, txinID)
+
+	return nil
+}
+
+// muSigInputs gets the idxs of the txins with a MuSigSession in ascending order
+func (ptx *PartialTransaction) muSigInputs() []int {
+	var txinIDs []int
+	for txinID := range ptx.MuSig {
+		txinIDs = append(txinIDs, txinID)
+	}
+	sort.Ints(txinIDs)
+
+	return txinIDs
+}
+
+// sameKeys determines if two lists of pub keys are the same
+func sameKeys(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// countSet gets the number of fields that are set
+func countSet(fields [][]byte) int {
+	n := 0
+	for _, field := range fields {
+		if field != nil {
+			n++
+		}
+	}
+
+	return n
+}
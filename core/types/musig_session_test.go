@@ -0,0 +1,145 @@
+package types
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"testing"
+
+	"github.com/danitello/go-blockchain/common/keys"
+	"github.com/danitello/go-blockchain/wallet"
+)
+
+// cosigner is a holder of one of the keys of a MuSig aggregated pub key in a test, with its secret nonces by public nonce
+type cosigner struct {
+	privKey ecdsa.PrivateKey
+	pubKey  []byte
+	nonces  map[string]*keys.MuSigNonce
+}
+
+// newNonce makes a nonce if the pub key is the cosigner's
+func (c *cosigner) newNonce(pubKey []byte) ([]byte, bool, error) {
+	if !bytes.Equal(pubKey, c.pubKey) {
+		return nil, false, nil
+	}
+
+	nonce, err := keys.NewMuSigNonce()
+	if err != nil {
+		return nil, false, err
+	}
+	c.nonces[hex.EncodeToString(nonce.Public)] = nonce
+
+	return nonce.Public, true, nil
+}
+
+// sign makes a partial signature with the nonce the cosigner added
+func (c *cosigner) sign(pubKey, pubNonce []byte, pubKeys [][]byte, aggNonce, hash []byte) ([]byte, bool, error) {
+	nonce, ok := c.nonces[hex.EncodeToString(pubNonce)]
+	if !ok {
+		return nil, false, nil
+	}
+
+	partial, err := keys.MuSigSign(c.privKey, nonce, pubKeys, aggNonce, hash)
+	return partial, err == nil, err
+}
+
+// roundTrip encodes and decodes a PartialTransaction, as passing the file to a cosigner does
+func roundTrip(t *testing.T, ptx *PartialTransaction) *PartialTransaction {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := EncodePartialTransaction(&buf, ptx); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodePartialTransaction(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return decoded
+}
+
+// TestMuSigSession signs a txin locked with an aggregated pub key by cosigners working on their own copies of the file
+func TestMuSigSession(t *testing.T) {
+	var cosigners []*cosigner
+	var pubKeys [][]byte
+	for i := 0; i < 3; i++ {
+		privKey, err := keys.GenerateKey(keys.Secp256k1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := &cosigner{privKey, keys.EncodeSchnorrPubKey(privKey.PublicKey), make(map[string]*keys.MuSigNonce)}
+		cosigners = append(cosigners, c)
+		pubKeys = append(pubKeys, c.pubKey)
+	}
+	aggPubKey, err := keys.AggregatePubKeys(pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prevOutputs := []TxOutput{{Amount: 50, PubKeyHash: wallet.HashPubKey(aggPubKey)}}
+	tx := initTransaction([]TxInput{{TxID: bytes.Repeat([]byte{1}, 32), OutputIdx: 0, PubKey: aggPubKey}},
+		[]TxOutput{{Amount: 40, PubKeyHash: bytes.Repeat([]byte{2}, 20)}})
+	ptx := &PartialTransaction{Network: "regtest", Tx: tx, PrevOutputs: prevOutputs}
+
+	// Files without sessions stay readable by older versions
+	var buf bytes.Buffer
+	if err := EncodePartialTransaction(&buf, ptx); err != nil {
+		t.Fatal(err)
+	}
+	if version := buf.Bytes()[len(partialTxMagic)+3]; version != partialTxVersionNoMuSig {
+		t.Errorf("got version %d without MuSig sessions, want %d", version, partialTxVersionNoMuSig)
+	}
+
+	// The cosigners list their keys in any order
+	if txinIDs, err := ptx.StartMuSig([][]byte{pubKeys[2], pubKeys[0], pubKeys[1]}); err != nil || len(txinIDs) != 1 {
+		t.Fatalf("got inputs %v, %v", txinIDs, err)
+	}
+	if _, err := ptx.StartMuSig(pubKeys[:2]); err != ErrNoMuSigInputs {
+		t.Errorf("got %v starting a session of other keys, want %v", err, ErrNoMuSigInputs)
+	}
+
+	// Each cosigner adds its nonce to its own copy, then signs its copy of the combined nonces
+	var copies []*PartialTransaction
+	for _, c := range cosigners {
+		cp := roundTrip(t, ptx)
+		if added, err := cp.AddMuSigNonces(c.newNonce); err != nil || added != 1 {
+			t.Fatalf("got %d nonces added, %v", added, err)
+		}
+		if signed, err := cp.MuSigSign(c.sign); err != nil || signed != 0 {
+			t.Fatalf("got %d signed before every nonce is in, %v", signed, err)
+		}
+		copies = append(copies, roundTrip(t, cp))
+	}
+	withNonces, err := CombineMuSigSessions(copies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copies = nil
+	for _, c := range cosigners {
+		cp := roundTrip(t, withNonces)
+		if signed, err := cp.MuSigSign(c.sign); err != nil || signed != 1 {
+			t.Fatalf("got %d signed, %v", signed, err)
+		}
+		copies = append(copies, roundTrip(t, cp))
+	}
+	if copies[0].Unsigned() != 1 || len(copies[0].MuSig) != 1 {
+		t.Fatal("input is signed before every cosigner has")
+	}
+
+	signed, err := CombineMuSigSessions(copies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Unsigned() != 0 || len(signed.MuSig) != 0 || !signed.Tx.VerifyInput(0, prevOutputs) {
+		t.Fatal("input is not signed once every cosigner has")
+	}
+
+	// A cosigner whose copy has another nonce can't be combined with the others
+	other := roundTrip(t, ptx)
+	other.AddMuSigNonces(cosigners[0].newNonce)
+	if _, err := CombineMuSigSessions([]*PartialTransaction{withNonces, other}); err == nil {
+		t.Error("combined a session with two nonces of a cosigner")
+	}
+}
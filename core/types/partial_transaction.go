@@ -0,0 +1,282 @@
+package types
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// partial_transaction is Transactions passed around to be signed away from the chain - the file starts with
+// partialTxMagic, the format version and the network name, then the canonical encoding of the Transaction and the
+// count, amount and pub key hash of the txos its txins spend. Version 2 adds the count of MuSigSessions, then for
+// each the idx of its txin and the count of cosigners, with the pub key, nonce and partial signature of each
+
+const (
+	// partialTxVersion is the version of files with MuSigSessions, the others are written as partialTxVersionNoMuSig
+	// so older versions can still read them
+	partialTxVersion        = 2
+	partialTxVersionNoMuSig = 1
+)
+
+var (
+	partialTxMagic = []byte("GBPT")
+
+	// ErrNotPartialTransaction is returned when reading a file that isn't a PartialTransaction
+	ErrNotPartialTransaction = errors.New("Not a partially signed transaction file")
+)
+
+// PartialTransaction is a Transaction whose txins may not all be signed yet, along with the txos they spend, which is
+// all signing needs -
+// Network - name of the network the Transaction is for
+// PrevOutputs - the txo spent by the txin at the same idx
+// MuSig - the MuSigSession of each unsigned txin its cosigners are signing, by txin idx
+type PartialTransaction struct {
+	Network     string
+	Tx          *Transaction
+	PrevOutputs []TxOutput
+	MuSig       map[int]*MuSigSession
+}
+
+// Check makes sure a PartialTransaction is consistent - its ID matches its contents, each txin uses the key its txo
+// is locked with, the txins signed so far are signed correctly, and the MuSigSessions are of unsigned txins
+func (ptx *PartialTransaction) Check() error {
+	if !ptx.Tx.ValidateID() {
+		return errors.New("Transaction ID does not match its contents")
+	}
+	if ptx.Tx.IsCoinbase() || len(ptx.PrevOutputs) != len(ptx.Tx.Inputs) {
+		return errors.New("Transaction needs the output spent by each of its inputs")
+	}
+
+	if !ptx.Tx.ValidateWitnesses() {
+		return errors.New("Transaction needs a witness for each of its inputs")
+	}
+
+	for txinID, txin := range ptx.Tx.Inputs {
+		if !txin.UsesKey(ptx.PrevOutputs[txinID].PubKeyHash) {
+			return fmt.Errorf("Input %d does not use the key the output it spends is locked with", txinID)
+		}
+		if ptx.Tx.Witnesses[txinID].Signature != nil && !ptx.Tx.VerifyInput(txinID, ptx.PrevOutputs) {
+			return fmt.Errorf("Input %d has an invalid signature", txinID)
+		}
+	}
+
+	for txinID, session := range ptx.MuSig {
+		if txinID < 0 || txinID >= len(ptx.Tx.Inputs) || ptx.Tx.Witnesses[txinID].Signature != nil {
+			return fmt.Errorf("Input %d is not an unsigned input to sign with MuSig", txinID)
+		}
+		if err := session.check(ptx.Tx.Inputs[txinID].PubKey); err != nil {
+			return fmt.Errorf("Input %d: %s", txinID, err)
+		}
+	}
+
+	return nil
+}
+
+// Sign signs each txin not signed yet whose txo is locked with a key getKey has, covering what a SigHashType
+// selects - returns the number signed
+func (ptx *PartialTransaction) Sign(hashType SigHashType, getKey func(pubKeyHash []byte) (ecdsa.PrivateKey, bool)) (int, error) {
+	signed := 0
+	for txinID := range ptx.Tx.Inputs {
+		if ptx.Tx.Witnesses[txinID].Signature != nil {
+			continue
+		}
+
+		if privKey, ok := getKey(ptx.PrevOutputs[txinID].PubKeyHash); ok {
+			if err := ptx.Tx.SignInputWithHashType(txinID, hashType, privKey, ptx.PrevOutputs); err != nil {
+				return signed, fmt.Errorf("Input %d: %s", txinID, err)
+			}
+			signed++
+		}
+	}
+
+	return signed, nil
+}
+
+// CombinePartialTransactions joins the txins of PartialTransactions paying the same txos into one, like pledges
+// towards one payment - the txins signed so far must be signed with SigHashAnyoneCanPay, as others' signatures cover
+// the txins they were signed with
+func CombinePartialTransactions(ptxs []*PartialTransaction) (*PartialTransaction, error) {
+	if len(ptxs) == 0 {
+		return nil, errors.New("No transactions to combine")
+	}
+
+	first := ptxs[0]
+	combined := &PartialTransaction{Network: first.Network}
+	var inputs []TxInput
+	var witnesses []TxWitness
+	spent := make(map[string]bool)
+
+	for i, ptx := range ptxs {
+		if ptx.Network != first.Network {
+			return nil, fmt.Errorf("Transaction %d is for network %q, not %q", i, ptx.Network, first.Network)
+		}
+		if !sameOutputs(ptx.Tx.Outputs, first.Tx.Outputs) {
+			return nil, fmt.Errorf("Transaction %d pays other outputs than the first", i)
+		}
+
+		for txinID, txin := range ptx.Tx.Inputs {
+			witness := ptx.Tx.Witnesses[txinID]
+			if witness.Signature != nil && !witness.HashType.AnyoneCanPay() {
+				return nil, fmt.Errorf("Transaction %d input %d is signed with %s, which covers the other inputs", i, txinID, witness.HashType)
+			}
+
+			// Nonces are for any hash, but partial signatures cover the other inputs like a signature does
+			if session, ok := ptx.MuSig[txinID]; ok {
+				if countSet(session.Partials) > 0 {
+					return nil, fmt.Errorf("Transaction %d input %d has MuSig partial signatures, which cover the other inputs", i, txinID)
+				}
+				if combined.MuSig == nil {
+					combined.MuSig = make(map[int]*MuSigSession)
+				}
+				combined.MuSig[len(inputs)] = session
+			}
+
+			op := fmt.Sprintf("%x:%d", txin.TxID, txin.OutputIdx)
+			if spent[op] {
+				return nil, fmt.Errorf("Output %s is spent by more than one input", op)
+			}
+			spent[op] = true
+
+			inputs = append(inputs, txin)
+			witnesses = append(witnesses, witness)
+			combined.PrevOutputs = append(combined.PrevOutputs, ptx.PrevOutputs[txinID])
+		}
+	}
+
+	combined.Tx = initTransaction(inputs, first.Tx.Outputs)
+	combined.Tx.Witnesses = witnesses
+
+	return combined, combined.Check()
+}
+
+// sameOutputs determines if two lists of txos are the same
+func sameOutputs(a, b []TxOutput) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Amount != b[i].Amount || !bytes.Equal(a[i].PubKeyHash, b[i].PubKeyHash) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Unsigned gets the number of txins not signed yet
+func (ptx *PartialTransaction) Unsigned() int {
+	unsigned := 0
+	for _, witness := range ptx.Tx.Witnesses {
+		if witness.Signature == nil {
+			unsigned++
+		}
+	}
+
+	return unsigned
+}
+
+// Fee gets the amount spent by the txins that the txos don't pay out
+func (ptx *PartialTransaction) Fee() int {
+	fee := 0
+	for _, txo := range ptx.PrevOutputs {
+		fee += txo.Amount
+	}
+	for _, txo := range ptx.Tx.Outputs {
+		fee -= txo.Amount
+	}
+
+	return fee
+}
+
+// EncodePartialTransaction writes a PartialTransaction to a file
+func EncodePartialTransaction(w io.Writer, ptx *PartialTransaction) error {
+	bw := bufio.NewWriter(w)
+	e := encoder{w: bw}
+	if _, err := bw.Write(partialTxMagic); err != nil {
+		return err
+	}
+	version := partialTxVersionNoMuSig
+	if len(ptx.MuSig) > 0 {
+		version = partialTxVersion
+	}
+	e.writeUint32(uint32(version))
+	e.writeBytes([]byte(ptx.Network))
+	e.writeTransaction(ptx.Tx)
+	e.writeUint32(uint32(len(ptx.PrevOutputs)))
+	for _, txo := range ptx.PrevOutputs {
+		e.writeInt(txo.Amount)
+		e.writeBytes(txo.PubKeyHash)
+	}
+	if version == partialTxVersion {
+		e.writeUint32(uint32(len(ptx.MuSig)))
+		for _, txinID := range ptx.muSigInputs() {
+			session := ptx.MuSig[txinID]
+			e.writeUint32(uint32(txinID))
+			e.writeUint32(uint32(len(session.PubKeys)))
+			for i := range session.PubKeys {
+				e.writeBytes(session.PubKeys[i])
+				e.writeBytes(session.Nonces[i])
+				e.writeBytes(session.Partials[i])
+			}
+		}
+	}
+	if e.err != nil {
+		return e.err
+	}
+
+	return bw.Flush()
+}
+
+// DecodePartialTransaction reads a PartialTransaction from a file
+func DecodePartialTransaction(r io.Reader) (*PartialTransaction, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(partialTxMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, partialTxMagic) {
+		return nil, ErrNotPartialTransaction
+	}
+
+	d := decoder{r: br}
+	version := d.readCount()
+	if d.err == nil && version != partialTxVersion && version != partialTxVersionNoMuSig {
+		return nil, fmt.Errorf("Unsupported partially signed transaction version %d", version)
+	}
+	ptx := &PartialTransaction{}
+	ptx.Network = string(d.readBytes())
+	ptx.Tx = d.readTransaction()
+	count := d.readCount()
+	for i := 0; i < count && d.err == nil; i++ {
+		txo := TxOutput{}
+		txo.Amount = d.readInt()
+		txo.PubKeyHash = d.readBytes()
+		ptx.PrevOutputs = append(ptx.PrevOutputs, txo)
+	}
+	if version == partialTxVersion {
+		count = d.readCount()
+		for i := 0; i < count && d.err == nil; i++ {
+			txinID := d.readCount()
+			session := &MuSigSession{}
+			cosigners := d.readCount()
+			for j := 0; j < cosigners && d.err == nil; j++ {
+				session.PubKeys = append(session.PubKeys, d.readBytes())
+				session.Nonces = append(session.Nonces, d.readBytes())
+				session.Partials = append(session.Partials, d.readBytes())
+			}
+			if _, ok := ptx.MuSig[txinID]; ok {
+				return nil, fmt.Errorf("Input %d has more than one MuSig session", txinID)
+			}
+			if ptx.MuSig == nil {
+				ptx.MuSig = make(map[int]*MuSigSession)
+			}
+			ptx.MuSig[txinID] = session
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return ptx, ptx.Check()
+}
@@ -0,0 +1,102 @@
+package types
+
+// sighash is choosing what part of a Transaction the signature of a txin covers, with the SigHashType in its
+// TxWitness - by default everything, or just some of the txos, or only the txin itself among the txins so others can
+// add theirs afterwards (like many people funding one fixed txo)
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SigHashType selects what the signature of a txin covers - a base type, optionally with SigHashAnyoneCanPay
+type SigHashType byte
+
+const (
+	// SigHashDefault covers every txin and txo like SigHashAll, and is left out of the encoding of the signature
+	SigHashDefault = SigHashType(0x00)
+	// SigHashAll covers every txo
+	SigHashAll = SigHashType(0x01)
+	// SigHashNone covers no txo, so whoever spends the other txins chooses where the coins go
+	SigHashNone = SigHashType(0x02)
+	// SigHashSingle covers only the txo at the idx of the txin
+	SigHashSingle = SigHashType(0x03)
+	// SigHashAnyoneCanPay covers only the txin being signed among the txins, so more can be added
+	SigHashAnyoneCanPay = SigHashType(0x80)
+
+	// sigHashBaseMask selects the base type of a SigHashType
+	sigHashBaseMask = SigHashType(0x1f)
+)
+
+// ErrSigHashSingle is returned when signing or verifying a txin with SigHashSingle without a txo at its idx
+var ErrSigHashSingle = errors.New("SIGHASH_SINGLE input has no output at its index")
+
+// ParseSigHashType gets the SigHashType of its name - ALL, NONE or SINGLE, optionally followed by |ANYONECANPAY
+func ParseSigHashType(name string) (SigHashType, error) {
+	parts := strings.Split(strings.ToUpper(strings.TrimSpace(name)), "|")
+
+	var hashType SigHashType
+	switch parts[0] {
+	case "ALL":
+		hashType = SigHashAll
+	case "NONE":
+		hashType = SigHashNone
+	case "SINGLE":
+		hashType = SigHashSingle
+	default:
+		return 0, fmt.Errorf("Unknown signature hash type %q, use ALL, NONE or SINGLE, optionally with |ANYONECANPAY", name)
+	}
+
+	if len(parts) == 2 && parts[1] == "ANYONECANPAY" {
+		hashType |= SigHashAnyoneCanPay
+	} else if len(parts) > 1 {
+		return 0, fmt.Errorf("Unknown signature hash type %q, use ALL, NONE or SINGLE, optionally with |ANYONECANPAY", name)
+	}
+
+	return hashType, nil
+}
+
+// Valid determines if a SigHashType is SigHashDefault or a base type, optionally with SigHashAnyoneCanPay
+func (t SigHashType) Valid() bool {
+	if t == SigHashDefault {
+		return true
+	}
+
+	base := t.base()
+	return (base == SigHashAll || base == SigHashNone || base == SigHashSingle) && t&^(sigHashBaseMask|SigHashAnyoneCanPay) == 0
+}
+
+// AnyoneCanPay determines if a SigHashType covers only the txin being signed among the txins
+func (t SigHashType) AnyoneCanPay() bool {
+	return t&SigHashAnyoneCanPay != 0
+}
+
+// base gets the base type of a SigHashType, SigHashAll for SigHashDefault
+func (t SigHashType) base() SigHashType {
+	if t == SigHashDefault {
+		return SigHashAll
+	}
+
+	return t & sigHashBaseMask
+}
+
+// String gets the name of a SigHashType
+func (t SigHashType) String() string {
+	var name string
+	switch t.base() {
+	case SigHashAll:
+		name = "ALL"
+	case SigHashNone:
+		name = "NONE"
+	case SigHashSingle:
+		name = "SINGLE"
+	default:
+		return fmt.Sprintf("sighash(%#x)", byte(t))
+	}
+
+	if t.AnyoneCanPay() {
+		name += "|ANYONECANPAY"
+	}
+	return name
+}
@@ -1,40 +1,62 @@
 package types
 
 import (
+	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"log"
-	"math/big"
 	"strings"
 
-	"github.com/danitello/go-blockchain/common/byteutil"
 	"github.com/danitello/go-blockchain/common/errutil"
+	"github.com/danitello/go-blockchain/common/keys"
 )
 
-// Transaction placed in Blocks
+// Transaction placed in Blocks -
+// Witnesses - the TxWitness of the txin at the same idx, left out of the ID so changing a signature can't change it
 type Transaction struct {
-	ID      []byte
-	Inputs  []TxInput
-	Outputs []TxOutput
+	ID        []byte
+	Inputs    []TxInput
+	Outputs   []TxOutput
+	Witnesses []TxWitness
 }
 
-// initTransaction initializes a new Tranaction
+// initTransaction initializes a new Tranaction, with an empty TxWitness for each txin
 func initTransaction(inputs []TxInput, outputs []TxOutput) *Transaction {
-	tx := Transaction{nil, inputs, outputs}
+	tx := Transaction{nil, inputs, outputs, make([]TxWitness, len(inputs))}
 	tx.ID = tx.Hash()
 	return &tx
 }
 
+// CoinbaseReward is the amount a coinbase tx can pay out
+const CoinbaseReward = 100
+
+// Payment is an amount to be paid to an address by a Transaction
+type Payment struct {
+	Address string
+	Amount  int
+}
+
 // CreateTransaction creates a Transaction that will be added to a Block in the BlockChain -
+// pubKey - of the sender, which the txos being spent are locked to the hash of
+// txoSum - sum of txos being spent
+// utxos - map of txIDs and utxoIdxs
+func CreateTransaction(from, to string, pubKey []byte, amount, txoSum int, utxos map[string][]int) *Transaction {
+	return CreateTransactionWithPayments(from, []Payment{{to, amount}}, pubKey, txoSum, utxos)
+}
+
+// CreateTransactionWithPayments creates a Transaction with a txo for each Payment, plus one for the change -
+// pubKey - of the sender, which the txos being spent are locked to the hash of
 // txoSum - sum of txos being spent
 // utxos - map of txIDs and utxoIdxs
-func CreateTransaction(from, to string, pubKeyHash []byte, amount, txoSum int, utxos map[string][]int) *Transaction {
+func CreateTransactionWithPayments(from string, payments []Payment, pubKey []byte, txoSum int, utxos map[string][]int) *Transaction {
 	var newInputs []TxInput
-	var newOutputs []TxOutput
+
+	amount := 0
+	for _, payment := range payments {
+		amount += payment.Amount
+	}
 
 	if txoSum < amount {
 		pString := fmt.Sprintf("Error: Not enough funds in wallet address: %s", from)
@@ -47,28 +69,55 @@ func CreateTransaction(from, to string, pubKeyHash []byte, amount, txoSum int, u
 		errutil.Handle(err)
 
 		for _, utxoIdx := range utxoIdxs {
-			newInputs = append(newInputs, TxInput{txID, utxoIdx, nil, pubKeyHash}) // map outputs being spent by TxInputs
+			newInputs = append(newInputs, TxInput{txID, utxoIdx, pubKey}) // map outputs being spent by TxInputs
 		}
 	}
 
+	return CreateTransactionWithInputs(newInputs, payments, from, txoSum-amount)
+}
+
+// CreateTransactionWithInputs creates a Transaction spending unsigned txins, with a txo for each Payment plus one for
+// the change if there is any -
+// inputs - each with the pub key of the owner of the txo it spends
+// changeAddress - receives change
+func CreateTransactionWithInputs(inputs []TxInput, payments []Payment, changeAddress string, change int) *Transaction {
+	var newOutputs []TxOutput
+
 	// New outputs for this Transaction
-	newOutputs = append(newOutputs, *InitTxOutput(amount, to))
-	if txoSum > amount {
-		newOutputs = append(newOutputs, *InitTxOutput(txoSum-amount, from)) // Keep left over
+	for _, payment := range payments {
+		newOutputs = append(newOutputs, *InitTxOutput(payment.Amount, payment.Address))
+	}
+	if change > 0 {
+		newOutputs = append(newOutputs, *InitTxOutput(change, changeAddress)) // Keep left over
 	}
 
-	newTx := initTransaction(newInputs, newOutputs)
+	newTx := initTransaction(inputs, newOutputs)
 	return newTx
-
 }
 
 // Sign computes the signature for each txin in the tx with ecdsa -
 // privKey - of signer
 // prevTxs - containing the txos that will be referenced by new txins
 func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTxs map[string]Transaction) {
+	privKeys := make([]ecdsa.PrivateKey, len(tx.Inputs))
+	for i := range privKeys {
+		privKeys[i] = privKey
+	}
+
+	tx.SignInputs(privKeys, prevTxs)
+}
+
+// SignInputs computes the signature for each txin in the tx with ecdsa, for txins spending the txos of different
+// owners -
+// privKeys - of the signer of the txin at the same idx
+// prevTxs - containing the txos that will be referenced by new txins
+func (tx *Transaction) SignInputs(privKeys []ecdsa.PrivateKey, prevTxs map[string]Transaction) {
 	if tx.IsCoinbase() {
 		return
 	}
+	if len(privKeys) != len(tx.Inputs) {
+		log.Panic("ERROR: tx.SignInputs needs a priv key for every txin")
+	}
 
 	for _, txin := range tx.Inputs {
 		if prevTxs[hex.EncodeToString(txin.TxID)].ID == nil {
@@ -76,22 +125,36 @@ func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTxs map[string]Transac
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
-
-	for txinID, txin := range txCopy.Inputs {
-		prevTx := prevTxs[hex.EncodeToString(txin.TxID)]
-		txCopy.Inputs[txinID].Signature = nil
-		txCopy.Inputs[txinID].PubKey = prevTx.Outputs[txin.OutputIdx].PubKeyHash
-		txCopy.ID = txCopy.Hash()
+	prevOutputs := getPrevOutputs(tx, prevTxs)
+	for txinID := range tx.Inputs {
+		tx.SignInput(txinID, privKeys[txinID], prevOutputs)
+	}
+}
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
-		errutil.Handle(err)
-		signature := append(r.Bytes(), s.Bytes()...)
+// SignInput computes the deterministic signature of one txin, with Schnorr if its pub key is a Schnorr pub key and
+// ecdsa otherwise -
+// prevOutputs - the txo spent by the txin at the same idx, for each txin
+func (tx *Transaction) SignInput(txinID int, privKey ecdsa.PrivateKey, prevOutputs []TxOutput) {
+	err := tx.SignInputWithHashType(txinID, SigHashDefault, privKey, prevOutputs)
+	errutil.Handle(err)
+}
 
-		tx.Inputs[txinID].Signature = signature // now update the actual tx
-		txCopy.Inputs[txinID].PubKey = nil
+// SignInputWithHashType computes the deterministic signature of one txin covering what a SigHashType selects -
+// prevOutputs - the txo spent by the txin at the same idx, for each txin
+func (tx *Transaction) SignInputWithHashType(txinID int, hashType SigHashType, privKey ecdsa.PrivateKey, prevOutputs []TxOutput) error {
+	witness := TxWitness{HashType: hashType}
+	hash, err := tx.signatureHash(txinID, witness.HashType, prevOutputs)
+	if err != nil {
+		return err
+	}
 
+	witness.Signature, err = keys.SignFor(tx.Inputs[txinID].PubKey, privKey, hash)
+	if err != nil {
+		return err
 	}
+
+	tx.Witnesses[txinID] = witness
+	return nil
 }
 
 // Verify determines whether txins were signed correctly
@@ -106,74 +169,172 @@ func (tx *Transaction) Verify(prevTxs map[string]Transaction) bool {
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
+	prevOutputs := getPrevOutputs(tx, prevTxs)
+	for txinID := range tx.Inputs {
+		if !tx.VerifyInput(txinID, prevOutputs) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// VerifyBatch determines whether the txins with ecdsa signatures were signed correctly, and adds the Schnorr
+// signatures to a batch to be verified with those of other Transactions -
+// prevOutputs - the txo spent by the txin at the same idx, for each txin
+func (tx *Transaction) VerifyBatch(prevOutputs []TxOutput, batch *keys.SchnorrBatch) bool {
+	if tx.IsCoinbase() {
+		return true
+	}
+	if len(prevOutputs) != len(tx.Inputs) {
+		return false
+	}
 
 	for txinID, txin := range tx.Inputs {
-		// Get same information as signing flow
-		prevTx := prevTxs[hex.EncodeToString(txin.TxID)]
-		txCopy.Inputs[txinID].Signature = nil
-		txCopy.Inputs[txinID].PubKey = prevTx.Outputs[txin.OutputIdx].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-
-		// Signature information
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(txin.Signature)
-		r.SetBytes(txin.Signature[:(sigLen / 2)])
-		s.SetBytes(txin.Signature[(sigLen / 2):])
-
-		// PubKey information
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(txin.PubKey)
-		x.SetBytes(txin.PubKey[:(keyLen / 2)])
-		y.SetBytes(txin.PubKey[(keyLen / 2):])
-
-		rawPubKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y} // reconstruct
-		if ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) == false {
+		if !txin.IsSchnorr() {
+			if !tx.VerifyInput(txinID, prevOutputs) {
+				return false
+			}
+			continue
+		}
+
+		hash, err := tx.SignatureHash(txinID, prevOutputs)
+		if err != nil {
+			return false
+		}
+		if err := batch.Add(txin.PubKey, hash, tx.Witnesses[txinID].Signature); err != nil {
 			return false
 		}
-		txCopy.Inputs[txinID].PubKey = nil
 	}
 
 	return true
 }
 
-// TrimmedCopy sets the Signature and PubKey fields of all txins to nil as these are unecessary for signing (btc spec)
-func (tx *Transaction) TrimmedCopy() Transaction {
-	var inputs []TxInput
-	var outputs []TxOutput
+// VerifyInput determines whether one txin was signed correctly -
+// prevOutputs - the txo spent by the txin at the same idx, for each txin
+func (tx *Transaction) VerifyInput(txinID int, prevOutputs []TxOutput) bool {
+	hash, err := tx.SignatureHash(txinID, prevOutputs)
+	if err != nil {
+		return false
+	}
 
-	for _, txin := range tx.Inputs {
-		inputs = append(inputs, TxInput{txin.TxID, txin.OutputIdx, nil, nil})
+	return keys.Verify(tx.Inputs[txinID].PubKey, hash, tx.Witnesses[txinID].Signature)
+}
+
+// SignatureHash computes what the signature of a txin signs, as selected by the HashType of its TxWitness -
+// prevOutputs - the txo spent by the txin at the same idx, for each txin
+func (tx *Transaction) SignatureHash(txinID int, prevOutputs []TxOutput) ([]byte, error) {
+	return tx.signatureHash(txinID, tx.witness(txinID).HashType, prevOutputs)
+}
+
+// signatureHash computes what the signature of a txin signs with a SigHashType - the hash of the SigHashType, the
+// outpoints of the txins (only the txin's with SigHashAnyoneCanPay), the txos (none with SigHashNone, only the one at
+// the idx of the txin with SigHashSingle), and the outpoint, pub key and spent txo of the txin. It covers none of the
+// TxWitnesses, so no signature depends on another, and the amount being spent, so a signer away from the chain knows
+// what it signs
+func (tx *Transaction) signatureHash(txinID int, hashType SigHashType, prevOutputs []TxOutput) ([]byte, error) {
+	if !hashType.Valid() {
+		return nil, fmt.Errorf("Invalid signature hash type %#x", byte(hashType))
+	}
+
+	var buf bytes.Buffer
+	e := encoder{w: &buf}
+	e.writeUint32(uint32(hashType))
+
+	inputs := tx.Inputs
+	if hashType.AnyoneCanPay() {
+		inputs = nil
+	}
+	e.writeUint32(uint32(len(inputs)))
+	for _, txin := range inputs {
+		e.writeBytes(txin.TxID)
+		e.writeInt(txin.OutputIdx)
 	}
 
-	for _, txo := range tx.Outputs {
-		outputs = append(outputs, TxOutput{txo.Amount, txo.PubKeyHash})
+	var outputs []TxOutput
+	switch hashType.base() {
+	case SigHashAll:
+		outputs = tx.Outputs
+	case SigHashSingle:
+		if txinID >= len(tx.Outputs) {
+			return nil, ErrSigHashSingle
+		}
+		outputs = tx.Outputs[txinID : txinID+1]
+	}
+	e.writeUint32(uint32(len(outputs)))
+	for _, txo := range outputs {
+		e.writeInt(txo.Amount)
+		e.writeBytes(txo.PubKeyHash)
 	}
 
-	txCopy := Transaction{tx.ID, inputs, outputs}
+	txin := tx.Inputs[txinID]
+	e.writeBytes(txin.TxID)
+	e.writeInt(txin.OutputIdx)
+	e.writeBytes(txin.PubKey)
+	e.writeInt(prevOutputs[txinID].Amount)
+	e.writeBytes(prevOutputs[txinID].PubKeyHash)
 
-	return txCopy
+	hash := sha256.Sum256(buf.Bytes())
+	return hash[:], e.err
 }
 
-// Hash computes the hash of the Transaction
-func (tx *Transaction) Hash() []byte {
-	var hash [32]byte
+// getPrevOutputs gets the txo spent by each txin from the Transactions containing them
+func getPrevOutputs(tx *Transaction, prevTxs map[string]Transaction) []TxOutput {
+	prevOutputs := make([]TxOutput, len(tx.Inputs))
+	for txinID, txin := range tx.Inputs {
+		prevOutputs[txinID] = prevTxs[hex.EncodeToString(txin.TxID)].Outputs[txin.OutputIdx]
+	}
 
+	return prevOutputs
+}
+
+// Hash computes the hash of the Transaction that is its ID, leaving out the ID and TxWitnesses
+func (tx *Transaction) Hash() []byte {
 	txCopy := *tx
-	txCopy.ID = []byte{}
+	txCopy.ID = nil
+	txCopy.Witnesses = nil
 
-	hash = sha256.Sum256(byteutil.Serialize(txCopy))
+	hash := sha256.Sum256(serializeTransaction(&txCopy))
+	return hash[:]
+}
 
+// WitnessHash computes the hash of the Transaction with its TxWitnesses, which the Block it is in commits to
+func (tx *Transaction) WitnessHash() []byte {
+	txCopy := *tx
+	txCopy.ID = nil
+
+	hash := sha256.Sum256(serializeTransaction(&txCopy))
 	return hash[:]
 }
 
-// CoinbaseTx is the transaction in each Block that rewards the miner
-func CoinbaseTx(to string) *Transaction {
-	amount := 100
-	txin := TxInput{[]byte{}, -1, nil, []byte(fmt.Sprintf("CoinbaseTx: %d coins to %s", amount, to))} // referencing no output
+// ValidateID confirms that the ID of the Transaction is its Hash
+func (tx *Transaction) ValidateID() bool {
+	return bytes.Equal(tx.Hash(), tx.ID)
+}
+
+// ValidateWitnesses confirms that the Transaction has a TxWitness for each txin, and that a coinbase tx's is empty
+func (tx *Transaction) ValidateWitnesses() bool {
+	if len(tx.Witnesses) != len(tx.Inputs) {
+		return false
+	}
+
+	return !tx.IsCoinbase() || tx.Witnesses[0].Signature == nil
+}
+
+// witness gets the TxWitness of a txin, empty if the Transaction has none for it
+func (tx *Transaction) witness(txinID int) TxWitness {
+	if txinID >= len(tx.Witnesses) {
+		return TxWitness{}
+	}
+
+	return tx.Witnesses[txinID]
+}
+
+// CoinbaseTx is the transaction in each Block that rewards the miner -
+// height - of the Block it goes in, which keeps the ID of every coinbase tx unique
+func CoinbaseTx(to string, height int) *Transaction {
+	amount := CoinbaseReward
+	txin := TxInput{[]byte{}, -1, []byte(fmt.Sprintf("CoinbaseTx: %d coins to %s at height %d", amount, to, height))} // referencing no output
 	txout := InitTxOutput(amount, to)
 	newTx := initTransaction([]TxInput{txin}, []TxOutput{*txout})
 	return newTx
@@ -194,7 +355,8 @@ func (tx Transaction) String() string {
 		lines = append(lines, fmt.Sprintf("     Input %d:", i))
 		lines = append(lines, fmt.Sprintf("       TxID:      %x", txin.TxID))
 		lines = append(lines, fmt.Sprintf("       OutputIdx:       %d", txin.OutputIdx))
-		lines = append(lines, fmt.Sprintf("       Signature: %x", txin.Signature))
+		lines = append(lines, fmt.Sprintf("       Signature: %x", tx.witness(i).Signature))
+		lines = append(lines, fmt.Sprintf("       HashType:  %s", tx.witness(i).HashType))
 		lines = append(lines, fmt.Sprintf("       PubKey:    %x", txin.PubKey))
 	}
 	for i, txo := range tx.Outputs {
@@ -3,18 +3,17 @@ package types
 import (
 	"bytes"
 
+	"github.com/danitello/go-blockchain/common/keys"
 	"github.com/danitello/go-blockchain/wallet"
 )
 
 // TxInput spends (references) a previous TxOutput -
 // TxID - ID of Transaction that the TxOutput resides in
 // OutputIdx - idx of the TxOutput in the Transaction
-// Signature - signs the txin as unlocking the txo
-// PubKey - the pub key used
+// PubKey - the pub key used, whose signature is in the TxWitness of the txin
 type TxInput struct {
 	TxID      []byte
 	OutputIdx int
-	Signature []byte
 	PubKey    []byte
 }
 
@@ -24,3 +23,8 @@ func (txin *TxInput) UsesKey(pubKeyHash []byte) bool {
 
 	return bytes.Compare(lockingHash, pubKeyHash) == 0
 }
+
+// IsSchnorr determines whether the txin is signed with a Schnorr signature rather than ecdsa
+func (txin *TxInput) IsSchnorr() bool {
+	return keys.IsSchnorrPubKey(txin.PubKey)
+}
@@ -6,7 +6,6 @@ import (
 
 	"github.com/danitello/go-blockchain/common/errutil"
 	"github.com/danitello/go-blockchain/wallet"
-	"github.com/danitello/go-blockchain/wallet/walletutil"
 )
 
 // TxOutput specifies amount being made available in a block to a wallet
@@ -15,9 +14,10 @@ type TxOutput struct {
 	PubKeyHash []byte
 }
 
-// TxOutputs groups txos (for serialization)
+// TxOutputs groups txos (for serialization), keyed by the idx of each txo in its Transaction - stored as a list before
+// schema version 2, which lost the idx of the txos after a spent one, so the migration to it rebuilds the UTXO set
 type TxOutputs struct {
-	Outputs []TxOutput
+	Outputs map[int]TxOutput
 }
 
 // InitTxOutput creates a new txo and locks it using a given address
@@ -28,11 +28,9 @@ func InitTxOutput(amount int, address string) *TxOutput {
 	return txo
 }
 
-// Lock signs the TxOutput with a given address
+// Lock signs the TxOutput with a given Base58 or Bech32 address
 func (txo *TxOutput) Lock(address []byte) {
-	pubKeyHash := walletutil.Base58Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-wallet.ChecksumLen]
-	txo.PubKeyHash = pubKeyHash
+	txo.PubKeyHash = wallet.GetPubKeyHashFromAddress(string(address))
 }
 
 // IsLockedWithKey determines whether a given pubKeyHash is the one used to lock the txo
@@ -0,0 +1,44 @@
+package types
+
+import (
+	"errors"
+
+	"github.com/danitello/go-blockchain/common/keys"
+)
+
+// ErrSigHashDefaultWritten is returned when decoding a signature followed by SigHashDefault, which is only left out so
+// each TxWitness has one encoding
+var ErrSigHashDefaultWritten = errors.New("Signature hash type SigHashDefault is written out")
+
+// TxWitness proves a TxInput may spend the TxOutput it references, kept apart from the txin so it isn't part of the
+// ID of its Transaction -
+// Signature - signs the signature hash of the txin, a Schnorr signature if the PubKey of the txin is a Schnorr pub key
+// HashType - what part of the Transaction Signature covers
+type TxWitness struct {
+	Signature []byte
+	HashType  SigHashType
+}
+
+// encodeSignature writes the Signature of a TxWitness followed by its HashType, which is left out if it is
+// SigHashDefault
+func (w TxWitness) encodeSignature() []byte {
+	if w.Signature == nil || w.HashType == SigHashDefault {
+		return w.Signature
+	}
+
+	return append(append([]byte{}, w.Signature...), byte(w.HashType))
+}
+
+// decodeWitness reads a TxWitness from a signature written by encodeSignature
+func decodeWitness(signature []byte) (TxWitness, error) {
+	if len(signature) != keys.SignatureLen+1 {
+		return TxWitness{Signature: signature}, nil
+	}
+
+	hashType := SigHashType(signature[keys.SignatureLen])
+	if hashType == SigHashDefault {
+		return TxWitness{}, ErrSigHashDefaultWritten
+	}
+
+	return TxWitness{Signature: signature[:keys.SignatureLen], HashType: hashType}, nil
+}
@@ -0,0 +1,24 @@
+package types
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/danitello/go-blockchain/common/keys"
+)
+
+// TestDecodeWitness checks that every TxWitness has one encoding - SigHashDefault is only ever left out
+func TestDecodeWitness(t *testing.T) {
+	signature := bytes.Repeat([]byte{1}, keys.SignatureLen)
+
+	for _, witness := range []TxWitness{{}, {Signature: signature}, {Signature: signature, HashType: SigHashAll}} {
+		got, err := decodeWitness(witness.encodeSignature())
+		if err != nil || !bytes.Equal(got.Signature, witness.Signature) || got.HashType != witness.HashType {
+			t.Errorf("%x: got %x, %d, %v", witness.encodeSignature(), got.Signature, got.HashType, err)
+		}
+	}
+
+	if _, err := decodeWitness(append(signature, byte(SigHashDefault))); err != ErrSigHashDefaultWritten {
+		t.Errorf("got %v for a signature followed by SigHashDefault, want %v", err, ErrSigHashDefaultWritten)
+	}
+}
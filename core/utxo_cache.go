@@ -0,0 +1,225 @@
+package core
+
+import (
+	"github.com/danitello/go-blockchain/chaindb"
+	"github.com/danitello/go-blockchain/common/byteutil"
+	"github.com/danitello/go-blockchain/common/errutil"
+	"github.com/danitello/go-blockchain/core/types"
+)
+
+const (
+	// utxoCacheEntryOverhead is the approximate memory taken by a UTXOCache entry besides its IDs and hashes
+	utxoCacheEntryOverhead = 96
+	// utxoCacheOutputOverhead is the approximate memory taken by each txo of a UTXOCache entry besides its hash
+	utxoCacheOutputOverhead = 48
+)
+
+// UTXOCache is a write-back cache over the UTXO set of a ChainDB - Blocks are connected to it in memory, and the
+// changes are written along with the UTXOStats and UTXO set marker in one Batch once it outgrows its limit or
+// is flushed, so the set in the db always matches the Block of its marker
+type UTXOCache struct {
+	db       *chaindb.ChainDB
+	entries  map[string]*utxoCacheEntry
+	stats    *chaindb.UTXOStats
+	bestHash []byte
+	size     int
+	limit    int
+}
+
+// utxoCacheEntry is the unspent txos of a Transaction in a UTXOCache -
+// txos - no Outputs once all of them are spent
+// dirty - whether it differs from the db
+type utxoCacheEntry struct {
+	txos  types.TxOutputs
+	dirty bool
+}
+
+// newUTXOCache creates an empty UTXOCache over the UTXO set of a ChainDB, with a memory limit in bytes
+func newUTXOCache(db *chaindb.ChainDB, limit int) *UTXOCache {
+	c := &UTXOCache{db: db, limit: limit}
+	c.Reset()
+
+	return c
+}
+
+// Reset drops every entry without writing it, and rereads the UTXOStats and marker from the db
+func (c *UTXOCache) Reset() {
+	c.entries = make(map[string]*utxoCacheEntry)
+	c.size = 0
+	c.stats = c.db.ReadUTXOStats()
+
+	bestHash, err := c.db.ReadUTXOBestHash()
+	if err != nil && err != chaindb.ErrNotFound {
+		errutil.Handle(err)
+	}
+	c.bestHash = bestHash
+}
+
+// Get gets the unspent txos of the Transaction with a given ID, if it has any
+func (c *UTXOCache) Get(txID []byte) (types.TxOutputs, bool) {
+	entry := c.getEntry(txID)
+	if entry == nil || len(entry.txos.Outputs) == 0 {
+		return types.TxOutputs{}, false
+	}
+
+	return entry.txos, true
+}
+
+// Stats gets the UTXOStats of the UTXO set including the changes not written yet
+func (c *UTXOCache) Stats() *chaindb.UTXOStats {
+	return c.stats
+}
+
+// ConnectBlock applies the spending and creation of txos by a Block to the cache, updating the UTXOStats and making it
+// the most recent Block - returns the txos spent by the Block keyed by outpoint
+func (c *UTXOCache) ConnectBlock(block *types.Block) map[string]types.TxOutput {
+	spent := make(map[string]types.TxOutput)
+
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() == false {
+			for _, txin := range tx.Inputs {
+				updatedTXO := types.TxOutputs{Outputs: make(map[int]types.TxOutput)}
+
+				var TXO types.TxOutputs
+				if entry := c.getEntry(txin.TxID); entry != nil {
+					TXO = entry.txos
+				}
+
+				for txoIdx, txo := range TXO.Outputs {
+					if txoIdx != txin.OutputIdx {
+						updatedTXO.Outputs[txoIdx] = txo
+					} else {
+						spent[outpoint(txin.TxID, txoIdx)] = txo
+						c.stats.RemoveOutput(txin.TxID, txoIdx, txo)
+					}
+				}
+
+				c.setEntry(txin.TxID, updatedTXO) // No more UTXO once updatedTXO is empty
+			}
+		}
+
+		newTXO := types.TxOutputs{Outputs: make(map[int]types.TxOutput)}
+		for txoIdx, txo := range tx.Outputs {
+			newTXO.Outputs[txoIdx] = txo // Just go ahead and add them
+			c.stats.AddOutput(tx.ID, txoIdx, txo)
+		}
+
+		c.setEntry(tx.ID, newTXO)
+	}
+	c.bestHash = block.Hash
+
+	return spent
+}
+
+// Iterate calls fn with the ID and unspent txos of each Transaction in the UTXO set, db entries first - not in key
+// order, as entries changed in the cache come last
+func (c *UTXOCache) Iterate(fn func(txID []byte, txos types.TxOutputs) error) error {
+	stopped := false
+	err := c.db.Store.Iterate(utxoPrefix, func(key, value []byte) error {
+		txID := key[len(utxoPrefix):]
+		if _, ok := c.entries[string(txID)]; ok {
+			return nil
+		}
+
+		err := fn(txID, types.DeserializeTxOutputs(value))
+		stopped = err == chaindb.ErrStopIteration
+		return err
+	})
+	if err != nil || stopped {
+		return err
+	}
+
+	for txID, entry := range c.entries {
+		if len(entry.txos.Outputs) == 0 {
+			continue
+		}
+
+		if err := fn([]byte(txID), entry.txos); err == chaindb.ErrStopIteration {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FlushIfFull flushes the cache if it has outgrown its limit
+func (c *UTXOCache) FlushIfFull() error {
+	if c.size <= c.limit {
+		return nil
+	}
+
+	return c.Flush()
+}
+
+// Flush writes every changed entry along with the UTXOStats and UTXO set marker to the db in one Batch, then empties
+// the cache
+func (c *UTXOCache) Flush() error {
+	if len(c.bestHash) == 0 {
+		return nil // Nothing was ever connected
+	}
+
+	batch := c.db.Store.NewBatch()
+	for txID, entry := range c.entries {
+		if !entry.dirty {
+			continue
+		}
+
+		if len(entry.txos.Outputs) == 0 {
+			batch.Delete(utxoKey([]byte(txID)))
+		} else {
+			batch.Put(utxoKey([]byte(txID)), byteutil.Serialize(entry.txos))
+		}
+	}
+	c.db.PutUTXOStats(batch, c.stats)
+	c.db.PutUTXOBestHash(batch, c.bestHash)
+
+	if err := batch.Write(); err != nil {
+		return err
+	}
+
+	c.entries = make(map[string]*utxoCacheEntry)
+	c.size = 0
+	return nil
+}
+
+// getEntry gets the entry of the Transaction with a given ID, reading it into the cache if needed - nil if the
+// Transaction has no unspent txos in the db
+func (c *UTXOCache) getEntry(txID []byte) *utxoCacheEntry {
+	if entry, ok := c.entries[string(txID)]; ok {
+		return entry
+	}
+
+	v, err := c.db.Store.Get(utxoKey(txID))
+	if err == chaindb.ErrNotFound {
+		return nil
+	}
+	errutil.Handle(err)
+
+	entry := &utxoCacheEntry{txos: types.DeserializeTxOutputs(v)}
+	c.entries[string(txID)] = entry
+	c.size += entrySize(txID, entry.txos)
+
+	return entry
+}
+
+// setEntry replaces the unspent txos of the Transaction with a given ID
+func (c *UTXOCache) setEntry(txID []byte, txos types.TxOutputs) {
+	if entry, ok := c.entries[string(txID)]; ok {
+		c.size -= entrySize(txID, entry.txos)
+	}
+
+	c.entries[string(txID)] = &utxoCacheEntry{txos: txos, dirty: true}
+	c.size += entrySize(txID, txos)
+}
+
+// entrySize estimates the memory taken by a cache entry
+func entrySize(txID []byte, txos types.TxOutputs) int {
+	size := len(txID) + utxoCacheEntryOverhead
+	for _, txo := range txos.Outputs {
+		size += len(txo.PubKeyHash) + utxoCacheOutputOverhead
+	}
+
+	return size
+}
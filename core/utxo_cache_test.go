@@ -0,0 +1,79 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/danitello/go-blockchain/chaindb"
+)
+
+// expectBestHash fails the test unless the UTXO set marker in the db of a BlockChain is a given hash
+func expectBestHash(t *testing.T, bc *BlockChain, hash []byte) {
+	t.Helper()
+
+	bestHash, err := bc.ChainDB.ReadUTXOBestHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bestHash, hash) {
+		t.Fatalf("got UTXO set marker %x, want %x", bestHash, hash)
+	}
+}
+
+// TestUTXOCacheFlush checks that connected Blocks stay in the UTXOCache until it is flushed, and that a BlockChain
+// opened before then catches up
+func TestUTXOCacheFlush(t *testing.T) {
+	cfg := newTestConfig(t, 16)
+	bc := newTestChain(t, cfg)
+	if _, err := bc.ChainDB.ReadUTXOBestHash(); err != chaindb.ErrNotFound {
+		t.Fatalf("got %v reading the UTXO set marker before a flush, want %v", err, chaindb.ErrNotFound)
+	}
+	if err := bc.UTXOCache.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	genesis := bc.LastHash
+	expectBestHash(t, bc, genesis)
+
+	tx := pay(t, bc, 30)
+	if err := bc.AcceptBlock(nextBlock(t, bc, tx)); err != nil {
+		t.Fatal(err)
+	}
+	block := nextBlock(t, bc)
+	if err := bc.AcceptBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache sees the Blocks the db doesn't have yet
+	coinbaseID := block.Transactions[0].ID
+	if _, ok := bc.UTXOCache.Get(coinbaseID); !ok {
+		t.Fatal("coinbase tx of the last block is not in the cache")
+	}
+	if _, err := bc.ChainDB.Store.Get(utxoKey(coinbaseID)); err != chaindb.ErrNotFound {
+		t.Fatalf("got %v reading an entry not flushed yet, want %v", err, chaindb.ErrNotFound)
+	}
+	if _, err := bc.ChainDB.Store.Get(utxoKey(tx.Inputs[0].TxID)); err != nil {
+		t.Fatalf("spent entry is gone from the db before a flush: %v", err)
+	}
+	if stats := bc.UTXOCache.Stats(); stats.Outputs != 4 || stats.Supply != 300 {
+		t.Fatalf("got %d outputs and supply %d in the cache, want 4 and 300", stats.Outputs, stats.Supply)
+	}
+	expectBestHash(t, bc, genesis)
+
+	// Opened again, the BlockChain catches up from the marker, leaving the cache of the first one to be dropped
+	reopened := GetBlockChainWithDB(cfg, bc.ChainDB)
+	expectBestHash(t, reopened, bc.LastHash)
+	if _, err := reopened.ChainDB.Store.Get(utxoKey(coinbaseID)); err != nil {
+		t.Fatalf("caught up UTXO set is missing the coinbase tx of the last block: %v", err)
+	}
+	if _, err := reopened.ChainDB.Store.Get(utxoKey(tx.Inputs[0].TxID)); err != chaindb.ErrNotFound {
+		t.Fatalf("got %v reading a spent entry after catching up, want %v", err, chaindb.ErrNotFound)
+	}
+	expectUTXOSet(t, reopened)
+
+	// Flushing writes the same set
+	if err := bc.UTXOCache.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expectBestHash(t, bc, bc.LastHash)
+	expectUTXOSet(t, bc)
+}
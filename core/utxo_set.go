@@ -3,129 +3,88 @@ package core
 import (
 	"bytes"
 	"encoding/hex"
+	"fmt"
 
+	"github.com/danitello/go-blockchain/chaindb"
 	"github.com/danitello/go-blockchain/common/byteutil"
 	"github.com/danitello/go-blockchain/common/errutil"
+	"github.com/danitello/go-blockchain/core/coinselect"
 	"github.com/danitello/go-blockchain/core/types"
-
-	"github.com/dgraph-io/badger"
 )
 
 var (
-	utxoPrefix = []byte("utxo-")
+	utxoPrefix = chaindb.UTXOPrefix
 )
 
 // utxo_set is additional database functions for BlockChain involving the running collection of current utxos
 
-// Reindex deletes the current UTXOSet and establishes a new one
-func (bc *BlockChain) Reindex() {
-	bc.DeleteWithKeyPrefix(utxoPrefix)
+// Reindex replaces the current UTXOSet with one established from the Blocks in the chain, in one atomic write
+func (bc *BlockChain) Reindex() error {
+	if bc.ChainDB.IsPruned() {
+		return ErrChainPruned
+	}
 
-	err := bc.ChainDB.Database.Update(func(txn *badger.Txn) error {
-		for txID, txos := range bc.GetUTXO() {
-			key, err := hex.DecodeString(txID)
-			if err != nil {
-				return err
-			}
-			key = append(utxoPrefix, key...)
+	UTXO, err := bc.GetUTXO()
+	if err != nil {
+		return err
+	}
 
-			err = txn.Set(key, byteutil.Serialize(txos))
-			errutil.Handle(err)
+	batch := bc.ChainDB.Store.NewBatch()
+	bc.ChainDB.PutDeleteWithKeyPrefix(batch, utxoPrefix)
+	stats := chaindb.NewUTXOStats()
+
+	for txID, txos := range UTXO {
+		key, err := hex.DecodeString(txID)
+		errutil.Handle(err)
+
+		batch.Put(utxoKey(key), byteutil.Serialize(txos))
+		for txoIdx, txo := range txos.Outputs {
+			stats.AddOutput(key, txoIdx, txo)
 		}
+	}
+	bc.ChainDB.PutUTXOStats(batch, stats)
+	bc.ChainDB.PutUTXOBestHash(batch, bc.LastHash)
 
-		return nil
-	})
-	errutil.Handle(err)
+	// Changes in the cache are made obsolete by the write
+	err = batch.Write()
+	bc.UTXOCache.Reset()
+
+	return err
 }
 
-// DeleteWithKeyPrefix deletes all data whose key is prefixed by a given value
-func (bc *BlockChain) DeleteWithKeyPrefix(prefix []byte) {
-	deleteKeys := func(keysToDelete [][]byte) error {
-		if err := bc.ChainDB.Database.Update(func(txn *badger.Txn) error {
-			for _, key := range keysToDelete {
-				if err := txn.Delete(key); err != nil {
-					return err
-				}
-			}
-			return nil
-		}); err != nil {
-			return err
-		}
-		return nil
+// CheckUTXOSet makes sure the UTXO set reflects every Block up to the last one, as the changes of the most recent
+// Blocks may not have been flushed from the UTXOCache - a set that is behind on the active chain catches up Block by
+// Block, anything else is rebuilt
+func (bc *BlockChain) CheckUTXOSet() {
+	bestHash, err := bc.ChainDB.ReadUTXOBestHash()
+	if err == nil && bytes.Equal(bestHash, bc.LastHash) {
+		return
 	}
 
-	collectSize := 100000 // badgerdb
-	bc.ChainDB.Database.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchValues = false
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		keysToDelete := make([][]byte, 0, collectSize)
-		numKeysCollected := 0
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			key := it.Item().KeyCopy(nil)
-			keysToDelete = append(keysToDelete, key)
-			numKeysCollected++
-			if numKeysCollected == collectSize {
-				err := deleteKeys(keysToDelete)
+	if err == nil {
+		if bestHeight, ok := bc.activeHeight(bestHash); ok {
+			fmt.Printf("UTXO set is %d blocks behind the chain, catching up\n", bc.Height-1-bestHeight)
+
+			iter := bc.ForwardIterator(bestHeight + 1)
+			for iter.HasNext() {
+				block, err := iter.Next()
 				errutil.Handle(err)
-				keysToDelete = make([][]byte, 0, collectSize)
-				numKeysCollected = 0
-			}
-		}
-		if numKeysCollected > 0 {
-			err := deleteKeys(keysToDelete)
-			errutil.Handle(err)
-		}
-		return nil
-	})
-}
 
-// UpdateUTXOSet manages adding and deleting tx references in set resulting from new Block
-func (bc *BlockChain) UpdateUTXOSet(block *types.Block) {
-	err := bc.ChainDB.Database.Update(func(txn *badger.Txn) error {
-		for _, tx := range block.Transactions {
-			if tx.IsCoinbase() == false {
-				for _, txin := range tx.Inputs {
-					updatedTXO := types.TxOutputs{}
-					dbID := append(utxoPrefix, txin.TxID...)
-					item, err := txn.Get(dbID)
-					errutil.Handle(err)
-					v, err := item.Value()
-					errutil.Handle(err)
-
-					TXO := types.DeserializeTxOutputs(v)
-
-					for txoIdx, txo := range TXO.Outputs {
-						if txoIdx != txin.OutputIdx {
-							updatedTXO.Outputs = append(updatedTXO.Outputs, txo)
-						}
-					}
-
-					if len(updatedTXO.Outputs) == 0 {
-						err := txn.Delete(dbID) // No more UTXO
-						errutil.Handle(err)
-					} else {
-						err := txn.Set(dbID, byteutil.Serialize(updatedTXO))
-						errutil.Handle(err)
-					}
-				}
-			}
-			newTXO := types.TxOutputs{}
-			for _, txo := range tx.Outputs {
-				newTXO.Outputs = append(newTXO.Outputs, txo) // Just go ahead and add them
+				bc.UTXOCache.ConnectBlock(block)
+				err = bc.UTXOCache.FlushIfFull()
+				errutil.Handle(err)
 			}
-
-			dbID := append(utxoPrefix, tx.ID...)
-			err := txn.Set(dbID, byteutil.Serialize(newTXO))
+			err = bc.UTXOCache.Flush()
 			errutil.Handle(err)
+			return
 		}
+	} else if err != chaindb.ErrNotFound {
+		errutil.Handle(err)
+	}
 
-		return nil
-	})
+	fmt.Println("UTXO set does not match the chain, rebuilding")
+	err = bc.Reindex()
 	errutil.Handle(err)
-	bc.Reindex()
 }
 
 // GetUTXOWithPubKey gets utxos owned by a pub key hash with a total balance up to a given amount
@@ -133,53 +92,85 @@ func (bc *BlockChain) GetUTXOWithPubKey(pubKeyHash []byte, max int) (map[string]
 	UTXO := make(map[string][]int)
 	balance := 0
 
-	err := bc.ChainDB.Database.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
+	err := bc.UTXOCache.Iterate(func(k []byte, TXO types.TxOutputs) error {
+		txID := hex.EncodeToString(k)
 
-		it := txn.NewIterator(opts)
-		defer it.Close()
+		for txoIdx, txo := range TXO.Outputs {
+			if txo.IsLockedWithKey(pubKeyHash) && balance < max {
+				balance += txo.Amount
+				UTXO[txID] = append(UTXO[txID], txoIdx)
+			}
+		}
 
-		for it.Seek(utxoPrefix); it.ValidForPrefix(utxoPrefix); it.Next() {
-			item := it.Item()
-			k := item.Key()
-			v, err := item.Value()
-			errutil.Handle(err)
+		if balance >= max {
+			return chaindb.ErrStopIteration
+		}
+		return nil
+	})
+	errutil.Handle(err)
+
+	return UTXO, balance
+}
 
-			k = bytes.TrimPrefix(k, utxoPrefix)
-			txID := hex.EncodeToString(k)
-			TXO := types.DeserializeTxOutputs(v)
+// GetCoinsWithPubKey gets every utxo owned by a pub key hash
+func (bc *BlockChain) GetCoinsWithPubKey(pubKeyHash []byte) []coinselect.Coin {
+	return bc.GetCoinsWithPubKeys([][]byte{pubKeyHash})[string(pubKeyHash)]
+}
+
+// GetCoinsWithPubKeys gets every utxo owned by any of the pub key hashes, keyed by the (string) pub key hash owning it
+func (bc *BlockChain) GetCoinsWithPubKeys(pubKeyHashes [][]byte) map[string][]coinselect.Coin {
+	coins := make(map[string][]coinselect.Coin)
+	owned := make(map[string]bool)
+	for _, pubKeyHash := range pubKeyHashes {
+		owned[string(pubKeyHash)] = true
+	}
 
-			for txoIdx, txo := range TXO.Outputs {
-				if txo.IsLockedWithKey(pubKeyHash) && balance < max {
-					balance += txo.Amount
-					UTXO[txID] = append(UTXO[txID], txoIdx)
-				}
+	err := bc.UTXOCache.Iterate(func(txID []byte, TXO types.TxOutputs) error {
+		for txoIdx, txo := range TXO.Outputs {
+			if owned[string(txo.PubKeyHash)] {
+				coin := coinselect.Coin{TxID: append([]byte{}, txID...), Idx: txoIdx, Amount: txo.Amount}
+				coins[string(txo.PubKeyHash)] = append(coins[string(txo.PubKeyHash)], coin)
 			}
 		}
 		return nil
 	})
 	errutil.Handle(err)
 
-	return UTXO, balance
+	return coins
 }
 
 // CountUTX gets the number of Transactions with UTXO in them
 func (bc BlockChain) CountUTX() int {
 	count := 0
 
-	err := bc.ChainDB.Database.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-
-		it := txn.NewIterator(opts)
-		defer it.Close()
-		for it.Seek(utxoPrefix); it.ValidForPrefix(utxoPrefix); it.Next() {
-			count++
-		}
-
+	err := bc.UTXOCache.Iterate(func(_ []byte, _ types.TxOutputs) error {
+		count++
 		return nil
 	})
-
 	errutil.Handle(err)
 
 	return count
 }
+
+// activeHeight gets the height of the Block with a given hash if it is part of the active chain
+func (bc *BlockChain) activeHeight(hash []byte) (int, bool) {
+	header, err := bc.ChainDB.ReadHeaderWithHash(hash)
+	if err != nil {
+		return 0, false
+	}
+
+	height := header.Index
+	activeHash, err := bc.ChainDB.ReadHashWithHeight(height)
+
+	return height, err == nil && bytes.Equal(activeHash, hash) && height < bc.Height
+}
+
+// utxoKey creates the db key of the UTXO set entry of a Transaction
+func utxoKey(txID []byte) []byte {
+	return append(append([]byte{}, utxoPrefix...), txID...)
+}
+
+// outpoint creates the identifier of a txo from the ID of its Transaction and its idx
+func outpoint(txID []byte, txoIdx int) string {
+	return fmt.Sprintf("%x:%d", txID, txoIdx)
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/danitello/go-blockchain/chaindb"
+	"github.com/danitello/go-blockchain/common/byteutil"
+	"github.com/danitello/go-blockchain/core/types"
+)
+
+// newTestChainWithBlocks makes a BlockChain with a spend in its second Block and an empty third one, its UTXO set
+// written to the db - its UTXO set is the snapshot pinned in config.RegTestParams
+func newTestChainWithBlocks(t *testing.T) *BlockChain {
+	t.Helper()
+
+	bc := newTestChain(t, newTestConfig(t, 0))
+	if err := bc.AcceptBlock(nextBlock(t, bc, pay(t, bc, 30))); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AcceptBlock(nextBlock(t, bc)); err != nil {
+		t.Fatal(err)
+	}
+
+	return bc
+}
+
+// TestCheckUTXOSet opens a BlockChain whose UTXO set marker isn't a Block of the active chain, which rebuilds the set
+func TestCheckUTXOSet(t *testing.T) {
+	stray := bytes.Repeat([]byte{2}, 32)
+
+	for _, test := range []struct {
+		name     string
+		bestHash []byte
+	}{
+		{"unknown marker", bytes.Repeat([]byte{1}, 32)},
+		{"no marker", nil},
+	} {
+		bc := newTestChainWithBlocks(t)
+
+		batch := bc.ChainDB.Store.NewBatch()
+		if test.bestHash == nil {
+			batch.Delete([]byte(chaindb.UTXOBestKey))
+		} else {
+			bc.ChainDB.PutUTXOBestHash(batch, test.bestHash)
+		}
+		// An entry the Blocks don't make has to be gone after the rebuild
+		batch.Put(utxoKey(stray), byteutil.Serialize(types.TxOutputs{Outputs: map[int]types.TxOutput{0: {Amount: 1}}}))
+		if err := batch.Write(); err != nil {
+			t.Fatal(err)
+		}
+
+		reopened := GetBlockChainWithDB(bc.Config, bc.ChainDB)
+		expectBestHash(t, reopened, bc.LastHash)
+		if _, err := reopened.ChainDB.Store.Get(utxoKey(stray)); err != chaindb.ErrNotFound {
+			t.Errorf("%s: got %v reading an entry the blocks don't make, want %v", test.name, err, chaindb.ErrNotFound)
+		}
+		expectUTXOSet(t, reopened)
+	}
+}
+
+// TestReindex restores an entry deleted from the UTXO set, and fails on a pruned chain
+func TestReindex(t *testing.T) {
+	bc := newTestChainWithBlocks(t)
+	stats := bc.ChainDB.ReadUTXOStats()
+
+	last, err := bc.GetBlockByHeight(bc.Height - 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbaseID := last.Transactions[0].ID
+	batch := bc.ChainDB.Store.NewBatch()
+	batch.Delete(utxoKey(coinbaseID))
+	if err := batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+	bc.UTXOCache.Reset()
+	if _, ok := bc.UTXOCache.Get(coinbaseID); ok {
+		t.Fatal("deleted entry is still in the UTXO set")
+	}
+
+	if err := bc.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bc.UTXOCache.Get(coinbaseID); !ok {
+		t.Fatal("deleted entry is not restored")
+	}
+	expectUTXOSet(t, bc)
+	if got := bc.ChainDB.ReadUTXOStats(); got.Outputs != stats.Outputs || got.Supply != stats.Supply {
+		t.Fatalf("got %d outputs and supply %d after reindexing, want %d and %d", got.Outputs, got.Supply, stats.Outputs, stats.Supply)
+	}
+
+	bc.ChainDB.PruneBlocks(1)
+	if err := bc.Reindex(); err != ErrChainPruned {
+		t.Fatalf("got %v reindexing a pruned chain, want %v", err, ErrChainPruned)
+	}
+}
@@ -0,0 +1,314 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/danitello/go-blockchain/chaindb"
+	"github.com/danitello/go-blockchain/common/byteutil"
+	"github.com/danitello/go-blockchain/config"
+	"github.com/danitello/go-blockchain/core/types"
+)
+
+// utxo_snapshot is functions for dumping the UTXO set to a file and bootstrapping a BlockChain from one -
+// the file starts with utxoFileMagic, the format version, the network name (uint32 length prefixed), the height
+// (uint32) and hash of the Block the UTXO set is at and the content hash, then the BlockHeaders of every Block from
+// genesis (uint32 count first) and the canonical encoding of every UTXO entry in key order (uint32 count first) -
+// the content hash is the sha256 of the encoded UTXO entries
+
+const utxoFileVersion = 2
+
+var (
+	utxoFileMagic = []byte("GBCU")
+
+	// snapshotBatchSize is the max number of keys written per Batch when loading a UTXO set dump - a var so tests can
+	// make batches small
+	snapshotBatchSize = 100000
+
+	// ErrNotUTXOFile is returned when loading a file that isn't a UTXO set dump
+	ErrNotUTXOFile = errors.New("Not a UTXO set file")
+)
+
+// UTXOSnapshotInfo describes a UTXO set dump -
+// Height, BlockHash - of the Block the UTXO set is at
+// ContentHash - sha256 of the encoded UTXO entries
+// TxCount - number of Transactions with unspent txos
+type UTXOSnapshotInfo struct {
+	Height      int
+	BlockHash   []byte
+	ContentHash []byte
+	TxCount     int
+}
+
+// DumpUTXOSet writes the UTXO set along with the BlockHeaders of the chain to w
+func (bc *BlockChain) DumpUTXOSet(w io.Writer) (*UTXOSnapshotInfo, error) {
+	// The entries are read in key order from the db
+	if err := bc.UTXOCache.Flush(); err != nil {
+		return nil, err
+	}
+
+	info := &UTXOSnapshotInfo{Height: bc.Height - 1, BlockHash: bc.LastHash}
+
+	// The content hash goes before the entries, so they are read twice
+	hash := sha256.New()
+	err := bc.forEachUTXOEntry(func(txID []byte, txos types.TxOutputs) error {
+		info.TxCount++
+		return types.EncodeUTXOEntry(hash, txID, txos)
+	})
+	if err != nil {
+		return nil, err
+	}
+	info.ContentHash = hash.Sum(nil)
+
+	headers, err := bc.getHeaders()
+	if err != nil {
+		return nil, err
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := writeUTXOFileHeader(bw, bc.Config.Params.Name, info); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(bw, binary.BigEndian, uint32(len(headers))); err != nil {
+		return nil, err
+	}
+	for _, header := range headers {
+		if err := types.EncodeBlockHeader(bw, header); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := binary.Write(bw, binary.BigEndian, uint32(info.TxCount)); err != nil {
+		return nil, err
+	}
+	err = bc.forEachUTXOEntry(func(txID []byte, txos types.TxOutputs) error {
+		return types.EncodeUTXOEntry(bw, txID, txos)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return info, bw.Flush()
+}
+
+// LoadUTXOSnapshot creates a BlockChain in the (empty) database of a given Config from a UTXO set dump, which has to
+// match a UTXOSnapshot pinned in the Params of the Config - the data of every Block up to the dump counts as pruned -
+// progress - called after each UTXO entry with the number of entries loaded and in the file
+func LoadUTXOSnapshot(cfg *config.Config, r io.Reader, progress func(done, total int)) (*BlockChain, error) {
+	br := bufio.NewReader(r)
+	network, info, err := readUTXOFileHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if network != cfg.Params.Name {
+		return nil, fmt.Errorf("UTXO set file is for network %q, not %q", network, cfg.Params.Name)
+	}
+
+	pinned, ok := cfg.Params.GetUTXOSnapshot(info.Height)
+	if !ok {
+		return nil, fmt.Errorf("No UTXO snapshot is pinned at height %d for %s", info.Height, cfg.Params.Name)
+	}
+	if pinned.BlockHash != hex.EncodeToString(info.BlockHash) || pinned.ContentHash != hex.EncodeToString(info.ContentHash) {
+		return nil, fmt.Errorf("UTXO set file does not match the snapshot pinned at height %d", info.Height)
+	}
+
+	db := chaindb.InitDB(cfg)
+	if db.HasChain() {
+		db.CloseDB()
+		return nil, fmt.Errorf("BlockChain already exists in %s", cfg.ChainDir())
+	}
+
+	err = loadUTXOFileData(db, br, info, progress)
+	if err != nil {
+		// Nothing is trusted until the last write, but leftover headers and entries would end up in the next chain
+		// made in the database
+		db.DeleteChain()
+		db.CloseDB()
+		return nil, err
+	}
+
+	bc := newBlockChain(cfg, db)
+	bc.Height = info.Height + 1
+	bc.LastHash = info.BlockHash
+
+	return bc, nil
+}
+
+// loadUTXOFileData writes the BlockHeaders and UTXO entries of a UTXO set dump after its header to db, checking them
+// against the header, then makes the dumped Block the last Block
+func loadUTXOFileData(db *chaindb.ChainDB, r io.Reader, info *UTXOSnapshotInfo, progress func(done, total int)) error {
+	batch := db.Store.NewBatch()
+	flush := func() error {
+		if batch.Len() < snapshotBatchSize {
+			return nil
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+		return nil
+	}
+
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return err
+	}
+	if int(count) != info.Height+1 {
+		return fmt.Errorf("UTXO set file has %d headers for height %d", count, info.Height)
+	}
+
+	var prevHash []byte
+	legacy := true
+	for i := 0; i < int(count); i++ {
+		header, err := types.DecodeBlockHeader(r)
+		if err != nil {
+			return fmt.Errorf("Reading header %d: %s", i, err)
+		}
+		if header.Index != i || !bytes.Equal(header.PrevHash, prevHash) {
+			return fmt.Errorf("Header %d does not link to the previous header", i)
+		}
+		if header.Difficulty != types.Difficulty || !header.ValidateProof() {
+			return fmt.Errorf("Header %d: invalid proof of work", i)
+		}
+		// Only Blocks of types.BlockVersion have a WitnessRoot, and no legacy Block comes after one
+		if header.WitnessRoot == nil && !legacy {
+			return fmt.Errorf("Header %d: legacy block after the first block of version %d", i, types.BlockVersion)
+		}
+		legacy = header.WitnessRoot == nil
+
+		db.PutHeader(batch, header)
+		if err := flush(); err != nil {
+			return err
+		}
+		prevHash = header.Hash
+	}
+	if !bytes.Equal(prevHash, info.BlockHash) {
+		return errors.New("UTXO set file headers do not end at its block")
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return err
+	}
+	info.TxCount = int(count)
+
+	hash := sha256.New()
+	entries := io.TeeReader(r, hash)
+	stats := chaindb.NewUTXOStats()
+	for i := 0; i < int(count); i++ {
+		txID, txos, err := types.DecodeUTXOEntry(entries)
+		if err != nil {
+			return fmt.Errorf("Reading UTXO entry %d: %s", i, err)
+		}
+
+		batch.Put(utxoKey(txID), byteutil.Serialize(txos))
+		for txoIdx, txo := range txos.Outputs {
+			stats.AddOutput(txID, txoIdx, txo)
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		progress(i+1, int(count))
+	}
+	if !bytes.Equal(hash.Sum(nil), info.ContentHash) {
+		return errors.New("UTXO set file content does not match its hash")
+	}
+
+	db.PutUTXOStats(batch, stats)
+	db.PutUTXOBestHash(batch, info.BlockHash)
+	db.PutPrunedHeight(batch, info.Height)
+	db.PutLastHash(batch, info.BlockHash)
+
+	return batch.Write()
+}
+
+// forEachUTXOEntry calls fn in key order with the ID and unspent txos of each Transaction in the UTXO set
+func (bc *BlockChain) forEachUTXOEntry(fn func(txID []byte, txos types.TxOutputs) error) error {
+	return bc.ChainDB.Store.Iterate(utxoPrefix, func(key, value []byte) error {
+		return fn(key[len(utxoPrefix):], types.DeserializeTxOutputs(value))
+	})
+}
+
+// getHeaders gets the BlockHeaders of the chain from genesis to the last Block
+func (bc *BlockChain) getHeaders() ([]*types.BlockHeader, error) {
+	headers := make([]*types.BlockHeader, bc.Height)
+	iter := bc.Iterator()
+
+	for i := bc.Height - 1; i >= 0; i-- {
+		header, err := iter.NextHeader()
+		if err != nil {
+			return nil, err
+		}
+		headers[i] = header
+	}
+
+	return headers, nil
+}
+
+// writeUTXOFileHeader writes the header of a UTXO set file
+func writeUTXOFileHeader(w io.Writer, network string, info *UTXOSnapshotInfo) error {
+	if _, err := w.Write(utxoFileMagic); err != nil {
+		return err
+	}
+
+	fields := []interface{}{
+		uint32(utxoFileVersion),
+		uint32(len(network)), []byte(network),
+		uint32(info.Height),
+		uint32(len(info.BlockHash)), info.BlockHash,
+		info.ContentHash}
+	for _, v := range fields {
+		if err := binary.Write(w, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readUTXOFileHeader reads the header of a UTXO set file, returning its network name and UTXOSnapshotInfo
+func readUTXOFileHeader(r io.Reader) (string, *UTXOSnapshotInfo, error) {
+	magic := make([]byte, len(utxoFileMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, utxoFileMagic) {
+		return "", nil, ErrNotUTXOFile
+	}
+
+	var version, nameLen, height, hashLen uint32
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return "", nil, ErrNotUTXOFile
+	}
+	if version != utxoFileVersion {
+		return "", nil, fmt.Errorf("Unsupported UTXO set file version %d", version)
+	}
+	if err := binary.Read(r, binary.BigEndian, &nameLen); err != nil || nameLen > 64 {
+		return "", nil, ErrNotUTXOFile
+	}
+	name := make([]byte, nameLen)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return "", nil, ErrNotUTXOFile
+	}
+	if err := binary.Read(r, binary.BigEndian, &height); err != nil {
+		return "", nil, ErrNotUTXOFile
+	}
+	if err := binary.Read(r, binary.BigEndian, &hashLen); err != nil || hashLen > 64 {
+		return "", nil, ErrNotUTXOFile
+	}
+
+	info := &UTXOSnapshotInfo{
+		Height:      int(height),
+		BlockHash:   make([]byte, hashLen),
+		ContentHash: make([]byte, sha256.Size)}
+	if _, err := io.ReadFull(r, info.BlockHash); err != nil {
+		return "", nil, ErrNotUTXOFile
+	}
+	if _, err := io.ReadFull(r, info.ContentHash); err != nil {
+		return "", nil, ErrNotUTXOFile
+	}
+
+	return string(name), info, nil
+}
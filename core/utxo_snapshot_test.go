@@ -0,0 +1,109 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/danitello/go-blockchain/chaindb"
+	"github.com/danitello/go-blockchain/config"
+)
+
+// dumpTestChain dumps the UTXO set of the BlockChain pinned in config.RegTestParams
+func dumpTestChain(t *testing.T) (*BlockChain, []byte) {
+	t.Helper()
+
+	bc := newTestChainWithBlocks(t)
+	var buf bytes.Buffer
+	if _, err := bc.DumpUTXOSet(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	return bc, buf.Bytes()
+}
+
+// TestLoadUTXOSnapshot loads the pinned regtest dump into a new BlockChain and builds on it
+func TestLoadUTXOSnapshot(t *testing.T) {
+	bc, dump := dumpTestChain(t)
+
+	loaded, err := LoadUTXOSnapshot(newTestConfig(t, 0), bytes.NewReader(dump), func(done, total int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Height != bc.Height || !bytes.Equal(loaded.LastHash, bc.LastHash) {
+		t.Fatalf("got height %d and last hash %x, want %d and %x", loaded.Height, loaded.LastHash, bc.Height, bc.LastHash)
+	}
+	if !loaded.ChainDB.IsPruned() {
+		t.Fatal("loaded chain does not count as pruned")
+	}
+	if got, want := utxoSet(t, loaded), utxoSet(t, bc); len(got) != len(want) {
+		t.Fatalf("got %d UTXO entries, want %d", len(got), len(want))
+	}
+	stats, want := loaded.ChainDB.ReadUTXOStats(), bc.ChainDB.ReadUTXOStats()
+	if !bytes.Equal(stats.Hash.Sum(), want.Hash.Sum()) || stats.Supply != want.Supply {
+		t.Fatalf("got UTXO stats %+v, want %+v", stats, want)
+	}
+
+	// Blocks after the dump spend the outputs it holds
+	tx := pay(t, loaded, 60)
+	if err := loaded.AcceptBlock(nextBlock(t, loaded, tx)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.UTXOCache.Get(tx.ID); !ok {
+		t.Fatal("tx of the block after the dump is not in the UTXO set")
+	}
+}
+
+// TestLoadUTXOSnapshotRejected checks that dumps not matching the pinned snapshot are not loaded, and that a dump
+// failing part way leaves nothing but the schema version behind
+func TestLoadUTXOSnapshotRejected(t *testing.T) {
+	bc, dump := dumpTestChain(t)
+
+	cfg, err := config.InitConfig(t.TempDir(), config.TestNetParams.Name, chaindb.MemoryBackend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadUTXOSnapshot(cfg, bytes.NewReader(dump), func(done, total int) {}); err == nil {
+		t.Error("loaded a dump of another network")
+	}
+
+	// A Block more makes a dump no snapshot is pinned for
+	if err := bc.AcceptBlock(nextBlock(t, bc)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := bc.DumpUTXOSet(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadUTXOSnapshot(newTestConfig(t, 0), &buf, func(done, total int) {}); err == nil {
+		t.Error("loaded a dump at a height without a pinned snapshot")
+	}
+
+	// The header still matches the pin, so the entries are written before the content hash is found wrong
+	defer func(size int) { snapshotBatchSize = size }(snapshotBatchSize)
+	snapshotBatchSize = 1
+	corrupted := append([]byte{}, dump...)
+	corrupted[len(corrupted)-1] ^= 1
+
+	cfg, err = config.InitConfig(t.TempDir(), config.RegTestParams.Name, chaindb.BoltBackend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadUTXOSnapshot(cfg, bytes.NewReader(corrupted), func(done, total int) {}); err == nil {
+		t.Fatal("loaded a dump whose content does not match its hash")
+	}
+
+	store, err := chaindb.OpenStore(chaindb.BoltBackend, cfg.ChainDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	err = store.Iterate(nil, func(key, _ []byte) error {
+		if string(key) != chaindb.SchemaVersionKey {
+			t.Errorf("key %q is left after a failed load", key)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/danitello/go-blockchain/common/keys"
+	"github.com/danitello/go-blockchain/core/types"
+)
+
+// validation is additional functions for BlockChain involving checking Blocks from outside the node
+
+// AcceptBlock validates a Block against the end of the BlockChain, and adds it if it is valid
+func (bc *BlockChain) AcceptBlock(block *types.Block) error {
+	if err := bc.ValidateBlock(block); err != nil {
+		return err
+	}
+
+	bc.saveNewLastBlock(block)
+	return nil
+}
+
+// ValidateBlock checks that a Block can be the next Block of the BlockChain - its proof, its link to the last Block,
+// and that every Transaction in it is valid against the UTXO set. The Schnorr signatures of the Block are verified
+// together once every Transaction is otherwise valid
+func (bc *BlockChain) ValidateBlock(block *types.Block) error {
+	if block.Index != bc.Height {
+		return fmt.Errorf("Block %d: expected index %d", block.Index, bc.Height)
+	}
+	if bc.Height == 0 && len(block.PrevHash) != 0 {
+		return fmt.Errorf("Block %d: genesis block has a previous hash", block.Index)
+	}
+	if bc.Height > 0 && !bytes.Equal(block.PrevHash, bc.LastHash) {
+		return fmt.Errorf("Block %d: previous hash %x is not the last block %x", block.Index, block.PrevHash, bc.LastHash)
+	}
+	// The proof of legacy Blocks can't be computed again, so they are never accepted
+	if block.Version != types.BlockVersion {
+		return fmt.Errorf("Block %d: version %d, expected %d", block.Index, block.Version, types.BlockVersion)
+	}
+	if block.Difficulty != types.Difficulty {
+		return fmt.Errorf("Block %d: difficulty %d, expected %d", block.Index, block.Difficulty, types.Difficulty)
+	}
+	// The proof covers the MerkleTree of the Transactions, which has to have one
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return fmt.Errorf("Block %d: first transaction is not a coinbase tx", block.Index)
+	}
+	if !block.ValidateProof() {
+		return fmt.Errorf("Block %d: invalid proof of work", block.Index)
+	}
+
+	blockTxs := make(map[string]*types.Transaction) // earlier Transactions of the Block, spendable by later ones
+	spent := make(map[string]bool)                  // outpoints spent by earlier Transactions of the Block
+	batch := keys.NewSchnorrBatch()
+
+	for i, tx := range block.Transactions {
+		txID := hex.EncodeToString(tx.ID)
+		if err := bc.validateTransaction(tx, i == 0, blockTxs, spent, batch); err != nil {
+			return fmt.Errorf("Block %d: tx %s: %s", block.Index, txID, err)
+		}
+		blockTxs[txID] = tx
+	}
+
+	if !batch.Verify() {
+		return fmt.Errorf("Block %d: invalid Schnorr signature among %d", block.Index, batch.Len())
+	}
+
+	return nil
+}
+
+// validateTransaction checks a Transaction of a Block being validated -
+// coinbase - whether it is the first Transaction of the Block, which must be the only coinbase tx
+// blockTxs - earlier Transactions of the Block keyed by ID
+// spent - outpoints spent by earlier Transactions of the Block, which this one's are added to
+// batch - Schnorr signatures of the Block, which this one's are added to rather than verified
+func (bc *BlockChain) validateTransaction(tx *types.Transaction, coinbase bool, blockTxs map[string]*types.Transaction, spent map[string]bool, batch *keys.SchnorrBatch) error {
+	if !tx.ValidateID() {
+		return fmt.Errorf("ID does not match its contents")
+	}
+	if !tx.ValidateWitnesses() {
+		return fmt.Errorf("needs one witness for each input, empty for a coinbase tx")
+	}
+	if tx.IsCoinbase() != coinbase {
+		return fmt.Errorf("only the first transaction of a block can be a coinbase tx")
+	}
+	if _, ok := blockTxs[hex.EncodeToString(tx.ID)]; ok {
+		return fmt.Errorf("duplicate of an earlier transaction in the block")
+	}
+	// Reusing the ID of a tx with unspent txos would overwrite them in the UTXO set
+	if _, ok := bc.UTXOCache.Get(tx.ID); ok {
+		return fmt.Errorf("duplicate of a transaction with unspent outputs")
+	}
+	if len(tx.Outputs) == 0 {
+		return fmt.Errorf("no outputs")
+	}
+
+	outSum := 0
+	for _, txo := range tx.Outputs {
+		if txo.Amount <= 0 {
+			return fmt.Errorf("output amount %d is not positive", txo.Amount)
+		}
+		outSum += txo.Amount
+	}
+
+	if coinbase {
+		if outSum > types.CoinbaseReward {
+			return fmt.Errorf("coinbase tx pays out %d, more than the reward of %d", outSum, types.CoinbaseReward)
+		}
+		return nil
+	}
+
+	inSum := 0
+	prevOutputs := make([]types.TxOutput, len(tx.Inputs))
+	for txinID, txin := range tx.Inputs {
+		op := outpoint(txin.TxID, txin.OutputIdx)
+		if spent[op] {
+			return fmt.Errorf("output %s is spent twice in the block", op)
+		}
+
+		txo, err := bc.getUnspentOutput(txin, blockTxs)
+		if err != nil {
+			return err
+		}
+		if !txin.UsesKey(txo.PubKeyHash) {
+			return fmt.Errorf("input spending %s does not use the key the output is locked with", op)
+		}
+
+		spent[op] = true
+		inSum += txo.Amount
+		prevOutputs[txinID] = txo
+	}
+	if outSum > inSum {
+		return fmt.Errorf("outputs of %d are more than the inputs of %d", outSum, inSum)
+	}
+
+	// A signature with another encoding of the same values would change the witness hash of the tx
+	for txinID, txin := range tx.Inputs {
+		if err := keys.CheckSignature(txin.PubKey, tx.Witnesses[txinID].Signature); err != nil {
+			return fmt.Errorf("input %d: %s", txinID, err)
+		}
+		if hashType := tx.Witnesses[txinID].HashType; !hashType.Valid() {
+			return fmt.Errorf("input %d: invalid signature hash type %#x", txinID, byte(hashType))
+		}
+	}
+
+	if !tx.VerifyBatch(prevOutputs, batch) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+// getUnspentOutput gets the txo a txin spends from the UTXO set or the earlier Transactions of its Block
+func (bc *BlockChain) getUnspentOutput(txin types.TxInput, blockTxs map[string]*types.Transaction) (types.TxOutput, error) {
+	op := outpoint(txin.TxID, txin.OutputIdx)
+
+	if prevTx, ok := blockTxs[hex.EncodeToString(txin.TxID)]; ok {
+		if txin.OutputIdx < 0 || txin.OutputIdx >= len(prevTx.Outputs) {
+			return types.TxOutput{}, fmt.Errorf("output %s does not exist", op)
+		}
+		return prevTx.Outputs[txin.OutputIdx], nil
+	}
+
+	txos, _ := bc.UTXOCache.Get(txin.TxID)
+	txo, ok := txos.Outputs[txin.OutputIdx]
+	if !ok {
+		return types.TxOutput{}, fmt.Errorf("output %s is not in the UTXO set", op)
+	}
+
+	return txo, nil
+}
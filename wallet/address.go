@@ -0,0 +1,108 @@
+package wallet
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/danitello/go-blockchain/common/keys"
+	"github.com/danitello/go-blockchain/wallet/walletutil"
+	"github.com/mr-tron/base58"
+)
+
+// address is the encodings of the pub key hash txos are locked with - Base58Check with a version byte and a checksum,
+// and Bech32 under the human-readable prefix of a network, which is case-insensitive and catches mistyped characters.
+// A Bech32 address holds a version before the pub key hash like a segwit program - 0 with a Bech32 checksum for ecdsa
+// pub keys, 1 with a Bech32m checksum for Schnorr ones. Both encodings of a pub key hash pay the same txos
+
+// AddressType is the encoding of the address of a Wallet
+type AddressType byte
+
+const (
+	// Base58Address is the Base58Check address every Wallet had at first
+	Base58Address AddressType = iota
+	// Bech32Address is the Bech32 or Bech32m address under the prefix of a network
+	Bech32Address
+
+	// bech32Version and bech32mVersion are the versions of Bech32 addresses of ecdsa and Schnorr pub keys
+	bech32Version  = 0
+	bech32mVersion = 1
+	// pubKeyHashLen is the length of a pub key hash
+	pubKeyHashLen = 20
+)
+
+// ParseAddressType gets the AddressType of its name
+func ParseAddressType(name string) (AddressType, error) {
+	switch name {
+	case "base58":
+		return Base58Address, nil
+	case "bech32":
+		return Bech32Address, nil
+	}
+
+	return 0, fmt.Errorf("Unknown address type %q, use base58 or bech32", name)
+}
+
+// String gets the name of an AddressType
+func (t AddressType) String() string {
+	if t == Bech32Address {
+		return "bech32"
+	}
+
+	return "base58"
+}
+
+// EncodeBech32Address derives the Bech32 address of a pub key hash under the prefix of a network - Bech32m if the
+// pub key is a Schnorr one
+func EncodeBech32Address(pubKeyHash []byte, hrp string, schnorr bool) string {
+	version := byte(bech32Version)
+	if schnorr {
+		version = bech32mVersion
+	}
+
+	program, _ := walletutil.ConvertBits(pubKeyHash, 8, 5, true)
+	return walletutil.Bech32Encode(hrp, append([]byte{version}, program...), schnorr)
+}
+
+// DecodeAddress reads the pub key hash of a Base58 or Bech32 address - returns the prefix of a Bech32 address too, ""
+// for a Base58 one
+func DecodeAddress(address string) ([]byte, string, error) {
+	if pubKeyHash, err := decodeBase58Address(address); err == nil {
+		return pubKeyHash, "", nil
+	}
+
+	hrp, data, bech32m, err := walletutil.Bech32Decode(address)
+	if err != nil || len(data) == 0 {
+		return nil, "", ErrInvalidAddress
+	}
+	switch version := data[0]; {
+	case version == bech32Version && bech32m, version == bech32mVersion && !bech32m, version > bech32mVersion:
+		return nil, "", ErrInvalidAddress
+	}
+
+	pubKeyHash, err := walletutil.ConvertBits(data[1:], 5, 8, false)
+	if err != nil || len(pubKeyHash) != pubKeyHashLen {
+		return nil, "", ErrInvalidAddress
+	}
+
+	return pubKeyHash, hrp, nil
+}
+
+// decodeBase58Address reads the pub key hash of a Base58 address, checking its version and checksum
+func decodeBase58Address(address string) ([]byte, error) {
+	decoded, err := base58.Decode(address)
+	if err != nil || len(decoded) != 1+pubKeyHashLen+ChecksumLen || decoded[0] != version {
+		return nil, ErrInvalidAddress
+	}
+
+	payload := decoded[:len(decoded)-ChecksumLen]
+	if !bytes.Equal(checksum(payload), decoded[len(payload):]) {
+		return nil, ErrInvalidAddress
+	}
+
+	return payload[1:], nil
+}
+
+// useBech32 gives a Wallet with a pub key its Bech32 address under the prefix of a network, instead of Base58
+func (w *Wallet) useBech32(hrp string) {
+	w.Address = EncodeBech32Address(w.GetPubKeyHash(), hrp, keys.IsSchnorrPubKey(w.PublicKey))
+}
@@ -0,0 +1,121 @@
+package wallet
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// agent is keeping encrypted Wallets unlocked for a while without writing their key anywhere - a process started by
+// wallet-unlock holds the key in memory and hands it to the commands run after it over a unix socket in a directory
+// only the user can enter, until a deadline passes or the Wallets are locked
+
+const (
+	// agentDirSuffix is added to the wallet file name for the directory of the socket of the agent
+	agentDirSuffix = ".agent"
+	// agentSocket is the name of the socket of the agent in its directory
+	agentSocket = "socket"
+	// agentTimeout is how long a connection to the agent may take
+	agentTimeout = time.Second
+
+	// agentGetKey asks the agent for the key of the Wallets
+	agentGetKey = 'k'
+	// agentStop asks the agent to forget the key and exit
+	agentStop = 's'
+)
+
+// ServeUnlocked keeps the unlocked Wallets unlocked for the commands run after it until a timeout passes or they are
+// locked, blocking until then - ready is called once they can connect. An agent already serving them is replaced
+func (ws *Wallets) ServeUnlocked(timeout time.Duration, ready func()) error {
+	if !ws.IsEncrypted() {
+		return ErrNotEncrypted
+	}
+	if ws.IsLocked() {
+		return ErrLocked
+	}
+
+	ws.stopAgent()
+	dir := ws.file + agentDirSuffix
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	// The socket is only reachable through a directory of the user, so nobody else connects before it is ready
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: filepath.Join(dir, agentSocket), Net: "unix"})
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	if err := listener.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	ready()
+
+	for {
+		conn, err := listener.Accept()
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		cmd := make([]byte, 1)
+		conn.SetDeadline(time.Now().Add(agentTimeout))
+		if _, err := io.ReadFull(conn, cmd); err == nil {
+			switch cmd[0] {
+			case agentGetKey:
+				conn.Write(ws.key)
+			case agentStop:
+				// Gone before the caller hears back, so a new agent doesn't race this one's cleanup
+				listener.Close()
+				os.RemoveAll(dir)
+				conn.Close()
+				return nil
+			}
+		}
+		conn.Close()
+	}
+}
+
+// unlockFromAgent unlocks the Wallets with the key held by their agent, if one is running
+func (ws *Wallets) unlockFromAgent() {
+	key, err := ws.callAgent(agentGetKey)
+	if err != nil || len(key) != encryptionKeyLen {
+		return
+	}
+
+	if err := ws.unlockWithKey(key); err != nil {
+		ws.forgetKeys()
+	}
+}
+
+// stopAgent makes the agent of the Wallets forget their key and exit, if one is running
+func (ws *Wallets) stopAgent() {
+	ws.callAgent(agentStop)
+}
+
+// callAgent sends a command to the agent of the Wallets, returning its reply
+func (ws *Wallets) callAgent(cmd byte) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", filepath.Join(ws.file+agentDirSuffix, agentSocket), agentTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(agentTimeout))
+	if _, err := conn.Write([]byte{cmd}); err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(conn)
+}
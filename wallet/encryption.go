@@ -0,0 +1,263 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"github.com/danitello/go-blockchain/common/keys"
+	"github.com/tyler-smith/go-bip39"
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryption is keeping the priv keys and seed of Wallets encrypted at rest - AES-GCM with a key derived from a
+// passphrase by scrypt, while addresses, pub keys and paths stay readable so a locked wallet still shows balances
+
+const (
+	// scrypt cost parameters of newly encrypted Wallets
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	// encryptionKeyLen is the length of the AES-256 key derived from a passphrase
+	encryptionKeyLen = 32
+	// saltLen is the length of the random salt of the key derivation
+	saltLen = 16
+
+	// passphraseCheck is sealed with the key to tell whether a passphrase is right
+	passphraseCheck = "go-blockchain wallet"
+)
+
+var (
+	// ErrLocked is returned when a priv key or the seed of encrypted Wallets is needed while they are locked
+	ErrLocked = errors.New("Wallet is locked, run wallet-unlock first")
+	// ErrNotEncrypted is returned when a passphrase is given for Wallets that are not encrypted
+	ErrNotEncrypted = errors.New("Wallet is not encrypted, run wallet-encrypt first")
+	// ErrEncrypted is returned when encrypting Wallets that are already encrypted
+	ErrEncrypted = errors.New("Wallet is already encrypted")
+	// ErrWrongPassphrase is returned when a passphrase doesn't decrypt the Wallets
+	ErrWrongPassphrase = errors.New("Wrong passphrase")
+)
+
+// Encryption is how the Wallets are encrypted -
+// Salt, N, R, P - parameters of the scrypt derivation of the key from the passphrase
+// Check - passphraseCheck sealed with the key
+type Encryption struct {
+	Salt  []byte
+	N     int
+	R     int
+	P     int
+	Check []byte
+}
+
+// IsEncrypted determines if the Wallets have a passphrase
+func (ws *Wallets) IsEncrypted() bool {
+	return ws.Encryption != nil
+}
+
+// IsLocked determines if the Wallets are encrypted and their priv keys are not decrypted
+func (ws *Wallets) IsLocked() bool {
+	return ws.IsEncrypted() && ws.key == nil
+}
+
+// Encrypt encrypts the priv keys and seed of the Wallets with a passphrase, leaving them unlocked until saved
+func (ws *Wallets) Encrypt(passphrase string) error {
+	if ws.IsEncrypted() {
+		return ErrEncrypted
+	}
+
+	return ws.setPassphrase(passphrase)
+}
+
+// Unlock decrypts the priv keys and seed of the Wallets with their passphrase
+func (ws *Wallets) Unlock(passphrase string) error {
+	if !ws.IsEncrypted() {
+		return ErrNotEncrypted
+	}
+
+	key, err := ws.Encryption.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+
+	return ws.unlockWithKey(key)
+}
+
+// Lock forgets the decrypted priv keys and seed of the Wallets, and stops the agent keeping them unlocked
+func (ws *Wallets) Lock() error {
+	if !ws.IsEncrypted() {
+		return ErrNotEncrypted
+	}
+
+	ws.forgetKeys()
+	ws.stopAgent()
+
+	return nil
+}
+
+// ChangePassphrase encrypts the Wallets with a new passphrase, given the current one
+func (ws *Wallets) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	if err := ws.Unlock(oldPassphrase); err != nil {
+		return err
+	}
+
+	// An agent holds the old key
+	ws.stopAgent()
+
+	return ws.setPassphrase(newPassphrase)
+}
+
+// setPassphrase encrypts the priv keys and seed of the unlocked Wallets with the key of a new passphrase and salt
+func (ws *Wallets) setPassphrase(passphrase string) error {
+	salt := make([]byte, saltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+
+	encryption := &Encryption{Salt: salt, N: scryptN, R: scryptR, P: scryptP}
+	key, err := encryption.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+	encryption.Check, err = seal(key, []byte(passphraseCheck), nil)
+	if err != nil {
+		return err
+	}
+
+	// Secret nonces are opened with the key they were sealed with, if any, before it changes
+	nonceSecrets := make(map[*SecretNonce][]byte)
+	for _, secretNonce := range ws.MuSigNonces {
+		if nonceSecrets[secretNonce], err = ws.openNonce(secretNonce); err != nil {
+			return err
+		}
+	}
+
+	ws.Encryption = encryption
+	ws.key = key
+	for secretNonce, secret := range nonceSecrets {
+		if secretNonce.EncryptedSecret, err = seal(key, secret, secretNonce.PubKey); err != nil {
+			return err
+		}
+		secretNonce.Secret = nil
+	}
+	for _, w := range ws.Wallets {
+		if err := ws.sealWallet(w); err != nil {
+			return err
+		}
+	}
+	if ws.HD != nil {
+		ws.HD.EncryptedMnemonic, err = seal(key, []byte(ws.HD.Mnemonic), nil)
+	}
+
+	return err
+}
+
+// unlockWithKey decrypts the priv keys and seed of the Wallets with the key derived from their passphrase
+func (ws *Wallets) unlockWithKey(key []byte) error {
+	check, err := open(key, ws.Encryption.Check, nil)
+	if err != nil || string(check) != passphraseCheck {
+		return ErrWrongPassphrase
+	}
+
+	for _, w := range ws.Wallets {
+		if w.encryptedKey == nil {
+			continue
+		}
+
+		d, err := open(key, w.encryptedKey, w.PublicKey)
+		if err != nil {
+			return err
+		}
+		w.PrivateKey, err = privateKeyFromBytes(w.PublicKey, d)
+		if err != nil {
+			return err
+		}
+	}
+
+	if ws.HD != nil {
+		mnemonic, err := open(key, ws.HD.EncryptedMnemonic, nil)
+		if err != nil {
+			return err
+		}
+		ws.HD.Mnemonic = string(mnemonic)
+		ws.HD.Seed = bip39.NewSeed(ws.HD.Mnemonic, "")
+	}
+
+	ws.key = key
+	return nil
+}
+
+// forgetKeys forgets the decrypted priv keys and seed of the Wallets and the key they were decrypted with
+func (ws *Wallets) forgetKeys() {
+	ws.key = nil
+	for _, w := range ws.Wallets {
+		if w.encryptedKey != nil {
+			w.PrivateKey = Wallet{}.PrivateKey
+		}
+	}
+	if ws.HD != nil {
+		ws.HD.Mnemonic = ""
+		ws.HD.Seed = nil
+	}
+}
+
+// sealWallet encrypts the priv key of a Wallet with the key of the unlocked Wallets, bound to its pub key
+func (ws *Wallets) sealWallet(w *Wallet) error {
+	if w.PrivateKey.D == nil {
+		return nil
+	}
+
+	encryptedKey, err := seal(ws.key, keys.PrivateKeyBytes(w.PrivateKey), w.PublicKey)
+	w.encryptedKey = encryptedKey
+
+	return err
+}
+
+// deriveKey derives the encryption key of a passphrase
+func (e *Encryption) deriveKey(passphrase string) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), e.Salt, e.N, e.R, e.P, encryptionKeyLen)
+}
+
+// seal encrypts and authenticates plaintext and additional data with AES-GCM, prepending the random nonce
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts what seal encrypted
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+
+	plaintext, err := gcm.Open(nil, ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return plaintext, nil
+}
+
+// newGCM makes the AES-GCM cipher of a key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
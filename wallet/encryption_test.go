@@ -0,0 +1,209 @@
+package wallet
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/danitello/go-blockchain/common/keys"
+)
+
+// newTestWallets makes Wallets backed by a file in a new temp dir, with a seed and one Wallet of it - returns them,
+// the address of the Wallet and the mnemonic of the seed
+func newTestWallets(t *testing.T) (*Wallets, string, string) {
+	t.Helper()
+
+	ws, _ := InitWallets(filepath.Join(t.TempDir(), "wallets.dat")) // the file doesn't exist yet
+	mnemonic, err := ws.InitSeed(keys.Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := ws.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ws, address, mnemonic
+}
+
+// reload reads Wallets back from their file, as the next command does
+func reload(t *testing.T, ws *Wallets) *Wallets {
+	t.Helper()
+
+	loaded, err := InitWallets(ws.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loaded
+}
+
+// TestEncryption encrypts Wallets and checks what is readable while they are locked and after each passphrase
+func TestEncryption(t *testing.T) {
+	ws, address, mnemonic := newTestWallets(t)
+	privKey := keys.PrivateKeyBytes(ws.Wallets[address].PrivateKey)
+	pubKeyHash := ws.Wallets[address].GetPubKeyHash()
+
+	if err := ws.Unlock("passphrase"); err != ErrNotEncrypted {
+		t.Errorf("got %v unlocking unencrypted wallets, want %v", err, ErrNotEncrypted)
+	}
+	if err := ws.Lock(); err != ErrNotEncrypted {
+		t.Errorf("got %v locking unencrypted wallets, want %v", err, ErrNotEncrypted)
+	}
+	if err := ws.Encrypt("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.Encrypt("other"); err != ErrEncrypted {
+		t.Errorf("got %v encrypting twice, want %v", err, ErrEncrypted)
+	}
+	ws.SaveToFile()
+
+	data, err := ioutil.ReadFile(ws.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, privKey) || bytes.Contains(data, []byte(mnemonic)) {
+		t.Fatal("wallet file holds the priv key or mnemonic in plaintext")
+	}
+
+	// Locked, the Wallets still show their addresses but can't sign or derive
+	ws = reload(t, ws)
+	if !ws.IsLocked() || ws.HD.Mnemonic != "" || ws.HD.Seed != nil {
+		t.Fatal("loaded wallets are not locked")
+	}
+	if _, ok := ws.Wallets[address]; !ok {
+		t.Fatal("address of locked wallets is missing")
+	}
+	if _, ok := ws.GetKey(pubKeyHash); ok {
+		t.Fatal("got the priv key of locked wallets")
+	}
+	if _, err := ws.CreateWallet(); err != ErrLocked {
+		t.Errorf("got %v creating a wallet while locked, want %v", err, ErrLocked)
+	}
+
+	if err := ws.Unlock("wrong"); err != ErrWrongPassphrase {
+		t.Errorf("got %v unlocking with a wrong passphrase, want %v", err, ErrWrongPassphrase)
+	}
+	if !ws.IsLocked() {
+		t.Fatal("wallets are unlocked by a wrong passphrase")
+	}
+	if err := ws.Unlock("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := ws.GetKey(pubKeyHash); !ok || !bytes.Equal(keys.PrivateKeyBytes(key), privKey) {
+		t.Fatal("unlocked priv key differs")
+	}
+	if ws.HD.Mnemonic != mnemonic {
+		t.Fatal("unlocked mnemonic differs")
+	}
+
+	if err := ws.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ws.GetKey(pubKeyHash); ok || ws.HD.Seed != nil {
+		t.Fatal("wallets keep their keys once locked")
+	}
+
+	// Only the new passphrase unlocks them after it changes
+	if err := ws.ChangePassphrase("wrong", "new passphrase"); err != ErrWrongPassphrase {
+		t.Errorf("got %v changing the passphrase with a wrong one, want %v", err, ErrWrongPassphrase)
+	}
+	if err := ws.ChangePassphrase("passphrase", "new passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	ws.SaveToFile()
+
+	ws = reload(t, ws)
+	if err := ws.Unlock("passphrase"); err != ErrWrongPassphrase {
+		t.Errorf("got %v unlocking with the old passphrase, want %v", err, ErrWrongPassphrase)
+	}
+	if err := ws.Unlock("new passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := ws.GetKey(pubKeyHash); !ok || !bytes.Equal(keys.PrivateKeyBytes(key), privKey) {
+		t.Fatal("priv key differs after changing the passphrase")
+	}
+}
+
+// startAgent serves unlocked Wallets from another goroutine, returning a channel that gets its result once it stops
+func startAgent(t *testing.T, ws *Wallets) chan error {
+	t.Helper()
+
+	ready := make(chan bool)
+	done := make(chan error, 1)
+	go func() {
+		done <- ws.ServeUnlocked(time.Minute, func() { close(ready) })
+	}()
+
+	select {
+	case <-ready:
+	case err := <-done:
+		t.Fatalf("agent stopped before it was ready: %v", err)
+	}
+
+	return done
+}
+
+// waitAgent waits for an agent to stop
+func waitAgent(t *testing.T, done chan error) {
+	t.Helper()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("agent is still running")
+	}
+}
+
+// TestAgent checks that an agent keeps Wallets unlocked for the commands after wallet-unlock, until they are locked or
+// their passphrase changes
+func TestAgent(t *testing.T) {
+	ws, address, _ := newTestWallets(t)
+	pubKeyHash := ws.Wallets[address].GetPubKeyHash()
+	if err := ws.ServeUnlocked(time.Minute, func() {}); err != ErrNotEncrypted {
+		t.Errorf("got %v serving unencrypted wallets, want %v", err, ErrNotEncrypted)
+	}
+	if err := ws.Encrypt("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	ws.SaveToFile()
+
+	locked := reload(t, ws)
+	if err := locked.ServeUnlocked(time.Minute, func() {}); err != ErrLocked {
+		t.Errorf("got %v serving locked wallets, want %v", err, ErrLocked)
+	}
+
+	done := startAgent(t, ws)
+	loaded := reload(t, ws)
+	if _, ok := loaded.GetKey(pubKeyHash); !ok || loaded.IsLocked() {
+		t.Fatal("wallets are locked while the agent runs")
+	}
+	if err := loaded.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	waitAgent(t, done)
+	if !reload(t, ws).IsLocked() {
+		t.Fatal("wallets are unlocked after they were locked")
+	}
+
+	// The agent holds the key of the old passphrase
+	done = startAgent(t, ws)
+	if err := reload(t, ws).ChangePassphrase("passphrase", "new passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	waitAgent(t, done)
+	if !reload(t, ws).IsLocked() {
+		t.Fatal("wallets are unlocked after the passphrase changed")
+	}
+
+	// The agent stops by itself once the timeout passes
+	go func() {
+		done <- ws.ServeUnlocked(100*time.Millisecond, func() {})
+	}()
+	waitAgent(t, done)
+}
@@ -0,0 +1,264 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/danitello/go-blockchain/common/errutil"
+	"github.com/danitello/go-blockchain/common/keys"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// hd is deriving the keys of Wallets from one seed - BIP32 derivation on the curve of the keys (as in SLIP-0010 for
+// P-256), BIP39 mnemonics for the seed, and BIP44 paths of m/44'/0'/account'/chain/index. A key of a secp256k1 seed
+// can be handed out with a Schnorr pub key instead, whose address differs from the ecdsa one
+
+const (
+	// HardenedKeyStart is the first child idx of hardened derivation, whose keys can't be derived from the parent pub key
+	HardenedKeyStart = uint32(0x80000000)
+
+	// ExternalChain is the chain of an account for receiving
+	ExternalChain = uint32(0)
+	// InternalChain is the chain of an account for change
+	InternalChain = uint32(1)
+	// DefaultAccount is the account used when none is specified
+	DefaultAccount = uint32(0)
+
+	// GapLimit is the number of unused addresses in a row after which no more addresses of a chain are looked for
+	GapLimit = 20
+
+	// purpose and coinType are the first levels of every path, hardened
+	purpose  = uint32(44)
+	coinType = uint32(0)
+
+	// mnemonicEntropyBits is the entropy of a new mnemonic, 128 bits for 12 words
+	mnemonicEntropyBits = 128
+)
+
+// seedKeys are the HMAC keys deriving the master key from a seed on each curve
+var seedKeys = map[keys.Curve]string{
+	keys.Secp256k1: "Bitcoin seed",
+	keys.P256:      "Nist256p1 seed",
+}
+
+var (
+	// ErrInvalidMnemonic is returned when a mnemonic has unknown words or a wrong checksum
+	ErrInvalidMnemonic = errors.New("Invalid mnemonic")
+	// ErrNoSeed is returned when HD keys are requested from Wallets that have no seed
+	ErrNoSeed = errors.New("Wallets have no seed, create a wallet or restore one from its mnemonic first")
+	// ErrHasSeed is returned when a seed is set on Wallets that already have one
+	ErrHasSeed = errors.New("Wallets already have a seed")
+	// ErrNoSchnorr is returned when Schnorr keys are requested from a seed of keys on a curve other than secp256k1
+	ErrNoSchnorr = errors.New("Schnorr keys need a secp256k1 wallet seed")
+)
+
+// ExtendedKey is a priv key that child keys can be derived from -
+// Curve - of the key and its children
+// Key - the 32 byte priv key
+// ChainCode - the extra entropy of the children
+// Depth - number of derivations from the master key
+type ExtendedKey struct {
+	Curve     keys.Curve
+	Key       []byte
+	ChainCode []byte
+	Depth     int
+}
+
+// HDKeyChain is the seed the keys of Wallets are derived from -
+// Mnemonic - the words the seed is computed from, to back it up
+// Curve - of the keys derived, keys.P256 for seeds made before secp256k1 keys
+// NextIdx - idx of the next key to hand out on each chain, keyed by "account/chain"
+// EncryptedMnemonic - Mnemonic sealed with the key of encrypted Wallets, which don't store Mnemonic and Seed
+type HDKeyChain struct {
+	Mnemonic          string
+	Seed              []byte
+	Curve             keys.Curve
+	NextIdx           map[string]uint32
+	EncryptedMnemonic []byte
+}
+
+// NewMnemonic generates the words of a new random seed
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(mnemonicEntropyBits)
+	if err != nil {
+		return "", err
+	}
+
+	return bip39.NewMnemonic(entropy)
+}
+
+// NewHDKeyChain makes the HDKeyChain of a mnemonic, deriving keys on a curve
+func NewHDKeyChain(mnemonic string, curve keys.Curve) (*HDKeyChain, error) {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	// IsMnemonicValid only looks the words up, the checksum is checked by getting the entropy back
+	if _, err := bip39.EntropyFromMnemonic(mnemonic); err != nil {
+		return nil, ErrInvalidMnemonic
+	}
+	if _, ok := seedKeys[curve]; !ok {
+		return nil, keys.ErrUnknownCurve
+	}
+
+	seed := bip39.NewSeed(mnemonic, "")
+	return &HDKeyChain{Mnemonic: mnemonic, Seed: seed, Curve: curve, NextIdx: make(map[string]uint32)}, nil
+}
+
+// NewMasterKey derives the root ExtendedKey of a seed on a curve
+func NewMasterKey(curve keys.Curve, seed []byte) *ExtendedKey {
+	seedKey := []byte(seedKeys[curve])
+	I := hmacSHA512(seedKey, seed)
+
+	// Rehash until the key is valid
+	for !keys.ValidPrivateKey(curve, I[:32]) {
+		I = hmacSHA512(seedKey, I)
+	}
+
+	return &ExtendedKey{Curve: curve, Key: I[:32], ChainCode: I[32:]}
+}
+
+// Child derives the ExtendedKey of a given idx, hardened from HardenedKeyStart on
+func (k *ExtendedKey) Child(idx uint32) *ExtendedKey {
+	curve := k.Curve.Params()
+
+	var data []byte
+	if idx >= HardenedKeyStart {
+		data = append([]byte{0x00}, k.Key...)
+	} else {
+		x, y := curve.ScalarBaseMult(k.Key)
+		data = keys.CompressPoint(x, y)
+	}
+	data = append(data, uint32Bytes(idx)...)
+
+	for {
+		I := hmacSHA512(k.ChainCode, data)
+
+		if keys.ValidPrivateKey(k.Curve, I[:32]) {
+			childKey := new(big.Int).SetBytes(I[:32])
+			childKey.Add(childKey, new(big.Int).SetBytes(k.Key))
+			childKey.Mod(childKey, curve.Params().N)
+
+			if childKey.Sign() != 0 {
+				return &ExtendedKey{Curve: k.Curve, Key: paddedBytes(childKey), ChainCode: I[32:], Depth: k.Depth + 1}
+			}
+		}
+
+		// Retry with the rejected hash rather than skipping the idx
+		data = append(append([]byte{0x01}, I[32:]...), uint32Bytes(idx)...)
+	}
+}
+
+// Derive derives the ExtendedKey at the end of a path of child idxs
+func (k *ExtendedKey) Derive(path []uint32) *ExtendedKey {
+	key := k
+	for _, idx := range path {
+		key = key.Child(idx)
+	}
+
+	return key
+}
+
+// PrivateKey gets the ecdsa priv key of an ExtendedKey
+func (k *ExtendedKey) PrivateKey() ecdsa.PrivateKey {
+	privKey, err := keys.PrivateKeyFromBytes(k.Curve, k.Key)
+	errutil.Handle(err)
+
+	return privKey
+}
+
+// KeyPath gets the path of the key with a given idx on a chain of an account
+func KeyPath(account, chain, idx uint32) []uint32 {
+	return []uint32{purpose + HardenedKeyStart, coinType + HardenedKeyStart, account + HardenedKeyStart, chain, idx}
+}
+
+// FormatPath writes a path as m/44'/0'/0'/0/1
+func FormatPath(path []uint32) string {
+	s := "m"
+	for _, idx := range path {
+		if idx >= HardenedKeyStart {
+			s += fmt.Sprintf("/%d'", idx-HardenedKeyStart)
+		} else {
+			s += fmt.Sprintf("/%d", idx)
+		}
+	}
+
+	return s
+}
+
+// ParsePath reads a path written as m/44'/0'/0'/0/1
+func ParsePath(s string) ([]uint32, error) {
+	parts := strings.Split(s, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("Invalid path %q, it must start at m", s)
+	}
+
+	var path []uint32
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'")
+		idx, err := strconv.ParseUint(strings.TrimSuffix(part, "'"), 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid path %q: %s", s, err)
+		}
+
+		if hardened {
+			idx += uint64(HardenedKeyStart)
+		}
+		path = append(path, uint32(idx))
+	}
+
+	return path, nil
+}
+
+// nextWallet derives the Wallet of the next key of a chain of an account, with a Schnorr pub key if schnorr
+func (hd *HDKeyChain) nextWallet(account, chain uint32, schnorr bool) *Wallet {
+	key := chainKey(account, chain)
+	idx := hd.NextIdx[key]
+	hd.NextIdx[key] = idx + 1
+
+	w := hd.wallet(account, chain, idx)
+	if schnorr {
+		w.PublicKey = keys.EncodeSchnorrPubKey(w.PrivateKey.PublicKey)
+	}
+
+	return w
+}
+
+// wallet derives the Wallet of the key with a given idx on a chain of an account
+func (hd *HDKeyChain) wallet(account, chain, idx uint32) *Wallet {
+	path := KeyPath(account, chain, idx)
+	priv := NewMasterKey(hd.Curve, hd.Seed).Derive(path).PrivateKey()
+
+	return &Wallet{PrivateKey: priv, PublicKey: keys.EncodePubKey(priv.PublicKey), Path: FormatPath(path)}
+}
+
+// chainKey is the key of a chain of an account in NextIdx
+func chainKey(account, chain uint32) string {
+	return fmt.Sprintf("%d/%d", account, chain)
+}
+
+// hmacSHA512 computes the HMAC-SHA512 of data
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+
+	return mac.Sum(nil)
+}
+
+// uint32Bytes writes a uint32 big-endian
+func uint32Bytes(n uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, n)
+
+	return b
+}
+
+// paddedBytes writes a big.Int as 32 bytes
+func paddedBytes(n *big.Int) []byte {
+	b := make([]byte, 32)
+	return n.FillBytes(b)
+}
@@ -0,0 +1,190 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/danitello/go-blockchain/common/keys"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// fromHex decodes a hex string of a test vector
+func fromHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// TestDerive derives the keys of the SLIP-0010 test vectors - the secp256k1 ones are the BIP32 test vectors 1 and 2
+// in hex, and the retry ones cover the invalid keys BIP32 doesn't reach in practice
+func TestDerive(t *testing.T) {
+	const (
+		seed1 = "000102030405060708090a0b0c0d0e0f"
+		seed2 = "fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542"
+		h     = HardenedKeyStart
+	)
+
+	for _, test := range []struct {
+		name      string
+		curve     keys.Curve
+		seed      string
+		path      []uint32
+		chainCode string
+		key       string
+	}{
+		{"secp256k1 1 m", keys.Secp256k1, seed1, nil,
+			"873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508",
+			"e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+		{"secp256k1 1 m/0H", keys.Secp256k1, seed1, []uint32{h},
+			"47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141",
+			"edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{"secp256k1 1 m/0H/1", keys.Secp256k1, seed1, []uint32{h, 1},
+			"2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19",
+			"3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		{"secp256k1 1 m/0H/1/2H", keys.Secp256k1, seed1, []uint32{h, 1, h + 2},
+			"04466b9cc8e161e966409ca52986c584f07e9dc81f735db683c3ff6ec7b1503f",
+			"cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca"},
+		{"secp256k1 1 m/0H/1/2H/2", keys.Secp256k1, seed1, []uint32{h, 1, h + 2, 2},
+			"cfb71883f01676f587d023cc53a35bc7f88f724b1f8c2892ac1275ac822a3edd",
+			"0f479245fb19a38a1954c5c7c0ebab2f9bdfd96a17563ef28a6a4b1a2a764ef4"},
+		{"secp256k1 1 m/0H/1/2H/2/1000000000", keys.Secp256k1, seed1, []uint32{h, 1, h + 2, 2, 1000000000},
+			"c783e67b921d2beb8f6b389cc646d7263b4145701dadd2161548a8b078e65e9e",
+			"471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8"},
+		{"secp256k1 2 m", keys.Secp256k1, seed2, nil,
+			"60499f801b896d83179a4374aeb7822aaeaceaa0db1f85ee3e904c4defbd9689",
+			"4b03d6fc340455b363f51020ad3ecca4f0850280cf436c70c727923f6db46c3e"},
+		{"secp256k1 2 m/0", keys.Secp256k1, seed2, []uint32{0},
+			"f0909affaa7ee7abe5dd4e100598d4dc53cd709d5a5c2cac40e7412f232f7c9c",
+			"abe74a98f6c7eabee0428f53798f0ab8aa1bd37873999041703c742f15ac7e1e"},
+		{"secp256k1 2 m/0/2147483647H", keys.Secp256k1, seed2, []uint32{0, h + 2147483647},
+			"be17a268474a6bb9c61e1d720cf6215e2a88c5406c4aee7b38547f585c9a37d9",
+			"877c779ad9687164e9c2f4f0f4ff0340814392330693ce95a58fe18fd52e6e93"},
+		{"secp256k1 2 m/0/2147483647H/1", keys.Secp256k1, seed2, []uint32{0, h + 2147483647, 1},
+			"f366f48f1ea9f2d1d3fe958c95ca84ea18e4c4ddb9366c336c927eb246fb38cb",
+			"704addf544a06e5ee4bea37098463c23613da32020d604506da8c0518e1da4b7"},
+		{"secp256k1 2 m/0/2147483647H/1/2147483646H", keys.Secp256k1, seed2, []uint32{0, h + 2147483647, 1, h + 2147483646},
+			"637807030d55d01f9a0cb3a7839515d796bd07706386a6eddf06cc29a65a0e29",
+			"f1c7c871a54a804afe328b4c83a1c33b8e5ff48f5087273f04efa83b247d6a2d"},
+		{"secp256k1 2 m/0/2147483647H/1/2147483646H/2", keys.Secp256k1, seed2, []uint32{0, h + 2147483647, 1, h + 2147483646, 2},
+			"9452b549be8cea3ecb7a84bec10dcfd94afe4d129ebfd3b3cb58eedf394ed271",
+			"bb7d39bdb83ecf58f2fd82b6d918341cbef428661ef01ab97c28a4842125ac23"},
+		{"nist256p1 1 m", keys.P256, seed1, nil,
+			"beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea",
+			"612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+		{"nist256p1 1 m/0H", keys.P256, seed1, []uint32{h},
+			"3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11",
+			"6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+		{"nist256p1 1 m/0H/1", keys.P256, seed1, []uint32{h, 1},
+			"4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c",
+			"284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129"},
+		{"nist256p1 1 m/0H/1/2H", keys.P256, seed1, []uint32{h, 1, h + 2},
+			"98c7514f562e64e74170cc3cf304ee1ce54d6b6da4f880f313e8204c2a185318",
+			"694596e8a54f252c960eb771a3c41e7e32496d03b954aeb90f61635b8e092aa7"},
+		{"nist256p1 1 m/0H/1/2H/2", keys.P256, seed1, []uint32{h, 1, h + 2, 2},
+			"ba96f776a5c3907d7fd48bde5620ee374d4acfd540378476019eab70790c63a0",
+			"5996c37fd3dd2679039b23ed6f70b506c6b56b3cb5e424681fb0fa64caf82aaa"},
+		{"nist256p1 1 m/0H/1/2H/2/1000000000", keys.P256, seed1, []uint32{h, 1, h + 2, 2, 1000000000},
+			"b9b7b82d326bb9cb5b5b121066feea4eb93d5241103c9e7a18aad40f1dde8059",
+			"21c4f269ef0a5fd1badf47eeacebeeaa3de22eb8e5b0adcd0f27dd99d34d0119"},
+		{"nist256p1 2 m", keys.P256, seed2, nil,
+			"96cd4465a9644e31528eda3592aa35eb39a9527769ce1855beafc1b81055e75d",
+			"eaa31c2e46ca2962227cf21d73a7ef0ce8b31c756897521eb6c7b39796633357"},
+		{"nist256p1 2 m/0", keys.P256, seed2, []uint32{0},
+			"84e9c258bb8557a40e0d041115b376dd55eda99c0042ce29e81ebe4efed9b86a",
+			"d7d065f63a62624888500cdb4f88b6d59c2927fee9e6d0cdff9cad555884df6e"},
+		{"nist256p1 2 m/0/2147483647H", keys.P256, seed2, []uint32{0, h + 2147483647},
+			"f235b2bc5c04606ca9c30027a84f353acf4e4683edbd11f635d0dcc1cd106ea6",
+			"96d2ec9316746a75e7793684ed01e3d51194d81a42a3276858a5b7376d4b94b9"},
+		{"nist256p1 2 m/0/2147483647H/1", keys.P256, seed2, []uint32{0, h + 2147483647, 1},
+			"7c0b833106235e452eba79d2bdd58d4086e663bc8cc55e9773d2b5eeda313f3b",
+			"974f9096ea6873a915910e82b29d7c338542ccde39d2064d1cc228f371542bbc"},
+		{"nist256p1 2 m/0/2147483647H/1/2147483646H", keys.P256, seed2, []uint32{0, h + 2147483647, 1, h + 2147483646},
+			"5794e616eadaf33413aa309318a26ee0fd5163b70466de7a4512fd4b1a5c9e6a",
+			"da29649bbfaff095cd43819eda9a7be74236539a29094cd8336b07ed8d4eff63"},
+		{"nist256p1 2 m/0/2147483647H/1/2147483646H/2", keys.P256, seed2, []uint32{0, h + 2147483647, 1, h + 2147483646, 2},
+			"3bfb29ee8ac4484f09db09c2079b520ea5616df7820f071a20320366fbe226a7",
+			"bb0a77ba01cc31d77205d51d08bd313b979a71ef4de9b062f8958297e746bd67"},
+		{"nist256p1 derivation retry m/28578H", keys.P256, seed1, []uint32{h + 28578},
+			"e94c8ebe30c2250a14713212f6449b20f3329105ea15b652ca5bdfc68f6c65c2",
+			"06f0db126f023755d0b8d86d4591718a5210dd8d024e3e14b6159d63f53aa669"},
+		{"nist256p1 derivation retry m/28578H/33941", keys.P256, seed1, []uint32{h + 28578, 33941},
+			"9e87fe95031f14736774cd82f25fd885065cb7c358c1edf813c72af535e83071",
+			"092154eed4af83e078ff9b84322015aefe5769e31270f62c3f66c33888335f3a"},
+		{"nist256p1 seed retry m", keys.P256, "a7305bc8df8d0951f0cb224c0e95d7707cbdf2c6ce7e8d481fec69c7ff5e9446", nil,
+			"7762f9729fed06121fd13f326884c82f59aa95c57ac492ce8c9654e60efd130c",
+			"3b8c18469a4634517d6d0b65448f8e6c62091b45540a1743c5846be55d47d88f"},
+	} {
+		key := NewMasterKey(test.curve, fromHex(t, test.seed)).Derive(test.path)
+		if !bytes.Equal(key.ChainCode, fromHex(t, test.chainCode)) {
+			t.Errorf("%s: got chain code %x, want %s", test.name, key.ChainCode, test.chainCode)
+		}
+		if !bytes.Equal(key.Key, fromHex(t, test.key)) {
+			t.Errorf("%s: got key %x, want %s", test.name, key.Key, test.key)
+		}
+		if key.Depth != len(test.path) {
+			t.Errorf("%s: got depth %d, want %d", test.name, key.Depth, len(test.path))
+		}
+	}
+}
+
+// TestMnemonic checks the mnemonics and seeds of the BIP39 test vectors, which use the passphrase "TREZOR", and the
+// seed of an HDKeyChain, which uses none
+func TestMnemonic(t *testing.T) {
+	for _, test := range []struct {
+		entropy  string
+		mnemonic string
+		seed     string
+	}{
+		{"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"},
+		{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607"},
+		{"80808080808080808080808080808080",
+			"letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+			"d71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8"},
+		{"ffffffffffffffffffffffffffffffff",
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+			"ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069"},
+	} {
+		mnemonic, err := bip39.NewMnemonic(fromHex(t, test.entropy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mnemonic != test.mnemonic {
+			t.Errorf("got mnemonic %q of entropy %s, want %q", mnemonic, test.entropy, test.mnemonic)
+		}
+		if seed := bip39.NewSeed(test.mnemonic, "TREZOR"); !bytes.Equal(seed, fromHex(t, test.seed)) {
+			t.Errorf("got seed %x of %q, want %s", seed, test.mnemonic, test.seed)
+		}
+		if _, err := NewHDKeyChain(test.mnemonic, keys.Secp256k1); err != nil {
+			t.Errorf("%q: %s", test.mnemonic, err)
+		}
+	}
+
+	// Extra whitespace is dropped before the seed is computed
+	hd, err := NewHDKeyChain(" abandon abandon abandon abandon abandon abandon\n abandon abandon abandon abandon abandon  about ", keys.Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+	if !bytes.Equal(hd.Seed, fromHex(t, seed)) {
+		t.Errorf("got seed %x, want %s", hd.Seed, seed)
+	}
+
+	for _, mnemonic := range []string{
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon notaword",
+	} {
+		if _, err := NewHDKeyChain(mnemonic, keys.Secp256k1); err != ErrInvalidMnemonic {
+			t.Errorf("got %v making the key chain of %q, want %v", err, mnemonic, ErrInvalidMnemonic)
+		}
+	}
+}
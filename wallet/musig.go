@@ -0,0 +1,94 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/danitello/go-blockchain/common/keys"
+)
+
+// musig is keeping the secret nonces of the Wallets between the two rounds of MuSig signing, as every cosigner has to
+// share its public nonce before any of them signs - a secret nonce is removed before it is signed with, so it never
+// signs twice
+
+// SecretNonce is the secret part of a MuSig nonce made for the pub key of a Wallet -
+// PubKey - of the Wallet the nonce is for
+// Secret - the secret scalars of the nonce, nil if the Wallets are encrypted
+// EncryptedSecret - Secret sealed with the key of encrypted Wallets, bound to PubKey
+type SecretNonce struct {
+	PubKey          []byte
+	Secret          []byte
+	EncryptedSecret []byte
+}
+
+// NewMuSigNonce makes a MuSig nonce for the pub key of a Wallet, keeping its secret part until it signs - returns the
+// public nonce to share, and false if the priv key of the pub key isn't in the unlocked Wallets
+func (ws *Wallets) NewMuSigNonce(pubKey []byte) ([]byte, bool, error) {
+	if _, ok := ws.GetKey(HashPubKey(pubKey)); !ok {
+		return nil, false, nil
+	}
+
+	nonce, err := keys.NewMuSigNonce()
+	if err != nil {
+		return nil, false, err
+	}
+	secret, err := nonce.Secret()
+	if err != nil {
+		return nil, false, err
+	}
+
+	secretNonce := &SecretNonce{PubKey: pubKey, Secret: secret}
+	if ws.IsEncrypted() {
+		if secretNonce.EncryptedSecret, err = seal(ws.key, secret, pubKey); err != nil {
+			return nil, false, err
+		}
+		secretNonce.Secret = nil
+	}
+	ws.MuSigNonces[hex.EncodeToString(nonce.Public)] = secretNonce
+
+	return nonce.Public, true, nil
+}
+
+// MuSigSign makes the partial signature of a hash with the priv key of a Wallet and the secret nonce kept for a
+// public nonce, which is removed - returns false if the Wallets don't have the secret nonce
+func (ws *Wallets) MuSigSign(pubKey, pubNonce []byte, pubKeys [][]byte, aggNonce, hash []byte) ([]byte, bool, error) {
+	id := hex.EncodeToString(pubNonce)
+	secretNonce, ok := ws.MuSigNonces[id]
+	if !ok || !bytes.Equal(secretNonce.PubKey, pubKey) {
+		return nil, false, nil
+	}
+	privKey, ok := ws.GetKey(HashPubKey(pubKey))
+	if !ok {
+		return nil, false, ErrLocked
+	}
+	secret, err := ws.openNonce(secretNonce)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Gone before signing, whether or not signing goes on
+	delete(ws.MuSigNonces, id)
+
+	nonce, err := keys.MuSigNonceFromSecret(secret)
+	if err != nil {
+		return nil, false, err
+	}
+	partial, err := keys.MuSigSign(privKey, nonce, pubKeys, aggNonce, hash)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return partial, true, nil
+}
+
+// openNonce gets the secret of a SecretNonce, decrypting it with the key of the unlocked Wallets if it is encrypted
+func (ws *Wallets) openNonce(secretNonce *SecretNonce) ([]byte, error) {
+	if secretNonce.EncryptedSecret == nil {
+		return secretNonce.Secret, nil
+	}
+	if ws.key == nil {
+		return nil, ErrLocked
+	}
+
+	return open(ws.key, secretNonce.EncryptedSecret, secretNonce.PubKey)
+}
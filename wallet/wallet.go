@@ -3,11 +3,11 @@ package wallet
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
+	"encoding/gob"
 
 	"github.com/danitello/go-blockchain/common/errutil"
+	"github.com/danitello/go-blockchain/common/keys"
 	"github.com/danitello/go-blockchain/wallet/walletutil"
 	"golang.org/x/crypto/ripemd160"
 )
@@ -19,49 +19,125 @@ const (
 	version = byte(0x00)
 )
 
-// Wallet is the entity for ownership on the chain
+// Wallet is the entity for ownership on the chain -
+// PubKeyHash - set only for a watch-only address imported without its pub key
+// Path - derivation path of the key from the seed of its Wallets, empty for a random key
+// Address - the Bech32 address of the Wallet, empty for a Base58 one
+// encryptedKey - priv key sealed with the key of its Wallets if they are encrypted, PrivateKey is only set if unlocked
 type Wallet struct {
-	PrivateKey ecdsa.PrivateKey
-	PublicKey  []byte
+	PrivateKey   ecdsa.PrivateKey
+	PublicKey    []byte
+	PubKeyHash   []byte
+	Path         string
+	Address      string
+	encryptedKey []byte
 }
 
-// InitWallet initializes a new Wallet
-func InitWallet() *Wallet {
-	priv, pub := createKeyPair()
-	return &Wallet{priv, pub}
+// walletData is the stored form of a Wallet, as the curve of an ecdsa.PrivateKey can't be encoded - it is the curve
+// of PublicKey, and D is left out if the Wallet is encrypted
+type walletData struct {
+	D            []byte
+	PublicKey    []byte
+	PubKeyHash   []byte
+	Path         string
+	Address      string
+	EncryptedKey []byte
 }
 
-// createKeyPair makes a new priv and pub key pair
-func createKeyPair() (ecdsa.PrivateKey, []byte) {
-	curve := elliptic.P256()
-	privKey, err := ecdsa.GenerateKey(curve, rand.Reader)
-	errutil.Handle(err)
+// InitWallet initializes a new Wallet with a random key on a curve
+func InitWallet(curve keys.Curve) *Wallet {
+	priv, pub := createKeyPair(curve)
+	return &Wallet{PrivateKey: priv, PublicKey: pub}
+}
 
-	// Derive []byte representation of pub key
-	pubKey := append(privKey.PublicKey.X.Bytes(), privKey.PublicKey.Y.Bytes()...)
-	return *privKey, pubKey
+// HasPrivateKey determines if the priv key of a Wallet is available for signing
+func (w Wallet) HasPrivateKey() bool {
+	return w.PrivateKey.D != nil
 }
 
-// GetAddress derives the human readable address for a Wallet using pub key hash, version, and checksum (bitcoin spec)
-func (w Wallet) GetAddress() []byte {
-	pubKeyHash := HashPubKey(w.PublicKey)
+// IsWatchOnly determines if a Wallet has no priv key at all, only tracking the balance of an address
+func (w Wallet) IsWatchOnly() bool {
+	return !w.HasPrivateKey() && w.encryptedKey == nil
+}
 
-	versionedHash := append([]byte{version}, pubKeyHash...)
-	checksum := checksum(versionedHash)
-	fullHash := append(versionedHash, checksum...)
+// GetPubKeyHash gets the pub key hash a Wallet owns the txos of
+func (w Wallet) GetPubKeyHash() []byte {
+	if w.PublicKey == nil {
+		return w.PubKeyHash
+	}
+
+	return HashPubKey(w.PublicKey)
+}
+
+// GobEncode encodes a Wallet by its priv key bytes, or the encrypted ones
+func (w Wallet) GobEncode() ([]byte, error) {
+	wd := walletData{PublicKey: w.PublicKey, PubKeyHash: w.PubKeyHash, Path: w.Path, Address: w.Address, EncryptedKey: w.encryptedKey}
+	if w.encryptedKey == nil && w.HasPrivateKey() {
+		wd.D = keys.PrivateKeyBytes(w.PrivateKey)
+	}
+
+	var data bytes.Buffer
+	err := gob.NewEncoder(&data).Encode(wd)
+
+	return data.Bytes(), err
+}
+
+// GobDecode decodes a Wallet, recomputing its ecdsa.PrivateKey from the priv key bytes
+func (w *Wallet) GobDecode(data []byte) error {
+	var wd walletData
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&wd); err != nil {
+		return err
+	}
+
+	if len(wd.D) > 0 {
+		privKey, err := privateKeyFromBytes(wd.PublicKey, wd.D)
+		if err != nil {
+			return err
+		}
+		w.PrivateKey = privKey
+	}
+	w.PublicKey = wd.PublicKey
+	w.PubKeyHash = wd.PubKeyHash
+	w.Path = wd.Path
+	w.Address = wd.Address
+	w.encryptedKey = wd.EncryptedKey
+	return nil
+}
 
-	return walletutil.Base58Encode(fullHash)
+// createKeyPair makes a new priv and pub key pair on a curve
+func createKeyPair(curve keys.Curve) (ecdsa.PrivateKey, []byte) {
+	privKey, err := keys.GenerateKey(curve)
+	errutil.Handle(err)
+
+	return privKey, keys.EncodePubKey(privKey.PublicKey)
+}
+
+// privateKeyFromBytes makes the ecdsa.PrivateKey of priv key bytes, on the curve of its pub key
+func privateKeyFromBytes(pubKey, d []byte) (ecdsa.PrivateKey, error) {
+	key, err := keys.ParsePubKey(pubKey)
+	if err != nil {
+		return ecdsa.PrivateKey{}, err
+	}
+
+	return keys.PrivateKeyFromBytes(keys.CurveOf(key), d)
 }
 
-// ValidateAddress determines if a given address is correctly constructed
-func ValidateAddress(address string) bool {
-	decodedAddress := walletutil.Base58Decode([]byte(address))
+// GetAddress derives the human readable address for a Wallet using pub key hash, version, and checksum (bitcoin spec),
+// unless it has a Bech32 one
+func (w Wallet) GetAddress() []byte {
+	if w.Address != "" {
+		return []byte(w.Address)
+	}
 
-	addressChecksum := decodedAddress[len(decodedAddress)-ChecksumLen:]
-	targetChecksum := checksum(decodedAddress[0 : len(decodedAddress)-ChecksumLen])
+	return []byte(GetAddressFromPubKeyHash(w.GetPubKeyHash()))
+}
 
-	return bytes.Compare(addressChecksum, targetChecksum) == 0
+// ValidateAddress determines if a given address is correctly constructed - a Base58 one, or a Bech32 one under the
+// prefix of the network
+func ValidateAddress(address, hrp string) bool {
+	_, addressHRP, err := DecodeAddress(address)
 
+	return err == nil && (addressHRP == "" || addressHRP == hrp)
 }
 
 // HashPubKey computes the pub key hash
@@ -85,9 +161,19 @@ func checksum(payload []byte) []byte {
 	return secondSHA[:ChecksumLen]
 }
 
-// GetPubKeyHashFromAddress takes in an address and returns its pub key hash portion
+// GetPubKeyHashFromAddress takes in a Base58 or Bech32 address and returns its pub key hash portion
 func GetPubKeyHashFromAddress(address string) []byte {
-	decodedAddress := walletutil.Base58Decode([]byte(address))
-	pubKeyHash := decodedAddress[1 : len(decodedAddress)-ChecksumLen]
+	pubKeyHash, _, err := DecodeAddress(address)
+	errutil.Handle(err)
+
 	return pubKeyHash
 }
+
+// GetAddressFromPubKeyHash derives the address of a pub key hash
+func GetAddressFromPubKeyHash(pubKeyHash []byte) string {
+	versionedHash := append([]byte{version}, pubKeyHash...)
+	checksum := checksum(versionedHash)
+	fullHash := append(versionedHash, checksum...)
+
+	return string(walletutil.Base58Encode(fullHash))
+}
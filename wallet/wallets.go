@@ -2,40 +2,218 @@ package wallet
 
 import (
 	"bytes"
-	"crypto/elliptic"
+	"crypto/ecdsa"
 	"encoding/gob"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"github.com/danitello/go-blockchain/common/errutil"
+	"github.com/danitello/go-blockchain/common/keys"
 )
 
-const walletFile = "./tmp/wallets.dat"
-
-// Wallets keeps track of all current Wallet structs
+// Wallets keeps track of all current Wallet structs -
+// HD - seed new Wallets are derived from, nil for Wallets of random keys only
+// Encryption - how the priv keys and seed are encrypted, nil if they are not
+// MuSigNonces - secret MuSig nonces not signed with yet, by public nonce in hex
+// key - key decrypting them while unlocked
 type Wallets struct {
-	Wallets map[string]*Wallet
+	Wallets     map[string]*Wallet
+	HD          *HDKeyChain
+	Encryption  *Encryption
+	MuSigNonces map[string]*SecretNonce
+	file        string
+	key         []byte
 }
 
-// InitWallets makes a new Wallets struct and loads it with previous Wallets data if possible
-func InitWallets() (*Wallets, error) {
+// InitWallets makes a new Wallets struct backed by a given file and loads it with previous Wallets data if possible
+func InitWallets(walletFile string) (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.MuSigNonces = make(map[string]*SecretNonce)
+	wallets.file = walletFile
 
 	err := wallets.LoadFromFile()
+	if wallets.IsEncrypted() {
+		wallets.unlockFromAgent()
+	}
 
 	return &wallets, err
 }
 
-// CreateWallet makes a new wallet and adds it to the Wallets
-func (ws *Wallets) CreateWallet() string {
-	wallet := InitWallet()
+// InitSeed gives the Wallets a new random seed to derive Wallets on a curve from, returning its mnemonic
+func (ws *Wallets) InitSeed(curve keys.Curve) (string, error) {
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		return "", err
+	}
+
+	return mnemonic, ws.Restore(mnemonic, curve)
+}
+
+// Restore gives the Wallets the seed of a mnemonic to derive Wallets on a curve from - Discover finds the ones already
+// in use
+func (ws *Wallets) Restore(mnemonic string, curve keys.Curve) error {
+	if ws.HD != nil {
+		return ErrHasSeed
+	}
+	if ws.IsLocked() {
+		return ErrLocked
+	}
+
+	hd, err := NewHDKeyChain(mnemonic, curve)
+	if err != nil {
+		return err
+	}
+
+	if ws.IsEncrypted() {
+		hd.EncryptedMnemonic, err = seal(ws.key, []byte(hd.Mnemonic), nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	ws.HD = hd
+	return nil
+}
+
+// CreateWallet makes a new wallet and adds it to the Wallets - the next receiving key of the default account if the
+// Wallets have a seed, a random key otherwise
+func (ws *Wallets) CreateWallet() (string, error) {
+	return ws.createWallet(DefaultAccount, ExternalChain)
+}
+
+// CreateChangeWallet makes a new wallet for receiving change and adds it to the Wallets - the next change key of the
+// default account if the Wallets have a seed, a random key otherwise
+func (ws *Wallets) CreateChangeWallet() (string, error) {
+	return ws.createWallet(DefaultAccount, InternalChain)
+}
+
+// CreateAccountWallet makes the wallet of the next key of a chain of an account and adds it to the Wallets - with a
+// Bech32 address under hrp, or a Base58 one if it is ""
+func (ws *Wallets) CreateAccountWallet(account, chain uint32, hrp string) (string, error) {
+	return ws.createAccountWallet(account, chain, false, hrp)
+}
+
+// CreateSchnorrWallet makes the wallet of the next key of a chain of an account with a Schnorr pub key, so its txos
+// are spent with Schnorr signatures, and adds it to the Wallets - with a Bech32m address under hrp, or a Base58 one if
+// it is ""
+func (ws *Wallets) CreateSchnorrWallet(account, chain uint32, hrp string) (string, error) {
+	if ws.HD != nil && ws.HD.Curve != keys.Secp256k1 {
+		return "", ErrNoSchnorr
+	}
+
+	return ws.createAccountWallet(account, chain, true, hrp)
+}
+
+// createAccountWallet makes the wallet of the next key of a chain of an account, with a Schnorr pub key if schnorr and
+// a Bech32 address if hrp isn't ""
+func (ws *Wallets) createAccountWallet(account, chain uint32, schnorr bool, hrp string) (string, error) {
+	if ws.HD == nil {
+		return "", ErrNoSeed
+	}
+	if ws.IsLocked() {
+		return "", ErrLocked
+	}
+	if account >= HardenedKeyStart || (chain != ExternalChain && chain != InternalChain) {
+		return "", fmt.Errorf("Invalid account %d or chain %d", account, chain)
+	}
+
+	w := ws.HD.nextWallet(account, chain, schnorr)
+	if hrp != "" {
+		w.useBech32(hrp)
+	}
+	return ws.addWallet(w)
+}
+
+// createWallet makes the wallet of the next key of a chain of an account if the Wallets have a seed, a random key
+// otherwise
+func (ws *Wallets) createWallet(account, chain uint32) (string, error) {
+	if ws.HD != nil {
+		return ws.CreateAccountWallet(account, chain, "")
+	}
+	if ws.IsLocked() {
+		return "", ErrLocked
+	}
+
+	return ws.addWallet(InitWallet(keys.DefaultCurve))
+}
+
+// Discover adds the Wallets of the seed that have been used, by scanning each chain of each account until GapLimit
+// unused addresses in a row - accounts are scanned in order until one has no used address - returns the number of
+// Wallets added. A key of a secp256k1 seed counts as used if its ecdsa or Schnorr address is, and each used one is
+// added
+func (ws *Wallets) Discover(used func(pubKeyHash []byte) bool) (int, error) {
+	if ws.HD == nil {
+		return 0, ErrNoSeed
+	}
+	if ws.IsLocked() {
+		return 0, ErrLocked
+	}
+
+	added := 0
+	for account := DefaultAccount; account < HardenedKeyStart; account++ {
+		accountUsed := false
+
+		for _, chain := range []uint32{ExternalChain, InternalChain} {
+			var pending []*Wallet // unused Wallets since the last used one
+			for gap := 0; gap < GapLimit; gap++ {
+				w := ws.HD.wallet(account, chain, ws.HD.NextIdx[chainKey(account, chain)]+uint32(len(pending)))
+				keyUsed := used(HashPubKey(w.PublicKey))
+				if ws.HD.Curve == keys.Secp256k1 {
+					sw := *w
+					sw.PublicKey = keys.EncodeSchnorrPubKey(w.PrivateKey.PublicKey)
+					if used(HashPubKey(sw.PublicKey)) {
+						if keyUsed {
+							pending = append(pending, w)
+						}
+						w, keyUsed = &sw, true
+					}
+				}
+				pending = append(pending, w)
+				if !keyUsed {
+					continue
+				}
+
+				// Keep the unused Wallets before a used one too, they may be used later
+				for _, w := range pending {
+					if existing, ok := ws.walletOf(w.GetPubKeyHash()); ok {
+						w.Address = existing.Address
+					} else {
+						added++
+					}
+					if _, err := ws.addWallet(w); err != nil {
+						return added, err
+					}
+				}
+				ws.HD.NextIdx[chainKey(account, chain)] += uint32(len(pending))
+				pending = nil
+				gap = -1
+				accountUsed = true
+			}
+		}
+
+		if !accountUsed {
+			break
+		}
+	}
+
+	return added, nil
+}
+
+// addWallet adds a Wallet to the Wallets, encrypting its priv key if they are encrypted - returns its address
+func (ws *Wallets) addWallet(wallet *Wallet) (string, error) {
+	if ws.IsEncrypted() {
+		if err := ws.sealWallet(wallet); err != nil {
+			return "", err
+		}
+	}
 	address := fmt.Sprintf("%s", wallet.GetAddress())
 
 	ws.Wallets[address] = wallet
 
-	return address
+	return address, nil
 }
 
 // GetAddresses retrieves all of the address from the Wallets
@@ -49,6 +227,30 @@ func (ws *Wallets) GetAddresses() []string {
 	return addresses
 }
 
+// GetKey retrieves the priv key owning the txos of a pub key hash, if it is in the Wallets and unlocked
+func (ws *Wallets) GetKey(pubKeyHash []byte) (ecdsa.PrivateKey, bool) {
+	w, ok := ws.walletOf(pubKeyHash)
+	if !ok || !w.HasPrivateKey() {
+		return ecdsa.PrivateKey{}, false
+	}
+
+	return w.PrivateKey, true
+}
+
+// walletOf retrieves the Wallet owning the txos of a pub key hash, whatever the encoding of its address
+func (ws *Wallets) walletOf(pubKeyHash []byte) (*Wallet, bool) {
+	if w, ok := ws.Wallets[GetAddressFromPubKeyHash(pubKeyHash)]; ok {
+		return w, true
+	}
+	for _, w := range ws.Wallets {
+		if bytes.Equal(w.GetPubKeyHash(), pubKeyHash) {
+			return w, true
+		}
+	}
+
+	return nil, false
+}
+
 // GetWallet retrieves a specific wallet by address
 func (ws Wallets) GetWallet(address string) Wallet {
 	return *ws.Wallets[address]
@@ -56,35 +258,69 @@ func (ws Wallets) GetWallet(address string) Wallet {
 
 // LoadFromFile loads Wallets data from disk
 func (ws *Wallets) LoadFromFile() error {
-	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
+	if _, err := os.Stat(ws.file); os.IsNotExist(err) {
 		return err
 	}
 
 	var wallets Wallets
 
-	data, err := ioutil.ReadFile(walletFile)
+	data, err := ioutil.ReadFile(ws.file)
 	errutil.Handle(err)
 
-	gob.Register(elliptic.P256())
 	decoder := gob.NewDecoder(bytes.NewReader(data))
 	err = decoder.Decode(&wallets)
 	errutil.Handle(err)
 
 	ws.Wallets = wallets.Wallets
+	ws.HD = wallets.HD
+	ws.Encryption = wallets.Encryption
+	if wallets.MuSigNonces != nil {
+		ws.MuSigNonces = wallets.MuSigNonces
+	}
+	if ws.HD != nil && ws.HD.NextIdx == nil {
+		ws.HD.NextIdx = make(map[string]uint32) // gob leaves out empty maps
+	}
+	if ws.HD != nil && ws.HD.Curve == 0 {
+		ws.HD.Curve = keys.P256 // seeds made before secp256k1 keys
+	}
 
 	return nil
 }
 
-// SaveToFile writes the Wallets data to disk
+// SaveToFile writes the Wallets data to disk, readable only by the user - encrypted Wallets without their decrypted
+// priv keys and seed
 func (ws *Wallets) SaveToFile() {
 	var data bytes.Buffer
 
-	gob.Register(elliptic.P256())
+	saved := *ws
+	if ws.IsEncrypted() && ws.HD != nil {
+		hd := *ws.HD
+		hd.Mnemonic = ""
+		hd.Seed = nil
+		saved.HD = &hd
+	}
 
 	encoder := gob.NewEncoder(&data)
-	err := encoder.Encode(ws)
+	err := encoder.Encode(saved)
 	errutil.Handle(err)
 
-	err = ioutil.WriteFile(walletFile, data.Bytes(), 0644)
+	err = os.MkdirAll(filepath.Dir(ws.file), 0700)
 	errutil.Handle(err)
+
+	err = writeFileAtomic(ws.file, data.Bytes())
+	errutil.Handle(err)
+}
+
+// writeFileAtomic replaces a file readable only by the user with data, so a crash leaves either the old or new file
+func writeFileAtomic(file string, data []byte) error {
+	tmpFile := file + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a file that already exists
+	if err := os.Chmod(tmpFile, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, file)
 }
@@ -0,0 +1,160 @@
+package walletutil
+
+import (
+	"errors"
+	"strings"
+)
+
+// bech32 is the checksummed base32 encoding of BIP173 and its Bech32m variant of BIP350 - a human-readable prefix,
+// the separator 1, then the data in a case-insensitive alphabet without look-alike characters and a checksum that
+// detects any 4 wrong characters
+
+const (
+	// bech32Charset is the alphabet of the data part, indexed by 5 bit value
+	bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	// bech32Const and bech32mConst are what the checksums of Bech32 and Bech32m strings come out as
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+	// bech32MaxLen is the longest a Bech32 string can be
+	bech32MaxLen = 90
+	// bech32ChecksumLen is the number of characters of the checksum
+	bech32ChecksumLen = 6
+)
+
+// ErrInvalidBech32 is returned when a Bech32 string is malformed or its checksum is wrong
+var ErrInvalidBech32 = errors.New("Invalid Bech32 string")
+
+// Bech32Encode encodes 5 bit values under a human-readable prefix, with a Bech32m checksum if bech32m
+func Bech32Encode(hrp string, data []byte, bech32m bool) string {
+	hrp = strings.ToLower(hrp)
+	values := append(append([]byte{}, data...), bech32Checksum(hrp, data, bech32m)...)
+
+	var encoded strings.Builder
+	encoded.WriteString(hrp)
+	encoded.WriteByte('1')
+	for _, value := range values {
+		encoded.WriteByte(bech32Charset[value])
+	}
+
+	return encoded.String()
+}
+
+// Bech32Decode decodes a Bech32 or Bech32m string into its human-readable prefix and 5 bit values - returns whether
+// its checksum is Bech32m too
+func Bech32Decode(s string) (string, []byte, bool, error) {
+	if len(s) > bech32MaxLen || (strings.ToLower(s) != s && strings.ToUpper(s) != s) {
+		return "", nil, false, ErrInvalidBech32
+	}
+	s = strings.ToLower(s)
+
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+1+bech32ChecksumLen > len(s) {
+		return "", nil, false, ErrInvalidBech32
+	}
+	hrp := s[:sep]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, false, ErrInvalidBech32
+		}
+	}
+
+	values := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		value := strings.IndexByte(bech32Charset, s[i])
+		if value < 0 {
+			return "", nil, false, ErrInvalidBech32
+		}
+		values = append(values, byte(value))
+	}
+
+	var bech32m bool
+	switch bech32Polymod(append(hrpExpand(hrp), values...)) {
+	case bech32Const:
+	case bech32mConst:
+		bech32m = true
+	default:
+		return "", nil, false, ErrInvalidBech32
+	}
+
+	return hrp, values[:len(values)-bech32ChecksumLen], bech32m, nil
+}
+
+// ConvertBits regroups values of fromBits bits into values of toBits bits - with pad, leftover bits are padded with
+// zeros into a last value, otherwise they must be fewer than fromBits and all zero
+func ConvertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var converted []byte
+	acc, bits := uint32(0), uint(0)
+	maxValue := uint32(1)<<toBits - 1
+	for _, value := range data {
+		if value>>fromBits != 0 {
+			return nil, ErrInvalidBech32
+		}
+		acc = acc<<fromBits | uint32(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			converted = append(converted, byte(acc>>bits&maxValue))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			converted = append(converted, byte(acc<<(toBits-bits)&maxValue))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxValue != 0 {
+		return nil, ErrInvalidBech32
+	}
+
+	return converted, nil
+}
+
+// bech32Checksum computes the 6 checksum values of a prefix and data
+func bech32Checksum(hrp string, data []byte, bech32m bool) []byte {
+	target := uint32(bech32Const)
+	if bech32m {
+		target = bech32mConst
+	}
+
+	values := append(hrpExpand(hrp), data...)
+	values = append(values, make([]byte, bech32ChecksumLen)...)
+	polymod := bech32Polymod(values) ^ target
+
+	checksum := make([]byte, bech32ChecksumLen)
+	for i := range checksum {
+		checksum[i] = byte(polymod >> uint(5*(5-i)) & 31)
+	}
+
+	return checksum
+}
+
+// bech32Polymod computes the BCH code the checksum is made of
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+	chk := uint32(1)
+	for _, value := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(value)
+		for i := 0; i < 5; i++ {
+			if top>>uint(i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+
+	return chk
+}
+
+// hrpExpand spreads the human-readable prefix into the values the checksum covers
+func hrpExpand(hrp string) []byte {
+	expanded := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+
+	return expanded
+}
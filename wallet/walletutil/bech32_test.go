@@ -0,0 +1,110 @@
+package walletutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// TestBech32Valid decodes the valid strings of BIP173 and BIP350, and encodes their values back
+func TestBech32Valid(t *testing.T) {
+	for _, test := range []struct {
+		s       string
+		bech32m bool
+	}{
+		{"A12UEL5L", false},
+		{"a12uel5l", false},
+		{"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs", false},
+		{"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", false},
+		{"11" + strings.Repeat("q", 82) + "c8247j", false},
+		{"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w", false},
+		{"?1ezyfcl", false},
+		{"A1LQFN3A", true},
+		{"a1lqfn3a", true},
+		{"an83characterlonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11sg7hg6", true},
+		{"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx", true},
+		{"11" + strings.Repeat("l", 83) + "udsr8", true},
+		{"split1checkupstagehandshakeupstreamerranterredcaperredlc445v", true},
+		{"?1v759aa", true},
+	} {
+		hrp, data, bech32m, err := Bech32Decode(test.s)
+		if err != nil {
+			t.Errorf("%s: %s", test.s, err)
+			continue
+		}
+		if bech32m != test.bech32m {
+			t.Errorf("%s: got bech32m %v, want %v", test.s, bech32m, test.bech32m)
+		}
+		if got := Bech32Encode(hrp, data, bech32m); got != strings.ToLower(test.s) {
+			t.Errorf("%s: encodes back to %s", test.s, got)
+		}
+	}
+}
+
+// TestBech32Invalid checks that the invalid strings of BIP173 and BIP350 are rejected
+func TestBech32Invalid(t *testing.T) {
+	for _, s := range []string{
+		// Prefix character out of range
+		"\x201nwldj5", "\x7f1axkwrx", "\x801eym55h", "\x201xj0phk", "\x7f1g6xzxy", "\x801vctc34",
+		// Too long
+		"an84characterslonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1569pvx",
+		"an84characterslonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11d6pts4",
+		// No separator
+		"pzry9x0s0muk", "qyrz8wqd2c9m",
+		// Empty prefix
+		"1pzry9x0s0muk", "10a06t8", "1qzzfhee", "1qyrz8wqd2c9m", "16plkw9", "1p2gdwpf",
+		// Invalid data character
+		"x1b4n0q5v", "y1b0jsk6g", "lt1igcx5c0",
+		// Too short checksum
+		"li1dgmt3", "in1muywd",
+		// Invalid checksum character
+		"de1lg7wt\xff", "mm1crxm3i", "au1s5cgom",
+		// Checksum of the uppercase prefix
+		"A1G7SGD8", "M1VUXWEZ",
+		// Mixed case
+		"A12uEL5L",
+	} {
+		if _, _, _, err := Bech32Decode(s); err != ErrInvalidBech32 {
+			t.Errorf("%q: got %v, want %v", s, err, ErrInvalidBech32)
+		}
+	}
+}
+
+// TestConvertBits decodes the witness programs of addresses of BIP173 and BIP350
+func TestConvertBits(t *testing.T) {
+	for _, test := range []struct {
+		address string
+		version byte
+		program string
+	}{
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", 0, "751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", 1,
+			"751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"},
+	} {
+		_, data, _, err := Bech32Decode(test.address)
+		if err != nil {
+			t.Fatalf("%s: %s", test.address, err)
+		}
+		program, err := ConvertBits(data[1:], 5, 8, false)
+		if err != nil {
+			t.Fatalf("%s: %s", test.address, err)
+		}
+		want, _ := hex.DecodeString(test.program)
+		if data[0] != test.version || !bytes.Equal(program, want) {
+			t.Errorf("%s: got version %d program %x, want %d %s", test.address, data[0], program, test.version, test.program)
+		}
+
+		converted, err := ConvertBits(program, 8, 5, true)
+		if err != nil || !bytes.Equal(converted, data[1:]) {
+			t.Errorf("%s: program converts back to %v, %v", test.address, converted, err)
+		}
+	}
+
+	// Leftover bits that aren't zero, or a whole value of them, are padding that shouldn't be there
+	for _, data := range [][]byte{{31, 31}, {0, 0, 0, 0, 0, 0, 0, 0, 0}} {
+		if _, err := ConvertBits(data, 5, 8, false); err != ErrInvalidBech32 {
+			t.Errorf("%v: got %v, want %v", data, err, ErrInvalidBech32)
+		}
+	}
+}
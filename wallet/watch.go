@@ -0,0 +1,57 @@
+package wallet
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/danitello/go-blockchain/common/keys"
+)
+
+// watch is Wallets tracking addresses without their priv keys, to see the balance of keys kept offline
+
+var (
+	// ErrWatchOnly is returned when the priv key of a watch-only Wallet is needed
+	ErrWatchOnly = errors.New("Address is watch-only, its private key is not in the wallet")
+	// ErrAddressExists is returned when watching an address already in the Wallets
+	ErrAddressExists = errors.New("Address is already in the wallet")
+	// ErrInvalidAddress is returned when an address is malformed or its checksum is wrong
+	ErrInvalidAddress = errors.New("Invalid address")
+	// ErrInvalidPubKey is returned when a pub key is not a point on the curve
+	ErrInvalidPubKey = errors.New("Invalid public key")
+)
+
+// ImportAddress adds a watch-only Wallet of a Base58 address, or a Bech32 one under the prefix of a network
+func (ws *Wallets) ImportAddress(address, hrp string) error {
+	if !ValidateAddress(address, hrp) {
+		return ErrInvalidAddress
+	}
+	pubKeyHash, addressHRP, _ := DecodeAddress(address)
+	if _, ok := ws.walletOf(pubKeyHash); ok {
+		return ErrAddressExists
+	}
+
+	w := &Wallet{PubKeyHash: pubKeyHash}
+	if addressHRP != "" {
+		w.Address = strings.ToLower(address)
+	}
+	_, err := ws.addWallet(w)
+	return err
+}
+
+// ImportPubKey adds a watch-only Wallet of a pub key, returning its address
+func (ws *Wallets) ImportPubKey(pubKey []byte) (string, error) {
+	if _, err := keys.ParsePubKey(pubKey); err != nil {
+		return "", ErrInvalidPubKey
+	}
+
+	w := &Wallet{PublicKey: pubKey}
+	// The pub key of a watch-only address completes it, keeping its address
+	if existing, ok := ws.walletOf(w.GetPubKeyHash()); ok {
+		if !existing.IsWatchOnly() || existing.PublicKey != nil {
+			return string(existing.GetAddress()), ErrAddressExists
+		}
+		w.Address = existing.Address
+	}
+
+	return ws.addWallet(w)
+}
@@ -0,0 +1,134 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+
+	"github.com/danitello/go-blockchain/common/keys"
+	"github.com/mr-tron/base58"
+)
+
+// wif is moving single priv keys in and out of Wallets in wallet import format - base58 of a network prefix, the 32
+// byte priv key, the curve of a key with a compressed pub key and a checksum. Keys without the curve byte are P-256
+// keys with the pub key encoding of the first wallets, and keys with keys.SchnorrPubKey in its place are secp256k1
+// keys with a Schnorr pub key
+
+// wifKeyLen is the length of the priv key in a WIF key
+const wifKeyLen = keys.PrivKeyLen
+
+var (
+	// ErrUnknownAddress is returned when an address is not one of the Wallets
+	ErrUnknownAddress = errors.New("Address is not in the wallet")
+	// ErrKeyExists is returned when importing a priv key already in the Wallets
+	ErrKeyExists = errors.New("Key is already in the wallet")
+	// ErrInvalidWIF is returned when a WIF key is malformed or its checksum is wrong
+	ErrInvalidWIF = errors.New("Invalid WIF key")
+)
+
+// EncodeWIF writes a priv key in WIF with the prefix of a network - compressed for a key whose pub key is encoded
+// with keys.EncodePubKey rather than keys.EncodeLegacyPubKey
+func EncodeWIF(privKey ecdsa.PrivateKey, compressed bool, prefix byte) string {
+	if !compressed {
+		return encodeWIF(privKey, nil, prefix)
+	}
+
+	return encodeWIF(privKey, []byte{byte(keys.CurveOf(privKey.PublicKey))}, prefix)
+}
+
+// EncodeSchnorrWIF writes a secp256k1 priv key with a Schnorr pub key in WIF with the prefix of a network
+func EncodeSchnorrWIF(privKey ecdsa.PrivateKey, prefix byte) string {
+	return encodeWIF(privKey, []byte{keys.SchnorrPubKey}, prefix)
+}
+
+// encodeWIF writes a priv key in WIF with the prefix of a network, followed by the byte telling its pub key encoding
+// if there is one
+func encodeWIF(privKey ecdsa.PrivateKey, suffix []byte, prefix byte) string {
+	payload := append([]byte{prefix}, keys.PrivateKeyBytes(privKey)...)
+	payload = append(payload, suffix...)
+	payload = append(payload, checksum(payload)...)
+
+	return base58.Encode(payload)
+}
+
+// DecodeWIF reads a priv key in WIF, which must have the prefix of a network - returns its pub key in the encoding
+// the WIF key calls for
+func DecodeWIF(wif string, prefix byte) (ecdsa.PrivateKey, []byte, error) {
+	decoded, err := base58.Decode(wif)
+	if err != nil || len(decoded) < 1+wifKeyLen+ChecksumLen || len(decoded) > 1+wifKeyLen+1+ChecksumLen {
+		return ecdsa.PrivateKey{}, nil, ErrInvalidWIF
+	}
+
+	payload := decoded[:len(decoded)-ChecksumLen]
+	if !bytes.Equal(checksum(payload), decoded[len(payload):]) {
+		return ecdsa.PrivateKey{}, nil, ErrInvalidWIF
+	}
+	if payload[0] != prefix {
+		return ecdsa.PrivateKey{}, nil, fmt.Errorf("WIF key is for another network (prefix %#x, expected %#x)", payload[0], prefix)
+	}
+
+	curve, suffix := keys.P256, byte(0)
+	if len(payload) > 1+wifKeyLen {
+		suffix = payload[1+wifKeyLen]
+		curve = keys.Curve(suffix)
+	}
+	if suffix == keys.SchnorrPubKey {
+		curve = keys.Secp256k1
+	}
+	privKey, err := keys.PrivateKeyFromBytes(curve, payload[1:1+wifKeyLen])
+	if err != nil {
+		return ecdsa.PrivateKey{}, nil, ErrInvalidWIF
+	}
+
+	switch suffix {
+	case 0:
+		return privKey, keys.EncodeLegacyPubKey(privKey.PublicKey), nil
+	case keys.SchnorrPubKey:
+		return privKey, keys.EncodeSchnorrPubKey(privKey.PublicKey), nil
+	}
+
+	return privKey, keys.EncodePubKey(privKey.PublicKey), nil
+}
+
+// ExportKey gets the priv key of one of the Wallets in WIF with the prefix of a network
+func (ws *Wallets) ExportKey(address string, prefix byte) (string, error) {
+	w, ok := ws.Wallets[address]
+	if !ok {
+		return "", ErrUnknownAddress
+	}
+	if w.IsWatchOnly() {
+		return "", ErrWatchOnly
+	}
+	if ws.IsLocked() {
+		return "", ErrLocked
+	}
+
+	if keys.IsSchnorrPubKey(w.PublicKey) {
+		return EncodeSchnorrWIF(w.PrivateKey, prefix), nil
+	}
+
+	return EncodeWIF(w.PrivateKey, !keys.IsLegacyPubKey(w.PublicKey), prefix), nil
+}
+
+// ImportKey adds the Wallet of a priv key in WIF with the prefix of a network, returning its address
+func (ws *Wallets) ImportKey(wif string, prefix byte) (string, error) {
+	privKey, pubKey, err := DecodeWIF(wif, prefix)
+	if err != nil {
+		return "", err
+	}
+	if ws.IsLocked() {
+		return "", ErrLocked
+	}
+
+	w := &Wallet{PrivateKey: privKey, PublicKey: pubKey}
+	// The key of a watch-only address replaces it, keeping its address
+	if existing, ok := ws.walletOf(w.GetPubKeyHash()); ok {
+		if !existing.IsWatchOnly() {
+			return string(existing.GetAddress()), ErrKeyExists
+		}
+		w.Address = existing.Address
+	}
+
+	return ws.addWallet(w)
+}